@@ -0,0 +1,429 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"intelligent-doc-assistant/internal/answercache"
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/fake"
+	"intelligent-doc-assistant/internal/llm"
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+	"intelligent-doc-assistant/internal/usage"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer boots the API with model, the fake embedder and in-memory chunk, session and
+// usage stores, applies configure and ingests testdata/shop
+func newTestServer(t *testing.T, model llm.ChatModel, configure ...func(*Server)) *httptest.Server {
+	s := &Server{
+		Router:          mux.NewRouter(),
+		Parser:          parser.NewParser(),
+		Storage:         storage.NewMemoryStore(embeddings.NewMeteredEmbedder(fake.NewEmbedder(fake.DefaultDimension))),
+		LLM:             llm.NewClientWithModel(model),
+		Sessions:        session.NewMemoryStore(time.Hour),
+		HistoryMessages: 10,
+		Usage:           usage.NewMemoryStore(0),
+		Prices:          usage.Prices{Prompt: 1, Completion: 2, Embedding: 0.5},
+	}
+	for _, fn := range configure {
+		fn(s)
+	}
+	s.setupRoutes()
+
+	server := httptest.NewServer(s.Router)
+	t.Cleanup(server.Close)
+
+	var resp Response
+	status := post(t, server, "/ingest", IngestRequest{RepoPath: "testdata/shop"}, &resp)
+	require.Equal(t, http.StatusOK, status, resp.Error)
+	return server
+}
+
+// post sends body as JSON to path and decodes the response into out
+func post(t *testing.T, server *httptest.Server, path string, body, out interface{}) int {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+path, "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	return resp.StatusCode
+}
+
+type askData struct {
+	Answer    string       `json:"answer"`
+	Sources   []llm.Source `json:"sources"`
+	SessionID string       `json:"sessionId"`
+	Cached    bool         `json:"cached"`
+}
+
+func TestEndToEndSearch(t *testing.T) {
+	server := newTestServer(t, fake.NewChatModel())
+
+	var resp struct {
+		Data struct {
+			Results []SearchHit `json:"results"`
+		} `json:"data"`
+	}
+	status := post(t, server, "/search", SearchRequest{Query: "discount percentage", SearchParams: SearchParams{PathPrefix: "discount"}}, &resp)
+
+	assert.Equal(t, http.StatusOK, status)
+	require.NotEmpty(t, resp.Data.Results)
+	assert.True(t, strings.HasSuffix(resp.Data.Results[0].Symbol, "Apply"), resp.Data.Results[0].Symbol)
+	for _, hit := range resp.Data.Results {
+		assert.Equal(t, "discount.go", hit.FilePath)
+	}
+}
+
+func TestEndToEndConversation(t *testing.T) {
+	model := fake.NewChatModel().
+		On(`Follow-up question: And how is the discount applied\?`, "How does Discount.Apply reduce the cart total?").
+		On(`Question: And how is the discount applied\?`, "Apply subtracts the percentage from the total [1].").
+		On(`Question: How is the cart total computed\?`, "Total sums price times quantity [1] and applies the discount [7].")
+	server := newTestServer(t, model)
+
+	var first struct{ Data askData }
+	status := post(t, server, "/ask", AskRequest{Question: "How is the cart total computed?"}, &first)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Total sums price times quantity [1] and applies the discount.", first.Data.Answer)
+	require.NotEmpty(t, first.Data.Sources)
+	assert.True(t, first.Data.Sources[0].Cited)
+	assert.NotEmpty(t, first.Data.SessionID)
+
+	var second struct{ Data askData }
+	status = post(t, server, "/ask", AskRequest{Question: "And how is the discount applied?", SessionID: first.Data.SessionID}, &second)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Apply subtracts the percentage from the total [1].", second.Data.Answer)
+	assert.Equal(t, first.Data.SessionID, second.Data.SessionID)
+
+	transcript := model.Transcript()
+	require.Len(t, transcript, 3)
+	assert.Contains(t, transcript[1].Prompt, "User: How is the cart total computed?")
+	assert.Contains(t, transcript[2].Prompt, "Conversation so far")
+	assert.Contains(t, transcript[2].Prompt, "Assistant: Total sums price times quantity and applies the discount.")
+
+	// Session IDs are issued by the server; made-up ones are rejected before any model call
+	var unknown Response
+	status = post(t, server, "/ask", AskRequest{Question: "And how is the discount applied?", SessionID: "my-session"}, &unknown)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Contains(t, unknown.Error, "unknown or expired sessionId")
+	assert.Len(t, model.Transcript(), 3)
+}
+
+func TestEndToEndStream(t *testing.T) {
+	model := fake.NewChatModel().Default("AddItem appends an item to the cart [1].")
+	server := newTestServer(t, model)
+
+	data, err := json.Marshal(AskRequest{Question: "How do I add an item to the cart?", GenerationParams: llm.GenerationParams{MaxTokens: 256}})
+	require.NoError(t, err)
+	resp, err := http.Post(server.URL+"/ask/stream", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var (
+		events []string
+		tokens strings.Builder
+		done   struct {
+			askData
+			Usage llm.Usage `json:"usage"`
+		}
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			events = append(events, name)
+			continue
+		}
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		switch event {
+		case "token":
+			var token struct{ Text string }
+			require.NoError(t, json.Unmarshal([]byte(payload), &token))
+			tokens.WriteString(token.Text)
+		case "done":
+			require.NoError(t, json.Unmarshal([]byte(payload), &done))
+		}
+	}
+
+	assert.Equal(t, "retrieval", events[0])
+	assert.Equal(t, "done", events[len(events)-1])
+	assert.Equal(t, "AddItem appends an item to the cart [1].", tokens.String())
+	assert.Equal(t, tokens.String(), done.Answer)
+	assert.NotZero(t, done.Usage.TotalTokens)
+	assert.Equal(t, 256, model.Transcript()[0].Params.MaxTokens)
+}
+
+func TestEndToEndAgent(t *testing.T) {
+	model := fake.NewChatModel().
+		On("```go", "Total sums the items and calls Apply [1].").
+		OnCall(`^\[1\] shop\.\(\*Cart\)\.Total`, llm.ToolCall{ID: "call_2", Name: llm.ToolGetSymbol, Args: map[string]interface{}{"symbol": "Total"}}).
+		OnCall(`^Who calls Apply\?$`, llm.ToolCall{ID: "call_1", Name: llm.ToolFindCallers, Args: map[string]interface{}{"name": "Apply"}})
+	server := newTestServer(t, model)
+
+	var resp struct {
+		Data struct {
+			askData
+			Steps []llm.AgentStep `json:"steps"`
+		}
+	}
+	status := post(t, server, "/ask", AskRequest{Question: "Who calls Apply?", Agent: true}, &resp)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Total sums the items and calls Apply [1].", resp.Data.Answer)
+	require.Len(t, resp.Data.Sources, 1)
+	assert.Equal(t, "shop.(*Cart).Total", resp.Data.Sources[0].Symbol)
+	assert.True(t, resp.Data.Sources[0].Cited)
+
+	require.Len(t, resp.Data.Steps, 2)
+	assert.Equal(t, llm.ToolFindCallers, resp.Data.Steps[0].Tool)
+	assert.Equal(t, llm.ToolGetSymbol, resp.Data.Steps[1].Tool)
+	assert.Contains(t, resp.Data.Steps[1].Output, "return discount.Apply(total)")
+	assert.Len(t, model.Transcript(), 3)
+
+	var streamResp Response
+	status = post(t, server, "/ask/stream", AskRequest{Question: "Who calls Apply?", Agent: true}, &streamResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestEndToEndStructuredAnswer(t *testing.T) {
+	model := fake.NewChatModel().
+		On(`not a valid answer`, `{"summary": "Apply subtracts the discount percentage.", "symbols": [{"symbol": "shop.Discount.Apply"}],
+			"steps": ["Multiply the total by the percentage", "Subtract it"], "caveats": [], "confidence": 0.8, "citations": [1, 42]}`).
+		Default("```json\n{\"summary\": \"Apply subtracts the discount percentage.\"}\n```")
+	server := newTestServer(t, model)
+
+	var resp struct {
+		Data struct {
+			askData
+			Structured llm.StructuredAnswer `json:"structured"`
+		}
+	}
+	status := post(t, server, "/ask", AskRequest{Question: "How is the discount applied?", Format: FormatJSON}, &resp)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Apply subtracts the discount percentage.", resp.Data.Answer)
+	assert.Equal(t, []int{1}, resp.Data.Structured.Citations)
+	assert.Equal(t, "shop.Discount.Apply", resp.Data.Structured.Symbols[0].Symbol)
+	assert.True(t, resp.Data.Sources[0].Cited)
+	assert.Len(t, model.Transcript(), 2)
+
+	var badResp Response
+	for _, req := range []AskRequest{
+		{Question: "Q", Format: "yaml"},
+		{Question: "Q", Format: FormatJSON, Agent: true},
+	} {
+		status = post(t, server, "/ask", req, &badResp)
+		assert.Equal(t, http.StatusBadRequest, status)
+	}
+}
+
+func TestEndToEndAnswerCache(t *testing.T) {
+	model := fake.NewChatModel().
+		On(`Question: .*cart total`, "Total sums price times quantity [1].").
+		On(`Question: .*discount`, "I could not find that.")
+	var s *Server
+	server := newTestServer(t, model, func(server *Server) {
+		server.AnswerCache = answercache.New(fake.NewEmbedder(fake.DefaultDimension), 0.9, 100, 0)
+		s = server
+	})
+	ask := func(req AskRequest) askData {
+		var resp struct{ Data askData }
+		status := post(t, server, "/ask", req, &resp)
+		require.Equal(t, http.StatusOK, status)
+		return resp.Data
+	}
+
+	first := ask(AskRequest{Question: "How is the cart total computed?"})
+	assert.False(t, first.Cached)
+
+	second := ask(AskRequest{Question: "how is the cart total computed"})
+	assert.True(t, second.Cached)
+	assert.Equal(t, first.Answer, second.Answer)
+	assert.Equal(t, first.Sources, second.Sources)
+	assert.Len(t, model.Transcript(), 1)
+
+	// Other options, opting out, follow-ups and uncited answers bypass the cache
+	assert.False(t, ask(AskRequest{Question: "How is the cart total computed?", SearchParams: SearchParams{Limit: 3}}).Cached)
+	noCache := false
+	assert.False(t, ask(AskRequest{Question: "How is the cart total computed?", Cache: &noCache}).Cached)
+	assert.False(t, ask(AskRequest{Question: "How is the cart total computed?", SessionID: first.SessionID}).Cached)
+	ask(AskRequest{Question: "Where is the discount stored?"})
+	assert.False(t, ask(AskRequest{Question: "Where is the discount stored?"}).Cached)
+
+	// Changing the cited code invalidates the answer
+	require.NoError(t, s.Storage.StoreChunks(context.Background(), []parser.CodeChunk{{
+		Repo: first.Sources[0].Repo, FilePath: first.Sources[0].FilePath, Symbol: first.Sources[0].Symbol,
+		Name: "Total", Kind: parser.KindMethod, Content: "func (c *Cart) Total() int { return 0 }",
+	}}))
+	assert.False(t, ask(AskRequest{Question: "How is the cart total computed?"}).Cached)
+	assert.True(t, ask(AskRequest{Question: "How is the cart total computed?"}).Cached)
+}
+
+func TestEndToEndUsage(t *testing.T) {
+	model := fake.NewChatModel().Default("Total sums price times quantity [1].")
+	server := newTestServer(t, model, func(s *Server) { s.AdminToken = "secret" })
+
+	do := func(method, path string, header http.Header, body, out interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		return resp
+	}
+
+	var askResp struct {
+		Data struct {
+			Usage usage.Totals `json:"usage"`
+		}
+	}
+	resp := do("POST", "/ask", http.Header{UserHeader: {"alice"}, RequestIDHeader: {"req-1"}},
+		AskRequest{Question: "How is the cart total computed?"}, &askResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "req-1", resp.Header.Get(RequestIDHeader))
+	assert.Equal(t, 1, askResp.Data.Usage.ChatCalls)
+	assert.NotZero(t, askResp.Data.Usage.PromptTokens)
+	assert.Equal(t, 1, askResp.Data.Usage.EmbeddingCalls)
+	assert.Greater(t, askResp.Data.Usage.CostUSD, 0.0)
+
+	var adminResp Response
+	resp = do("GET", "/admin/usage", http.Header{}, nil, &adminResp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = do("GET", "/admin/usage?period=year", http.Header{"Authorization": {"Bearer secret"}}, nil, &adminResp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var usageResp struct {
+		Data struct {
+			Aggregates []usage.Aggregate `json:"aggregates"`
+			Total      struct {
+				Requests int          `json:"requests"`
+				Usage    usage.Totals `json:"usage"`
+			} `json:"total"`
+		}
+	}
+	resp = do("GET", "/admin/usage?period=day&groupBy=user", http.Header{"Authorization": {"Bearer secret"}}, nil, &usageResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// The ingestion of the test server has no user
+	require.Len(t, usageResp.Data.Aggregates, 2)
+	assert.Equal(t, "", usageResp.Data.Aggregates[0].Key)
+	assert.NotZero(t, usageResp.Data.Aggregates[0].EmbeddingTokens)
+	assert.Equal(t, "alice", usageResp.Data.Aggregates[1].Key)
+	assert.Equal(t, askResp.Data.Usage, usageResp.Data.Aggregates[1].Totals)
+	assert.Equal(t, 2, usageResp.Data.Total.Requests)
+
+	resp = do("GET", "/admin/usage?groupBy=repo", http.Header{"Authorization": {"Bearer secret"}}, nil, &usageResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, usageResp.Data.Aggregates, 1)
+	assert.Equal(t, parser.RepoID("testdata/shop"), usageResp.Data.Aggregates[0].Key)
+	assert.Equal(t, 2, usageResp.Data.Aggregates[0].Requests)
+
+	// Long user IDs are cut on a rune boundary; the limit falls inside the final "é"
+	long := strings.Repeat("b", maxUserLength-1) + "é"
+	resp = do("POST", "/ask", http.Header{UserHeader: {long}}, AskRequest{Question: "How is the cart total computed?"}, &askResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("GET", "/admin/usage?period=day&groupBy=user", http.Header{"Authorization": {"Bearer secret"}}, nil, &usageResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, usageResp.Data.Aggregates, 3)
+	assert.Equal(t, strings.Repeat("b", maxUserLength-1), usageResp.Data.Aggregates[2].Key)
+}
+
+func TestEndToEndGuardrails(t *testing.T) {
+	model := fake.NewChatModel().Default("Open connects to the database [1].")
+	var s *Server
+	server := newTestServer(t, model, func(server *Server) {
+		server.Guard = server.LLM.Guard()
+		s = server
+	})
+
+	var ingestResp struct {
+		Data struct {
+			Guardrails map[string]int `json:"guardrails"`
+		}
+	}
+	status := post(t, server, "/ingest", IngestRequest{RepoPath: "testdata/leaky"}, &ingestResp)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, ingestResp.Data.Guardrails["redacted"])
+	assert.NotZero(t, ingestResp.Data.Guardrails["flagged"])
+
+	// The secret was redacted before it was stored
+	chunks, err := s.Storage.FindChunks(context.Background(), storage.ChunkFilter{Symbol: "Open"})
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Contains(t, chunks[0].Content, "postgres://orders:[REDACTED:connection-string-password]@db:5432/orders")
+
+	var askResp struct{ Data askData }
+	status = post(t, server, "/ask", AskRequest{Question: "How is the orders database opened?", SearchParams: SearchParams{Repo: "testdata/leaky"}}, &askResp)
+	require.Equal(t, http.StatusOK, status)
+	prompt := model.Transcript()[0].Prompt
+	assert.NotContains(t, prompt, "hunter22")
+	assert.Contains(t, prompt, "Warning: this snippet contains text that reads like instructions to an AI assistant (ai-addressed)")
+
+	// Code indexed before the guardrails were enabled is redacted in streamed retrieval results
+	require.NoError(t, s.Storage.StoreChunks(context.Background(), []parser.CodeChunk{{
+		Repo: parser.RepoID("testdata/legacy"), FilePath: "db.go", Symbol: "legacy.Connect", Name: "Connect", Kind: parser.KindFunction,
+		Content: "func Connect() (*sql.DB, error) {\n\treturn sql.Open(\"postgres\", \"postgres://orders:hunter22@db:5432/orders\")\n}",
+	}}))
+	data, err := json.Marshal(AskRequest{Question: "How is the orders database opened?", SearchParams: SearchParams{Repo: "testdata/legacy"}})
+	require.NoError(t, err)
+	resp, err := http.Post(server.URL+"/ask/stream", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	stream, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(stream), "event: retrieval")
+	assert.Contains(t, string(stream), "[REDACTED:connection-string-password]")
+	assert.NotContains(t, string(stream), "hunter22")
+}
+
+func TestEndToEndUnfinishedAnswers(t *testing.T) {
+	model := fake.NewChatModel().
+		OnUnfinished(`Question: How is the cart total computed\?`, "Total sums price ", llm.FinishMaxTokens).
+		On(`was cut off`, "times quantity [1].").
+		OnUnfinished(`Question: How do I empty the cart\?`, "", llm.FinishSafety)
+	server := newTestServer(t, model)
+
+	// Answers cut off at the token limit are continued
+	var continued struct{ Data askData }
+	status := post(t, server, "/ask", AskRequest{Question: "How is the cart total computed?"}, &continued)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Total sums price times quantity [1].", continued.Data.Answer)
+	require.Len(t, model.Transcript(), 2)
+
+	// Blocked answers are reported as such rather than returned empty
+	var blocked Response
+	status = post(t, server, "/ask", AskRequest{Question: "How do I empty the cart?"}, &blocked)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.False(t, blocked.Success)
+	assert.Equal(t, "answer blocked by safety filters", blocked.Error)
+}
@@ -1,14 +1,24 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/answercache"
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/guardrails"
 	"intelligent-doc-assistant/internal/llm"
 	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/rerank"
+	"intelligent-doc-assistant/internal/session"
 	"intelligent-doc-assistant/internal/storage"
+	"intelligent-doc-assistant/internal/usage"
 
 	"github.com/gorilla/mux"
 )
@@ -16,33 +26,234 @@ import (
 type Server struct {
 	Router  *mux.Router
 	Parser  *parser.Parser
-	Storage *storage.Store
+	Storage storage.ChunkStore
 	LLM     *llm.Client
+
+	// Reranker reorders search results before they are returned or sent to the LLM; nil disables it
+	Reranker         rerank.Reranker
+	RerankCandidates int
+
+	// QueryRewrite retrieves with up to RewriteCount LLM reformulations of each question by default
+	QueryRewrite bool
+	RewriteCount int
+
+	// Sessions stores conversation history for follow-up questions; nil disables sessions.
+	// HistoryMessages earlier messages are sent with each question.
+	Sessions        session.Store
+	HistoryMessages int
+
+	// AgentMaxSteps bounds the tool calls of questions asked in agent mode
+	AgentMaxSteps int
+
+	// AnswerCache reuses answers to questions asked before; nil disables it
+	AnswerCache *answercache.Cache
+
+	// Usage records the tokens and cost of each request, priced with Prices; nil disables it
+	Usage  usage.Store
+	Prices usage.Prices
+
+	// AdminToken is the bearer token of the /admin endpoints; empty disables them
+	AdminToken string
+
+	// Guard redacts secrets from ingested code before it is embedded and stored, and from
+	// search results; nil disables it. The LLM client guards its prompts itself.
+	Guard *guardrails.Guard
 }
 
+// rewrittenQueryWeight down-weights LLM reformulations relative to the user's own question
+const rewrittenQueryWeight = 0.5
+
 func NewServer() *Server {
+	cfg := config.GetConfig()
+	store := storage.NewStore()
 	s := &Server{
-		Router:  mux.NewRouter(),
-		Parser:  parser.NewParser(),
-		Storage: storage.NewStore(),
-		LLM:     llm.NewClient(),
+		Router:           mux.NewRouter(),
+		Parser:           parser.NewParser(),
+		LLM:              llm.NewClient(),
+		RerankCandidates: cfg.RerankCandidates,
+		QueryRewrite:     cfg.QueryRewrite,
+		RewriteCount:     cfg.QueryRewriteCount,
+		HistoryMessages:  cfg.SessionHistoryMessages,
+		AgentMaxSteps:    cfg.AgentMaxSteps,
+		Prices:           usage.PricesFromConfig(cfg),
+		AdminToken:       cfg.AdminToken,
+	}
+
+	reranker, err := rerank.New(cfg.Reranker, s.LLM)
+	if err != nil {
+		fmt.Printf("Reranking disabled: %v\n", err)
+	}
+	s.Reranker = reranker
+	s.Guard = s.LLM.Guard()
+
+	var (
+		db       *sql.DB
+		embedder embeddings.Embedder
+	)
+	if store != nil {
+		// A nil *Store must not become a non-nil ChunkStore
+		s.Storage = store
+		db = store.DB()
+		embedder = store.Embedder()
+	}
+	sessions, err := session.NewStoreFromConfig(cfg, db)
+	if err != nil {
+		fmt.Printf("Sessions disabled: %v\n", err)
+	}
+	s.Sessions = sessions
+
+	cache, err := answercache.NewFromConfig(cfg, embedder)
+	if err != nil {
+		fmt.Printf("Answer cache disabled: %v\n", err)
+	}
+	s.AnswerCache = cache
+
+	usageStore, err := usage.NewStoreFromConfig(cfg, db)
+	if err != nil {
+		fmt.Printf("Usage recording disabled: %v\n", err)
 	}
+	s.Usage = usageStore
 
 	s.setupRoutes()
 	return s
 }
 
 func (s *Server) setupRoutes() {
-	s.Router.HandleFunc("/ingest", s.handleIngest).Methods("POST")
-	s.Router.HandleFunc("/ask", s.handleAsk).Methods("POST")
+	s.Router.HandleFunc("/ingest", s.metered("ingest", s.handleIngest)).Methods("POST")
+	s.Router.HandleFunc("/ask", s.metered("ask", s.handleAsk)).Methods("POST")
+	s.Router.HandleFunc("/ask/stream", s.metered("ask/stream", s.handleAskStream)).Methods("POST")
+	s.Router.HandleFunc("/search", s.metered("search", s.handleSearch)).Methods("POST")
+	s.Router.HandleFunc("/admin/usage", s.handleUsage).Methods("GET")
 }
 
 type IngestRequest struct {
 	RepoPath string `json:"repoPath"`
 }
 
+// SearchParams are the optional retrieval settings accepted by /ask and /search
+type SearchParams struct {
+	Limit         int      `json:"limit,omitempty"`
+	MinScore      *float64 `json:"minScore,omitempty"`
+	VectorWeight  *float64 `json:"vectorWeight,omitempty"`
+	KeywordWeight *float64 `json:"keywordWeight,omitempty"`
+	MMRLambda     *float64 `json:"mmrLambda,omitempty"`
+	MaxPerFile    *int     `json:"maxPerFile,omitempty"`
+	EFSearch      int      `json:"efSearch,omitempty"`
+	Probes        int      `json:"probes,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	Kind          string   `json:"kind,omitempty"`
+	PathPrefix    string   `json:"pathPrefix,omitempty"`
+	PathGlob      string   `json:"pathGlob,omitempty"`
+	Package       string   `json:"package,omitempty"`
+	Repo          string   `json:"repo,omitempty"`
+	ExportedOnly  bool     `json:"exportedOnly,omitempty"`
+
+	// Rerank disables the configured reranker when set to false
+	Rerank *bool `json:"rerank,omitempty"`
+	// Expand turns LLM query rewriting on or off for this request
+	Expand *bool `json:"expand,omitempty"`
+}
+
+// searchOptions returns the retrieval options requested, falling back to defaults
+func (p SearchParams) searchOptions() storage.SearchOptions {
+	opts := storage.DefaultSearchOptions()
+	if p.Limit > 0 {
+		opts.Limit = p.Limit
+	}
+	if p.MinScore != nil {
+		opts.MinScore = *p.MinScore
+	}
+	if p.VectorWeight != nil {
+		opts.VectorWeight = *p.VectorWeight
+	}
+	if p.KeywordWeight != nil {
+		opts.KeywordWeight = *p.KeywordWeight
+	}
+	if p.MMRLambda != nil {
+		opts.MMRLambda = p.MMRLambda
+	}
+	if p.MaxPerFile != nil {
+		opts.MaxPerFile = *p.MaxPerFile
+	}
+	opts.EFSearch = p.EFSearch
+	opts.Probes = p.Probes
+	opts.Language = p.Language
+	opts.Kind = p.Kind
+	opts.PathPrefix = p.PathPrefix
+	opts.PathGlob = p.PathGlob
+	opts.Package = p.Package
+	if p.Repo != "" {
+		opts.Repo = parser.RepoID(p.Repo)
+	}
+	opts.ExportedOnly = p.ExportedOnly
+	return opts
+}
+
 type AskRequest struct {
 	Question string `json:"question"`
+	// SessionID continues an earlier conversation; without it a new session is started
+	SessionID string `json:"sessionId,omitempty"`
+	// Agent lets the model look up code with tools instead of answering from one search
+	Agent bool `json:"agent,omitempty"`
+	// Format is "text" (the default) for a prose answer or "json" for a structured one
+	Format string `json:"format,omitempty"`
+	// Cache set to false neither reuses a cached answer nor caches the new one
+	Cache *bool `json:"cache,omitempty"`
+	SearchParams
+	// Model and sampling settings for the answer, overriding the deployment's
+	llm.GenerationParams
+}
+
+// Answer formats accepted by /ask
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// validate checks the options that do not depend on the endpoint
+func (r AskRequest) validate() error {
+	switch r.Format {
+	case "", FormatText:
+	case FormatJSON:
+		if r.Agent {
+			return fmt.Errorf("format %q is not supported in agent mode", FormatJSON)
+		}
+	default:
+		return fmt.Errorf("format must be %q or %q", FormatText, FormatJSON)
+	}
+	return r.GenerationParams.Validate()
+}
+
+// cacheOptions encodes the options an answer depends on besides the question
+func (r AskRequest) cacheOptions() string {
+	data, _ := json.Marshal(struct {
+		Format string
+		SearchParams
+		llm.GenerationParams
+	}{r.Format, r.SearchParams, r.GenerationParams})
+	return string(data)
+}
+
+type SearchRequest struct {
+	Query string `json:"query"`
+	SearchParams
+}
+
+// SearchHit is a single /search result
+type SearchHit struct {
+	ID          int64   `json:"id"`
+	Repo        string  `json:"repo,omitempty"`
+	FilePath    string  `json:"filePath"`
+	StartLine   int     `json:"startLine"`
+	EndLine     int     `json:"endLine"`
+	Symbol      string  `json:"symbol"`
+	Kind        string  `json:"kind,omitempty"`
+	Package     string  `json:"package,omitempty"`
+	Language    string  `json:"language"`
+	Similarity  float64 `json:"similarity"`
+	Score       float64 `json:"score"`
+	RerankScore float64 `json:"rerankScore,omitempty"`
+	Content     string  `json:"content"`
 }
 
 type Response struct {
@@ -78,16 +289,31 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to parse codebase: %v", err))
 		return
 	}
+	parser.SetRepo(chunks, parser.RepoID(req.RepoPath), parser.RepoCommit(repoPath), repoPath)
+	usage.FromContext(r.Context()).SetRepo(parser.RepoID(req.RepoPath))
+	redacted, flagged := s.Guard.SanitizeChunks(guardrails.StageIngest, chunks)
+	if redacted+flagged > 0 {
+		fmt.Printf("Guardrails redacted %d secrets and flagged %d instructions\n", redacted, flagged)
+	}
 
 	// Store the chunks and their embeddings
 	if err := s.Storage.StoreChunks(r.Context(), chunks); err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store code chunks: %v", err))
 		return
 	}
+	if s.AnswerCache != nil {
+		if n := s.AnswerCache.Invalidate(chunks); n > 0 {
+			fmt.Printf("Invalidated %d cached answers citing changed code\n", n)
+		}
+	}
 
 	respondWithJSON(w, http.StatusOK, Response{
 		Success: true,
-		Data:    map[string]interface{}{"message": "Successfully ingested codebase"},
+		Data: map[string]interface{}{
+			"message":    "Successfully ingested codebase",
+			"usage":      usage.FromContext(r.Context()).Totals(),
+			"guardrails": map[string]int{"redacted": redacted, "flagged": flagged},
+		},
 	})
 }
 
@@ -97,27 +323,361 @@ func (s *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if req.SessionID != "" && s.Sessions == nil {
+		respondWithError(w, http.StatusBadRequest, "sessions are disabled")
+		return
+	}
 
-	// Search for relevant chunks
-	searchResults, err := s.Storage.SearchChunks(r.Context(), req.Question)
+	opts := req.searchOptions()
+	if err := opts.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	sessionID, history, err := s.loadSession(ctx, req.SessionID)
+	if errors.Is(err, errUnknownSession) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to search code chunks")
+		respondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
 		return
 	}
 
-	// Generate answer using LLM with search results
-	answer, err := s.LLM.GenerateAnswer(r.Context(), req.Question, searchResults)
+	// Only questions that do not follow up on a conversation are answered from the cache
+	var (
+		cacheKey       string
+		cacheEmbedding []float32
+	)
+	if s.AnswerCache != nil && len(history) == 0 && !req.Agent && (req.Cache == nil || *req.Cache) {
+		cacheKey = answercache.Key(s.Storage, req.cacheOptions())
+		entry, embedding := s.cachedAnswer(ctx, cacheKey, req.Question)
+		if entry != nil {
+			s.saveTurn(ctx, sessionID, req.Question, entry.Answer.Text)
+			meter := attributeAnswer(ctx, opts, entry.Answer)
+			respondWithJSON(w, http.StatusOK, Response{
+				Success: true,
+				Data:    askResponse(entry.Answer, nil, false, sessionID, true, meter.Totals()),
+			})
+			return
+		}
+		cacheEmbedding = embedding
+	}
+
+	var (
+		answer        llm.Answer
+		steps         []llm.AgentStep
+		searchResults []storage.SearchResult
+	)
+	if req.Agent {
+		// The agent searches by itself, so it gets the follow-up question as asked
+		answer, steps, err = s.LLM.RunAgent(ctx, req.Question, history, s.Storage, opts, s.AgentMaxSteps, req.GenerationParams)
+	} else {
+		// Search for relevant chunks
+		var searchErr error
+		searchResults, searchErr = s.search(ctx, s.retrievalQuery(ctx, history, req.Question), opts, req.SearchParams)
+		if searchErr != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to search code chunks")
+			return
+		}
+
+		// Generate answer using LLM with search results
+		if req.Format == FormatJSON {
+			answer, err = s.LLM.GenerateStructuredAnswer(ctx, req.Question, history, searchResults, req.GenerationParams)
+		} else {
+			answer, err = s.LLM.GenerateAnswer(ctx, req.Question, history, searchResults, req.GenerationParams)
+		}
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, answerErrorStatus(err), err.Error())
 		return
 	}
+	s.saveTurn(ctx, sessionID, req.Question, answer.Text)
+	if cacheEmbedding != nil {
+		s.cacheAnswer(cacheKey, req.Question, cacheEmbedding, answer, searchResults)
+	}
+	meter := attributeAnswer(ctx, opts, answer)
 
 	respondWithJSON(w, http.StatusOK, Response{
 		Success: true,
-		Data:    map[string]interface{}{"answer": answer},
+		Data:    askResponse(answer, steps, req.Agent, sessionID, false, meter.Totals()),
 	})
 }
 
+// answerErrorStatus is the status for a failure to answer: 422 for answers the model's
+// filters blocked, which asking again will not change, and 502 for answers it did not finish
+func answerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, llm.ErrBlocked), errors.Is(err, llm.ErrRecitation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, llm.ErrTruncated), errors.Is(err, llm.ErrIncomplete):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// attributeAnswer attributes the request to the repository searched, or else to the one
+// answer's sources come from, and returns the request's meter
+func attributeAnswer(ctx context.Context, opts storage.SearchOptions, answer llm.Answer) *usage.Meter {
+	meter := usage.FromContext(ctx)
+	repo := opts.Repo
+	if repo == "" {
+		repo = answerRepo(answer)
+	}
+	meter.SetRepo(repo)
+	return meter
+}
+
+// askResponse builds the /ask response for answer, with the usage of the whole request
+func askResponse(answer llm.Answer, steps []llm.AgentStep, agent bool, sessionID string, cached bool, totals usage.Totals) map[string]interface{} {
+	data := map[string]interface{}{"answer": answer.Text, "sources": answer.Sources, "usage": totals}
+	if agent {
+		data["steps"] = steps
+	}
+	if answer.Structured != nil {
+		data["structured"] = answer.Structured
+	}
+	if sessionID != "" {
+		data["sessionId"] = sessionID
+	}
+	if cached {
+		data["cached"] = true
+	}
+	return data
+}
+
+// cachedAnswer returns the cached answer to question if there is one whose cited code is
+// unchanged. It also returns the question's embedding, to cache a new answer under; both
+// are nil when the lookup fails, which only costs the cache hit.
+func (s *Server) cachedAnswer(ctx context.Context, key, question string) (*answercache.Entry, []float32) {
+	embedding, err := s.AnswerCache.Embed(ctx, question)
+	if err != nil {
+		fmt.Printf("Answer cache lookup failed: %v\n", err)
+		return nil, nil
+	}
+
+	entry, ok := s.AnswerCache.Get(key, embedding)
+	if !ok {
+		return nil, embedding
+	}
+	current, err := s.AnswerCache.Verify(ctx, s.Storage, entry)
+	if err != nil {
+		fmt.Printf("Failed to verify cached answer: %v\n", err)
+		return nil, embedding
+	}
+	if !current {
+		fmt.Printf("Dropped cached answer to %q, the code it cites changed\n", entry.Question)
+		return nil, embedding
+	}
+
+	return entry, embedding
+}
+
+// cacheAnswer caches answer with the chunks it cites. Answers citing nothing are not cached,
+// since there is no code whose changes would invalidate them.
+func (s *Server) cacheAnswer(key, question string, embedding []float32, answer llm.Answer, searchResults []storage.SearchResult) {
+	var refs []answercache.ChunkRef
+	for _, source := range answer.Sources {
+		// Sources are numbered in the order of the search results
+		if source.Cited && source.ID >= 1 && source.ID <= len(searchResults) {
+			refs = append(refs, answercache.RefOf(searchResults[source.ID-1].Chunk))
+		}
+	}
+	if len(refs) == 0 {
+		return
+	}
+
+	// The cached copy is served for free
+	answer.Usage = llm.Usage{}
+	s.AnswerCache.Put(answercache.Entry{Key: key, Question: question, Embedding: embedding, Answer: answer, Chunks: refs})
+}
+
+// errUnknownSession is returned for a session ID the server did not issue, or one that expired
+var errUnknownSession = errors.New("unknown or expired sessionId, ask without one to start a new conversation")
+
+// loadSession returns the ID of the session to continue, starting a new one when id is empty,
+// and its recent history. It returns an empty ID when sessions are disabled. Session IDs are
+// only issued by the server: an ID without history is rejected with errUnknownSession.
+func (s *Server) loadSession(ctx context.Context, id string) (string, []session.Message, error) {
+	if s.Sessions == nil {
+		return "", nil, nil
+	}
+	if id == "" {
+		id, err := session.NewID()
+		return id, nil, err
+	}
+
+	history, err := s.Sessions.History(ctx, id, s.HistoryMessages)
+	if err != nil {
+		fmt.Printf("Failed to load session %s: %v\n", id, err)
+		return "", nil, err
+	}
+	if len(history) == 0 {
+		return "", nil, errUnknownSession
+	}
+	return id, history, nil
+}
+
+// retrievalQuery condenses a follow-up question into a standalone query, so that retrieval
+// finds the code the conversation is about. It falls back to the question itself.
+func (s *Server) retrievalQuery(ctx context.Context, history []session.Message, question string) string {
+	if len(history) == 0 {
+		return question
+	}
+
+	query, err := s.LLM.CondenseQuestion(ctx, history, question)
+	if err != nil || query == "" {
+		fmt.Printf("Searching with the follow-up question as asked: %v\n", err)
+		return question
+	}
+
+	return query
+}
+
+// saveTurn records a question and its answer in the session; failures only lose history
+func (s *Server) saveTurn(ctx context.Context, sessionID, question, answer string) {
+	if sessionID == "" {
+		return
+	}
+
+	err := s.Sessions.Append(ctx, sessionID,
+		session.Message{Role: session.RoleUser, Content: question},
+		session.Message{Role: session.RoleAssistant, Content: answer})
+	if err != nil {
+		fmt.Printf("Failed to save session %s: %v\n", sessionID, err)
+	}
+}
+
+// search retrieves chunks for query, adding LLM reformulations of it when query rewriting
+// is enabled. When a reranker is enabled it retrieves a wider candidate set, reranks it
+// and keeps the opts.Limit best.
+func (s *Server) search(ctx context.Context, query string, opts storage.SearchOptions, params SearchParams) ([]storage.SearchResult, error) {
+	expand := s.QueryRewrite
+	if params.Expand != nil {
+		expand = *params.Expand
+	}
+
+	queries := []storage.Query{{Text: query, Weight: 1}}
+	if expand {
+		queries = append(queries, s.rewriteQuery(ctx, query)...)
+	}
+
+	if s.Reranker == nil || (params.Rerank != nil && !*params.Rerank) {
+		return s.Storage.SearchQueries(ctx, queries, opts)
+	}
+
+	limit := opts.Limit
+	if opts.Limit < s.RerankCandidates {
+		opts.Limit = min(s.RerankCandidates, storage.MaxSearchLimit)
+	}
+
+	results, err := s.Storage.SearchQueries(ctx, queries, opts)
+	if err != nil {
+		return nil, err
+	}
+	results, err = s.Reranker.Rerank(ctx, query, results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank results: %w", err)
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// rewriteQuery returns LLM reformulations of query as additional search queries.
+// Rewriting only improves recall, so failures fall back to the original question.
+func (s *Server) rewriteQuery(ctx context.Context, query string) []storage.Query {
+	rewrite, err := s.LLM.RewriteQuery(ctx, query, s.RewriteCount)
+	if err != nil {
+		fmt.Printf("Query rewriting failed, searching with the original question: %v\n", err)
+		return nil
+	}
+
+	var queries []storage.Query
+	for _, text := range rewrite.Queries() {
+		queries = append(queries, storage.Query{Text: text, Weight: rewrittenQueryWeight})
+	}
+	return queries
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req SearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Query == "" {
+		respondWithError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	opts := req.searchOptions()
+	if err := opts.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := s.search(r.Context(), req.Query, opts, req.SearchParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search code chunks")
+		return
+	}
+	meter := usage.FromContext(r.Context())
+	meter.SetRepo(opts.Repo)
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    map[string]interface{}{"results": s.redactedHits(results), "usage": meter.Totals()},
+	})
+}
+
+// redactedHits converts search results to their API representation with secrets redacted,
+// since code indexed before the guardrails were enabled may still hold them. The results
+// themselves are left as they are.
+func (s *Server) redactedHits(results []storage.SearchResult) []SearchHit {
+	redacted := make([]storage.SearchResult, len(results))
+	for i, result := range results {
+		result.Chunk, _ = s.Guard.Check(guardrails.StageSearch, result.Chunk)
+		redacted[i] = result
+	}
+	return searchHits(redacted)
+}
+
+// searchHits converts search results to their API representation
+func searchHits(results []storage.SearchResult) []SearchHit {
+	hits := make([]SearchHit, len(results))
+	for i, result := range results {
+		chunk := result.Chunk
+		symbol := chunk.Symbol
+		if symbol == "" {
+			symbol = chunk.Name
+		}
+		hits[i] = SearchHit{
+			ID:          result.ID,
+			Repo:        chunk.Repo,
+			FilePath:    chunk.FilePath,
+			StartLine:   chunk.StartLine,
+			EndLine:     chunk.EndLine,
+			Symbol:      symbol,
+			Kind:        chunk.Kind,
+			Package:     chunk.Package,
+			Language:    chunk.Language,
+			Similarity:  result.Similarity,
+			Score:       result.Score,
+			RerankScore: result.RerankScore,
+			Content:     chunk.Content,
+		}
+	}
+	return hits
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, Response{
 		Success: false,
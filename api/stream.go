@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"intelligent-doc-assistant/internal/llm"
+)
+
+// eventWriter writes Server-Sent Events, flushing each one to the client immediately
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newEventWriter(w http.ResponseWriter) (*eventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventWriter{w: w, flusher: flusher}, nil
+}
+
+// send writes an event named event with data encoded as JSON
+func (e *eventWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event, err)
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return fmt.Errorf("failed to write %s event: %w", event, err)
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// handleAskStream answers a question like handleAsk, streamed as Server-Sent Events:
+//
+//	retrieval  {"results": [...]}                              the chunks the answer is based on
+//	token      {"text": "..."}                                 the next piece of the answer
+//	done       {"answer", "sources", "usage", "sessionId"}     the answer with validated citations and
+//	                                                           the usage of the whole request
+//	error      {"error": "..."}                                generation failed; the stream ends
+//
+// Requests are validated before the stream starts, so they still fail with a JSON error.
+// When the client disconnects the request context is cancelled, which stops generation.
+func (s *Server) handleAskStream(w http.ResponseWriter, r *http.Request) {
+	var req AskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.SessionID != "" && s.Sessions == nil {
+		respondWithError(w, http.StatusBadRequest, "sessions are disabled")
+		return
+	}
+	if req.Agent {
+		respondWithError(w, http.StatusBadRequest, "agent mode is not supported for streaming, use /ask")
+		return
+	}
+	if req.Format == FormatJSON {
+		respondWithError(w, http.StatusBadRequest, "structured answers are not supported for streaming, use /ask")
+		return
+	}
+
+	opts := req.searchOptions()
+	if err := opts.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	sessionID, history, err := s.loadSession(ctx, req.SessionID)
+	if errors.Is(err, errUnknownSession) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
+		return
+	}
+
+	searchResults, err := s.search(ctx, s.retrievalQuery(ctx, history, req.Question), opts, req.SearchParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search code chunks")
+		return
+	}
+
+	events, err := newEventWriter(w)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := events.send("retrieval", map[string]interface{}{"results": s.redactedHits(searchResults)}); err != nil {
+		fmt.Printf("Stopped streaming answer: %v\n", err)
+		return
+	}
+
+	answer, err := s.LLM.StreamAnswer(ctx, req.Question, history, searchResults, req.GenerationParams, func(text string) error {
+		return events.send("token", map[string]string{"text": text})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Printf("Client disconnected while streaming answer: %v\n", ctx.Err())
+			return
+		}
+		failure := map[string]string{"error": err.Error()}
+		var finish *llm.FinishError
+		if errors.As(err, &finish) {
+			failure["finishReason"] = finish.Reason
+		}
+		events.send("error", failure)
+		return
+	}
+
+	s.saveTurn(ctx, sessionID, req.Question, answer.Text)
+	meter := attributeAnswer(ctx, opts, answer)
+
+	done := map[string]interface{}{
+		"answer":  answer.Text,
+		"sources": answer.Sources,
+		"usage":   meter.Totals(),
+	}
+	if sessionID != "" {
+		done["sessionId"] = sessionID
+	}
+	events.send("done", done)
+}
@@ -0,0 +1,27 @@
+package shop
+
+// Item is a product in a shopping cart.
+type Item struct {
+	Name     string
+	Price    int
+	Quantity int
+}
+
+// Cart holds the items a customer is buying.
+type Cart struct {
+	Items []Item
+}
+
+// AddItem adds quantity units of a product to the cart.
+func (c *Cart) AddItem(name string, price, quantity int) {
+	c.Items = append(c.Items, Item{Name: name, Price: price, Quantity: quantity})
+}
+
+// Total returns the cart total in cents after applying the discount.
+func (c *Cart) Total(discount Discount) int {
+	total := 0
+	for _, item := range c.Items {
+		total += item.Price * item.Quantity
+	}
+	return discount.Apply(total)
+}
@@ -0,0 +1,11 @@
+package shop
+
+// Discount reduces a cart total by a percentage.
+type Discount struct {
+	Percent int
+}
+
+// Apply returns total reduced by the discount percentage.
+func (d Discount) Apply(total int) int {
+	return total - total*d.Percent/100
+}
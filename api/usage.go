@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"intelligent-doc-assistant/internal/llm"
+	"intelligent-doc-assistant/internal/usage"
+)
+
+// Headers identifying a request and the user it is made for. The user is taken as given,
+// so it attributes usage but does not authenticate anyone.
+const (
+	RequestIDHeader = "X-Request-ID"
+	UserHeader      = "X-User-ID"
+)
+
+// maxUserLength bounds the user IDs recorded
+const maxUserLength = 128
+
+// requestIDPattern matches the client-supplied request IDs that are kept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// metered meters the model usage of handler's requests as endpoint and records it in
+// s.Usage once the handler is done. Handlers attribute requests to a repository with
+// usage.Meter.SetRepo and report the usage so far in their responses.
+func (s *Server) metered(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			var err error
+			if requestID, err = usage.NewRequestID(); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		meter := usage.NewMeter(s.Prices)
+		handler(w, r.WithContext(usage.WithMeter(r.Context(), meter)))
+
+		if s.Usage == nil {
+			return
+		}
+		user := strings.TrimSpace(r.Header.Get(UserHeader))
+		if len(user) > maxUserLength {
+			// Cut on a rune boundary so the recorded ID stays valid UTF-8
+			cut := maxUserLength
+			for cut > 0 && !utf8.RuneStart(user[cut]) {
+				cut--
+			}
+			user = user[:cut]
+		}
+		record := usage.Record{
+			Time:      time.Now(),
+			RequestID: requestID,
+			User:      user,
+			Repo:      meter.Repo(),
+			Endpoint:  endpoint,
+			Totals:    meter.Totals(),
+		}
+		// The client may be gone by now, but its usage still counts
+		if err := s.Usage.Record(context.WithoutCancel(r.Context()), record); err != nil {
+			fmt.Printf("Failed to record usage of request %s: %v\n", requestID, err)
+		}
+	}
+}
+
+// answerRepo returns the repository all of answer's sources come from, or "" when they
+// come from several
+func answerRepo(answer llm.Answer) string {
+	repo := ""
+	for i, source := range answer.Sources {
+		if i > 0 && source.Repo != repo {
+			return ""
+		}
+		repo = source.Repo
+	}
+	return repo
+}
+
+// handleUsage returns the recorded usage aggregated by period and optionally by user,
+// repository or endpoint:
+//
+//	GET /admin/usage?period=day&groupBy=user&from=2025-01-01&to=2025-02-01
+//
+// period is hour, day (the default), week or month; from and to are RFC 3339 times or dates.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if s.Usage == nil {
+		respondWithError(w, http.StatusNotFound, "usage recording is disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	query := usage.Query{Period: params.Get("period"), GroupBy: params.Get("groupBy")}
+	if query.Period == "" {
+		query.Period = usage.PeriodDay
+	}
+	var err error
+	if query.From, err = parseTime(params.Get("from")); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	if query.To, err = parseTime(params.Get("to")); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+	if err := query.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	aggregates, err := s.Usage.Aggregate(r.Context(), query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to aggregate usage")
+		return
+	}
+	total := usage.Aggregate{}
+	for _, aggregate := range aggregates {
+		total.Requests += aggregate.Requests
+		total.Totals = total.Totals.Add(aggregate.Totals)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"period":     query.Period,
+			"groupBy":    query.GroupBy,
+			"aggregates": aggregates,
+			"total":      map[string]interface{}{"requests": total.Requests, "usage": total.Totals},
+		},
+	})
+}
+
+// authorizeAdmin checks the bearer token of an admin request, responding with an error
+// when it is missing or wrong. Without a configured token admin endpoints are disabled.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.AdminToken == "" {
+		respondWithError(w, http.StatusForbidden, "admin endpoints are disabled, set ADMIN_TOKEN to enable them")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// parseTime parses an RFC 3339 time or a date in UTC; an empty value is the zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
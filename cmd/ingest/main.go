@@ -7,25 +7,49 @@ import (
 	"os"
 	"path/filepath"
 
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/guardrails"
 	"intelligent-doc-assistant/internal/parser"
 	"intelligent-doc-assistant/internal/storage"
 )
 
+// ingestBatchSize is the number of chunks stored per StoreChunks call
+const ingestBatchSize = 1000
+
 func main() {
 	if len(os.Args) < 2 {
 		log.Fatalf("Usage: %s <path-to-codebase>", os.Args[0])
 	}
 	codebasePath := os.Args[1]
+	repo := parser.RepoID(codebasePath)
+	commit := parser.RepoCommit(codebasePath)
 
 	store := storage.NewStore()
 	if store == nil {
 		log.Fatal("Failed to initialize store")
 	}
 
+	guard, err := guardrails.NewFromConfig(config.GetConfig())
+	if err != nil {
+		log.Fatalf("Failed to load guardrails: %v", err)
+	}
+
 	ctx := context.Background()
 
+	// Chunks from many files are stored together so they share embedding batches and bulk inserts
+	var pending []parser.CodeChunk
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := store.StoreChunks(ctx, pending); err != nil {
+			log.Printf("Failed to store %d chunks: %v", len(pending), err)
+		}
+		pending = nil
+	}
+
 	// Walk through all .go files in the codebase
-	err := filepath.Walk(codebasePath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(codebasePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -36,11 +60,14 @@ func main() {
 				log.Printf("Failed to parse %s: %v", path, err)
 				return nil
 			}
+			parser.SetRepo(chunks, repo, commit, codebasePath)
+			// Secrets are redacted before they are embedded or stored
+			guard.SanitizeChunks(guardrails.StageIngest, chunks)
 
 			// Store the chunks - embeddings will be generated automatically
-			if err := store.StoreChunks(ctx, chunks); err != nil {
-				log.Printf("Failed to store chunks for %s: %v", path, err)
-				return nil
+			pending = append(pending, chunks...)
+			if len(pending) >= ingestBatchSize {
+				flush()
 			}
 		}
 		return nil
@@ -48,6 +75,9 @@ func main() {
 	if err != nil {
 		log.Fatal("Error walking codebase:", err)
 	}
+	flush()
 
+	stats := store.EmbeddingCacheStats()
+	fmt.Printf("Embedding cache: %d hits, %d misses\n", stats.Hits, stats.Misses)
 	fmt.Println("✅ Codebase ingestion completed successfully")
 }
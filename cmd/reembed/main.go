@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("Usage: %s <embedding-model> [batch-size] | -abort", os.Args[0])
+	}
+
+	cfg := config.GetConfig()
+	store := storage.NewStore()
+	if store == nil {
+		log.Fatal("Failed to initialize store")
+	}
+
+	ctx := context.Background()
+
+	if os.Args[1] == "-abort" {
+		if err := store.AbortReembed(ctx); err != nil {
+			log.Fatalf("Failed to abort re-embedding: %v", err)
+		}
+		fmt.Println("✅ Re-embedding aborted")
+		return
+	}
+
+	batchSize := storage.DefaultReembedBatchSize
+	if len(os.Args) > 2 {
+		n, err := strconv.Atoi(os.Args[2])
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid batch size %q", os.Args[2])
+		}
+		batchSize = n
+	}
+
+	embedder, err := embeddings.NewEmbedderFromConfig(cfg, os.Args[1])
+	if err != nil {
+		log.Fatalf("Failed to create embedder: %v", err)
+	}
+
+	// Safe to re-run after an interruption: already re-embedded chunks are skipped
+	if err := store.Reembed(ctx, embedder, batchSize); err != nil {
+		log.Fatalf("Re-embedding failed: %v", err)
+	}
+
+	fmt.Println("✅ Re-embedding completed successfully")
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"intelligent-doc-assistant/internal/storage"
+)
+
+func main() {
+	store := storage.NewStore()
+	if store == nil {
+		log.Fatal("Failed to initialize store")
+	}
+
+	// Builds the index configured by VECTOR_INDEX and its parameters, then swaps it in
+	if err := store.Reindex(context.Background()); err != nil {
+		log.Fatalf("Reindexing failed: %v", err)
+	}
+
+	fmt.Println("✅ Embedding index rebuilt successfully")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"intelligent-doc-assistant/internal/snapshot"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatalf("Usage: %s export <file> | import <file>", os.Args[0])
+	}
+	path := os.Args[2]
+
+	store := storage.NewStore()
+	if store == nil {
+		log.Fatal("Failed to initialize store")
+	}
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "export":
+		// Write next to the destination and rename so a failed export never leaves a partial archive
+		tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+		if err != nil {
+			log.Fatalf("Failed to create snapshot file: %v", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		manifest, count, err := snapshot.Export(ctx, store, tmp)
+		if err == nil {
+			err = tmp.Close()
+		}
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			log.Fatalf("Failed to write snapshot: %v", err)
+		}
+		fmt.Printf("✅ Exported %d chunks (%s, %d dimensions) to %s\n", count, manifest.EmbeddingModel, manifest.Dimension, path)
+
+	case "import":
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open snapshot: %v", err)
+		}
+		defer f.Close()
+
+		manifest, count, err := snapshot.Import(ctx, store, f)
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		fmt.Printf("✅ Imported %d chunks (%s, %d dimensions) from %s\n", count, manifest.EmbeddingModel, manifest.Dimension, path)
+
+	default:
+		log.Fatalf("Unknown command %q; expected export or import", os.Args[1])
+	}
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 
 	"github.com/joho/godotenv"
@@ -15,8 +17,94 @@ type Config struct {
 	DBPassword string
 	DBName     string
 
+	// Apply pending schema migrations on startup
+	AutoMigrate bool
+
 	// Gemini API configuration
-	GeminiAPIKey string
+	GeminiAPIKey   string
+	EmbeddingModel string
+
+	// Embedding rate limiting per provider (requests per second, 0 disables)
+	GeminiEmbedRateLimit float64
+	GeminiEmbedBurst     int
+
+	// Embedding cache configuration (backend: none, memory, disk or redis)
+	EmbeddingCache     string
+	EmbeddingCacheSize int
+	EmbeddingCacheDir  string
+
+	// Vector index type (hnsw or ivfflat), build parameters and default scan settings
+	VectorIndex        string
+	HNSWM              int
+	HNSWEFConstruction int
+	HNSWEFSearch       int
+	IVFFlatLists       int
+	IVFFlatProbes      int
+
+	// Chat model provider (gemini, openai or ollama), model name (empty for the provider default)
+	// and default answer generation parameters
+	LLMProvider    string
+	LLMModel       string
+	LLMTemperature float64
+	LLMTopP        float64
+	LLMTopK        int
+	LLMMaxTokens   int
+	// Times an answer cut off at LLMMaxTokens is continued (0 disables continuation)
+	LLMMaxContinuations int
+
+	// Gemini safety thresholds, as category=threshold pairs or one threshold for all
+	// categories (empty for Gemini's defaults)
+	GeminiSafetySettings string
+
+	// OpenAI-compatible API endpoint and key, and the Ollama server URL
+	OpenAIBaseURL string
+	OpenAIAPIKey  string
+	OllamaURL     string
+
+	// LLM query rewriting before retrieval and the number of reformulations requested
+	QueryRewrite      bool
+	QueryRewriteCount int
+
+	// Answer prompt template file (empty for the built-in template) and code context token budget
+	PromptTemplate    string
+	PromptTokenBudget int
+
+	// Search result reranking (none, lexical or llm) and how many candidates are reranked
+	Reranker         string
+	RerankCandidates int
+
+	// Conversation session storage (none, memory or database), how long idle sessions are kept
+	// and how many earlier messages are sent with a follow-up question
+	SessionStore           string
+	SessionTTLHours        int
+	SessionHistoryMessages int
+
+	// Maximum number of tool calls an agent mode question may make
+	AgentMaxSteps int
+
+	// Answer cache (none or memory), the question similarity needed to reuse an answer,
+	// the maximum number of cached answers and how long they are kept
+	AnswerCache          string
+	AnswerCacheThreshold float64
+	AnswerCacheSize      int
+	AnswerCacheTTLHours  int
+
+	// Usage records (none, memory or database), how long in-memory records are kept, and the
+	// USD prices per million prompt, completion and embedding tokens used to estimate cost
+	UsageStore             string
+	UsageRetentionDays     int
+	PromptPricePerMTok     float64
+	CompletionPricePerMTok float64
+	EmbeddingPricePerMTok  float64
+
+	// Guardrail rule packs applied to indexed code (comma-separated, or none), a JSON file of
+	// custom rules and disabled rules, and the file the audit log of findings is appended to
+	Guardrails        string
+	GuardrailRules    string
+	GuardrailAuditLog string
+
+	// Bearer token required by the /admin endpoints; empty disables them
+	AdminToken string
 
 	// Server configuration
 	ServerPort string
@@ -38,15 +126,62 @@ func GetConfig() *Config {
 		godotenv.Load()
 
 		config = &Config{
-			DBHost:       getEnvOrDefault("DB_HOST", "localhost"),
-			DBPort:       getEnvOrDefault("DB_PORT", "5432"),
-			DBUser:       getEnvOrDefault("DB_USER", "postgres"),
-			DBPassword:   getEnvOrDefault("DB_PASSWORD", ""),
-			DBName:       getEnvOrDefault("DB_NAME", "docassistant"),
-			GeminiAPIKey: os.Getenv("GEMINI_API_KEY"),
-			ServerPort:   getEnvOrDefault("SERVER_PORT", "8080"),
-			RedisHost:    getEnvOrDefault("REDIS_HOST", "localhost"),
-			RedisPort:    getEnvOrDefault("REDIS_PORT", "6379"),
+			DBHost:                 getEnvOrDefault("DB_HOST", "localhost"),
+			DBPort:                 getEnvOrDefault("DB_PORT", "5432"),
+			DBUser:                 getEnvOrDefault("DB_USER", "postgres"),
+			DBPassword:             getEnvOrDefault("DB_PASSWORD", ""),
+			DBName:                 getEnvOrDefault("DB_NAME", "docassistant"),
+			AutoMigrate:            getEnvOrDefault("AUTO_MIGRATE", "true") == "true",
+			GeminiAPIKey:           os.Getenv("GEMINI_API_KEY"),
+			EmbeddingModel:         getEnvOrDefault("EMBEDDING_MODEL", "models/embedding-001"),
+			GeminiEmbedRateLimit:   getEnvFloatOrDefault("GEMINI_EMBED_RATE_LIMIT", 10),
+			GeminiEmbedBurst:       getEnvIntOrDefault("GEMINI_EMBED_BURST", 5),
+			EmbeddingCache:         getEnvOrDefault("EMBEDDING_CACHE", "memory"),
+			EmbeddingCacheSize:     getEnvIntOrDefault("EMBEDDING_CACHE_SIZE", 10000),
+			EmbeddingCacheDir:      getEnvOrDefault("EMBEDDING_CACHE_DIR", filepath.Join(os.TempDir(), "intelligent-doc-assistant", "embeddings")),
+			VectorIndex:            getEnvOrDefault("VECTOR_INDEX", "hnsw"),
+			HNSWM:                  getEnvIntOrDefault("HNSW_M", 16),
+			HNSWEFConstruction:     getEnvIntOrDefault("HNSW_EF_CONSTRUCTION", 64),
+			HNSWEFSearch:           getEnvIntOrDefault("HNSW_EF_SEARCH", 0),
+			IVFFlatLists:           getEnvIntOrDefault("IVFFLAT_LISTS", 0),
+			IVFFlatProbes:          getEnvIntOrDefault("IVFFLAT_PROBES", 0),
+			LLMProvider:            getEnvOrDefault("LLM_PROVIDER", "gemini"),
+			LLMModel:               os.Getenv("LLM_MODEL"),
+			LLMTemperature:         getEnvFloatOrDefault("LLM_TEMPERATURE", 0.3),
+			LLMTopP:                getEnvFloatOrDefault("LLM_TOP_P", 0.8),
+			LLMTopK:                getEnvIntOrDefault("LLM_TOP_K", 40),
+			LLMMaxTokens:           getEnvIntOrDefault("LLM_MAX_TOKENS", 1024),
+			LLMMaxContinuations:    getEnvIntOrDefault("LLM_MAX_CONTINUATIONS", 2),
+			GeminiSafetySettings:   os.Getenv("GEMINI_SAFETY_SETTINGS"),
+			OpenAIBaseURL:          getEnvOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			OpenAIAPIKey:           os.Getenv("OPENAI_API_KEY"),
+			OllamaURL:              getEnvOrDefault("OLLAMA_URL", "http://localhost:11434"),
+			QueryRewrite:           getEnvOrDefault("QUERY_REWRITE", "false") == "true",
+			QueryRewriteCount:      getEnvIntOrDefault("QUERY_REWRITE_COUNT", 3),
+			PromptTemplate:         os.Getenv("PROMPT_TEMPLATE"),
+			PromptTokenBudget:      getEnvIntOrDefault("PROMPT_TOKEN_BUDGET", 6000),
+			Reranker:               getEnvOrDefault("RERANKER", "none"),
+			RerankCandidates:       getEnvIntOrDefault("RERANK_CANDIDATES", 20),
+			SessionStore:           getEnvOrDefault("SESSION_STORE", "memory"),
+			SessionTTLHours:        getEnvIntOrDefault("SESSION_TTL_HOURS", 24),
+			SessionHistoryMessages: getEnvIntOrDefault("SESSION_HISTORY_MESSAGES", 10),
+			AgentMaxSteps:          getEnvIntOrDefault("AGENT_MAX_STEPS", 6),
+			AnswerCache:            getEnvOrDefault("ANSWER_CACHE", "memory"),
+			AnswerCacheThreshold:   getEnvFloatOrDefault("ANSWER_CACHE_THRESHOLD", 0.95),
+			AnswerCacheSize:        getEnvIntOrDefault("ANSWER_CACHE_SIZE", 1000),
+			AnswerCacheTTLHours:    getEnvIntOrDefault("ANSWER_CACHE_TTL_HOURS", 168),
+			UsageStore:             getEnvOrDefault("USAGE_STORE", "memory"),
+			UsageRetentionDays:     getEnvIntOrDefault("USAGE_RETENTION_DAYS", 90),
+			PromptPricePerMTok:     getEnvFloatOrDefault("PROMPT_PRICE_PER_MTOK", 0.10),
+			CompletionPricePerMTok: getEnvFloatOrDefault("COMPLETION_PRICE_PER_MTOK", 0.40),
+			EmbeddingPricePerMTok:  getEnvFloatOrDefault("EMBEDDING_PRICE_PER_MTOK", 0.15),
+			Guardrails:             getEnvOrDefault("GUARDRAILS", "secrets,injection"),
+			GuardrailRules:         os.Getenv("GUARDRAIL_RULES"),
+			GuardrailAuditLog:      os.Getenv("GUARDRAIL_AUDIT_LOG"),
+			AdminToken:             os.Getenv("ADMIN_TOKEN"),
+			ServerPort:             getEnvOrDefault("SERVER_PORT", "8080"),
+			RedisHost:              getEnvOrDefault("REDIS_HOST", "localhost"),
+			RedisPort:              getEnvOrDefault("REDIS_PORT", "6379"),
 		}
 	})
 	return config
@@ -58,3 +193,17 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
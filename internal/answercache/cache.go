@@ -0,0 +1,281 @@
+// Package answercache reuses answers to questions that were asked before. Questions are
+// matched by embedding similarity, so rephrasings of a question hit the same entry, and
+// entries are dropped when code they cite changes.
+package answercache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/llm"
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// ChunkRef identifies a chunk an answer cites and the content it had when the answer was given.
+type ChunkRef struct {
+	Repo     string
+	FilePath string
+	Symbol   string
+	Hash     string
+}
+
+// Entry is a cached answer.
+type Entry struct {
+	// Key holds everything besides the question that the answer depends on, see Key
+	Key       string
+	Question  string
+	Embedding []float32
+	Answer    llm.Answer
+	// Chunks are the chunks the answer cites
+	Chunks    []ChunkRef
+	CreatedAt time.Time
+	lastUsed  time.Time
+}
+
+// Stats counts cache lookups.
+type Stats struct {
+	Entries int `json:"entries"`
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+}
+
+// Cache keeps answers in process memory. Entries expire after the TTL and the least
+// recently used entries are evicted beyond the maximum size.
+type Cache struct {
+	mu         sync.Mutex
+	embedder   embeddings.Embedder
+	threshold  float64
+	maxEntries int
+	ttl        time.Duration
+	entries    []*Entry
+	stats      Stats
+	now        func() time.Time
+}
+
+// New creates a cache that matches questions embedded by embedder whose cosine similarity
+// is at least threshold. A ttl of 0 keeps entries until they are evicted or invalidated.
+func New(embedder embeddings.Embedder, threshold float64, maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		embedder:   embedder,
+		threshold:  threshold,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+// NewFromConfig creates the cache selected by ANSWER_CACHE, embedding with embedder; it
+// returns nil when caching is disabled.
+func NewFromConfig(cfg *config.Config, embedder embeddings.Embedder) (*Cache, error) {
+	switch cfg.AnswerCache {
+	case "none":
+		return nil, nil
+	case "", "memory":
+		if embedder == nil {
+			return nil, fmt.Errorf("answer cache needs an embedder")
+		}
+		return New(embedder, cfg.AnswerCacheThreshold, cfg.AnswerCacheSize, time.Duration(cfg.AnswerCacheTTLHours)*time.Hour), nil
+	default:
+		return nil, fmt.Errorf("unknown answer cache %q", cfg.AnswerCache)
+	}
+}
+
+// Key combines the index version, i.e. the embedding model and dimension of the store, with
+// the request options, so answers are only reused for requests they would be given to
+func Key(store storage.ChunkStore, options string) string {
+	model, dimension := store.EmbeddingInfo()
+	return fmt.Sprintf("%s/%d/%s", model, dimension, options)
+}
+
+// NormalizeQuestion lower-cases question and strips the whitespace and punctuation that do
+// not change its meaning.
+func NormalizeQuestion(question string) string {
+	question = strings.Join(strings.Fields(strings.ToLower(question)), " ")
+	return strings.TrimRight(question, "?!. ")
+}
+
+// Embed returns the unit-length embedding of the normalised question.
+func (c *Cache) Embed(ctx context.Context, question string) ([]float32, error) {
+	vectors, err := c.embedder.CreateEmbeddings(ctx, []string{NormalizeQuestion(question)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("no embedding generated for question")
+	}
+	return normalize(vectors[0]), nil
+}
+
+// Get returns the entry under key whose question is most similar to embedding, if it is at
+// least as similar as the threshold.
+func (c *Cache) Get(key string, embedding []float32) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+	var best *Entry
+	bestScore := c.threshold
+	for _, entry := range c.entries {
+		if entry.Key != key || len(entry.Embedding) != len(embedding) {
+			continue
+		}
+		if score := dot(entry.Embedding, embedding); score >= bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	if best == nil {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	best.lastUsed = c.now()
+	return best, true
+}
+
+// Put caches entry, evicting the least recently used entry when the cache is full.
+func (c *Cache) Put(entry Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.CreatedAt = c.now()
+	entry.lastUsed = entry.CreatedAt
+	c.expire()
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		oldest := 0
+		for i, e := range c.entries {
+			if e.lastUsed.Before(c.entries[oldest].lastUsed) {
+				oldest = i
+			}
+		}
+		c.entries = append(c.entries[:oldest], c.entries[oldest+1:]...)
+	}
+	c.entries = append(c.entries, &entry)
+}
+
+// Remove drops entry from the cache.
+func (c *Cache) Remove(entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(func(e *Entry) bool { return e == entry })
+}
+
+// Invalidate drops the entries citing a chunk whose content differs in chunks, the chunks
+// just ingested, and returns how many were dropped.
+func (c *Cache) Invalidate(chunks []parser.CodeChunk) int {
+	hashes := make(map[ChunkRef]string, len(chunks))
+	for _, chunk := range chunks {
+		ref := RefOf(chunk)
+		hashes[ChunkRef{Repo: ref.Repo, FilePath: ref.FilePath, Symbol: ref.Symbol}] = ref.Hash
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remove(func(entry *Entry) bool {
+		for _, ref := range entry.Chunks {
+			hash, ok := hashes[ChunkRef{Repo: ref.Repo, FilePath: ref.FilePath, Symbol: ref.Symbol}]
+			if ok && hash != ref.Hash {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Verify checks that the chunks entry cites are still stored unchanged, e.g. after an
+// ingestion by another process, and drops the entry when they are not.
+func (c *Cache) Verify(ctx context.Context, store storage.ChunkStore, entry *Entry) (bool, error) {
+	for _, ref := range entry.Chunks {
+		chunks, err := store.FindChunks(ctx, storage.ChunkFilter{Repo: ref.Repo, FilePath: ref.FilePath, Symbol: ref.Symbol})
+		if err != nil {
+			return false, err
+		}
+		current := false
+		for _, chunk := range chunks {
+			if RefOf(chunk) == ref {
+				current = true
+				break
+			}
+		}
+		if !current {
+			c.Remove(entry)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Stats returns the number of entries and lookups so far.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// RefOf identifies chunk and hashes its content.
+func RefOf(chunk parser.CodeChunk) ChunkRef {
+	symbol := chunk.Symbol
+	if symbol == "" {
+		symbol = chunk.Name
+	}
+	sum := sha256.Sum256([]byte(chunk.Content))
+	return ChunkRef{Repo: chunk.Repo, FilePath: chunk.FilePath, Symbol: symbol, Hash: hex.EncodeToString(sum[:16])}
+}
+
+// expire drops entries older than the TTL; the caller must hold c.mu
+func (c *Cache) expire() {
+	if c.ttl <= 0 {
+		return
+	}
+	cutoff := c.now().Add(-c.ttl)
+	c.remove(func(entry *Entry) bool { return entry.CreatedAt.Before(cutoff) })
+}
+
+// remove drops the entries matching drop and returns how many there were; the caller must hold c.mu
+func (c *Cache) remove(drop func(*Entry) bool) int {
+	kept := c.entries[:0]
+	for _, entry := range c.entries {
+		if !drop(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(c.entries) - len(kept)
+	for i := len(kept); i < len(c.entries); i++ {
+		c.entries[i] = nil
+	}
+	c.entries = kept
+	return removed
+}
+
+func normalize(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	normalized := make([]float32, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / math.Sqrt(norm))
+	}
+	return normalized
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,121 @@
+package answercache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"intelligent-doc-assistant/internal/fake"
+	"intelligent-doc-assistant/internal/llm"
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var total = parser.CodeChunk{Repo: "shop", FilePath: "cart.go", Symbol: "shop.(*Cart).Total", Name: "Total", Content: "func (c *Cart) Total() int { return 0 }"}
+
+func TestNormalizeQuestion(t *testing.T) {
+	assert.Equal(t, "how is the cart total computed", NormalizeQuestion("  How is the cart\n total computed?? "))
+}
+
+func TestCacheGet(t *testing.T) {
+	ctx := context.Background()
+	cache := New(fake.NewEmbedder(fake.DefaultDimension), 0.9, 10, 0)
+
+	embedding, err := cache.Embed(ctx, "How is the cart total computed?")
+	require.NoError(t, err)
+	cache.Put(Entry{Key: "v1", Question: "How is the cart total computed?", Embedding: embedding, Answer: llm.Answer{Text: "It sums the items."}})
+
+	tests := []struct {
+		name     string
+		key      string
+		question string
+		wantHit  bool
+	}{
+		{"same question", "v1", "How is the cart total computed?", true},
+		{"normalised", "v1", "how is the cart total computed", true},
+		{"other key", "v2", "How is the cart total computed?", false},
+		{"other question", "v1", "Where are discounts stored?", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedding, err := cache.Embed(ctx, tt.question)
+			require.NoError(t, err)
+
+			entry, ok := cache.Get(tt.key, embedding)
+			assert.Equal(t, tt.wantHit, ok)
+			if tt.wantHit {
+				assert.Equal(t, "It sums the items.", entry.Answer.Text)
+			}
+		})
+	}
+	assert.Equal(t, Stats{Entries: 1, Hits: 2, Misses: 2}, cache.Stats())
+}
+
+func TestCacheEvictionAndExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New(fake.NewEmbedder(fake.DefaultDimension), 0.9, 2, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	put := func(question string, vector []float32) {
+		cache.Put(Entry{Key: "v1", Question: question, Embedding: vector})
+		now = now.Add(time.Minute)
+	}
+	put("a", []float32{1, 0, 0})
+	put("b", []float32{0, 1, 0})
+	_, ok := cache.Get("v1", []float32{1, 0, 0})
+	require.True(t, ok)
+
+	// b is the least recently used
+	put("c", []float32{0, 0, 1})
+	_, ok = cache.Get("v1", []float32{0, 1, 0})
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Stats().Entries)
+
+	now = now.Add(time.Hour)
+	_, ok = cache.Get("v1", []float32{0, 0, 1})
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache := New(fake.NewEmbedder(fake.DefaultDimension), 0.9, 10, 0)
+	cache.Put(Entry{Key: "v1", Question: "total", Embedding: []float32{1, 0}, Chunks: []ChunkRef{RefOf(total)}})
+
+	// Re-ingesting unchanged code keeps the entry
+	unrelated := parser.CodeChunk{Repo: "shop", FilePath: "discount.go", Symbol: "shop.Discount.Apply"}
+	assert.Equal(t, 0, cache.Invalidate([]parser.CodeChunk{total, unrelated}))
+
+	changed := total
+	changed.Content = "func (c *Cart) Total() int { return 1 }"
+	assert.Equal(t, 1, cache.Invalidate([]parser.CodeChunk{changed}))
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestCacheVerify(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore(fake.NewEmbedder(fake.DefaultDimension))
+	require.NoError(t, store.StoreChunks(ctx, []parser.CodeChunk{total}))
+
+	cache := New(fake.NewEmbedder(fake.DefaultDimension), 0.9, 10, 0)
+	cache.Put(Entry{Key: "v1", Question: "total", Embedding: []float32{1, 0}, Chunks: []ChunkRef{RefOf(total)}})
+	entry, ok := cache.Get("v1", []float32{1, 0})
+	require.True(t, ok)
+
+	current, err := cache.Verify(ctx, store, entry)
+	assert.NoError(t, err)
+	assert.True(t, current)
+
+	// Another process re-ingests the file with changed code
+	changed := total
+	changed.Content = "func (c *Cart) Total() int { return 1 }"
+	require.NoError(t, store.StoreChunks(ctx, []parser.CodeChunk{changed}))
+
+	current, err = cache.Verify(ctx, store, entry)
+	assert.NoError(t, err)
+	assert.False(t, current)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
@@ -0,0 +1,287 @@
+package embeddings
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"intelligent-doc-assistant/config"
+)
+
+// Embedder generates vector embeddings for text.
+type Embedder interface {
+	CreateEmbeddings(ctx context.Context, input []string) ([][]float32, error)
+	Model() string
+}
+
+// Cache stores embeddings under a content-addressed key.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]float32, bool, error)
+	Set(ctx context.Context, key string, embedding []float32) error
+}
+
+// CacheStats reports how often the cache answered a lookup.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CachedEmbedder serves embeddings from a Cache and only calls the wrapped
+// Embedder for texts it has not seen before with the same model.
+type CachedEmbedder struct {
+	embedder Embedder
+	cache    Cache
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+// NewCachedEmbedder wraps embedder with cache. A nil cache returns embedder unchanged.
+func NewCachedEmbedder(embedder Embedder, cache Cache) Embedder {
+	if cache == nil {
+		return embedder
+	}
+	return &CachedEmbedder{embedder: embedder, cache: cache}
+}
+
+// Model returns the model of the wrapped embedder.
+func (c *CachedEmbedder) Model() string {
+	return c.embedder.Model()
+}
+
+// Stats returns the hit and miss counters accumulated so far.
+func (c *CachedEmbedder) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// CreateEmbeddings returns cached embeddings where available and embeds the rest in one call.
+// Cache failures are logged and treated as misses so they never fail an ingest.
+func (c *CachedEmbedder) CreateEmbeddings(ctx context.Context, input []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(input))
+	keys := make([]string, len(input))
+
+	var (
+		missing []string
+		indices []int
+	)
+	for i, text := range input {
+		keys[i] = CacheKey(c.Model(), text)
+		embedding, ok, err := c.cache.Get(ctx, keys[i])
+		if err != nil {
+			fmt.Printf("Embedding cache lookup failed: %v\n", err)
+		}
+		if ok {
+			c.hits.Add(1)
+			embeddings[i] = embedding
+			continue
+		}
+		c.misses.Add(1)
+		missing = append(missing, text)
+		indices = append(indices, i)
+	}
+
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := c.embedder.CreateEmbeddings(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(computed) != len(missing) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(missing), len(computed))
+	}
+
+	for j, i := range indices {
+		embeddings[i] = computed[j]
+		if err := c.cache.Set(ctx, keys[i], computed[j]); err != nil {
+			fmt.Printf("Embedding cache store failed: %v\n", err)
+		}
+	}
+	return embeddings, nil
+}
+
+// CacheKey returns the content-addressed key for text embedded with model.
+func CacheKey(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewEmbedderFromConfig creates a rate-limited, metered Gemini embedder for model, fronted by
+// the configured cache.
+func NewEmbedderFromConfig(cfg *config.Config, model string) (Embedder, error) {
+	client, err := NewGeminiClientWithModel(cfg.GeminiAPIKey, model,
+		WithRateLimit(cfg.GeminiEmbedRateLimit, cfg.GeminiEmbedBurst))
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := NewCacheFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachedEmbedder(NewMeteredEmbedder(client), cache), nil
+}
+
+// NewCacheFromConfig builds the cache backend selected by EMBEDDING_CACHE.
+// It returns a nil Cache when caching is disabled.
+func NewCacheFromConfig(cfg *config.Config) (Cache, error) {
+	switch cfg.EmbeddingCache {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		return NewLRUCache(cfg.EmbeddingCacheSize), nil
+	case "disk":
+		return NewDiskCache(cfg.EmbeddingCacheDir)
+	case "redis":
+		return NewRedisCache(fmt.Sprintf("%s:%s", cfg.RedisHost, cfg.RedisPort))
+	default:
+		return nil, fmt.Errorf("unknown embedding cache backend %q", cfg.EmbeddingCache)
+	}
+}
+
+// LRUCache is an in-memory cache that evicts the least recently used entry when full.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key       string
+	embedding []float32
+}
+
+// NewLRUCache creates an in-memory cache holding at most capacity embeddings.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]float32, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	// Callers own the returned vector, e.g. to normalise it, so the cached one is copied
+	return append([]float32(nil), elem.Value.(*lruEntry).embedding...), true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, embedding []float32) error {
+	embedding = append([]float32(nil), embedding...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruEntry).embedding = embedding
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, embedding: embedding})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// DiskCache stores one file per embedding under a directory, sharded by key prefix.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a cache rooted at dir, creating the directory if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *DiskCache) Get(ctx context.Context, key string) ([]float32, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	embedding, err := decodeEmbedding(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return embedding, true, nil
+}
+
+func (c *DiskCache) Set(ctx context.Context, key string, embedding []float32) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write to a temporary file and rename so readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	if _, err := tmp.Write(encodeEmbedding(embedding)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
+
+// encodeEmbedding serialises an embedding as little-endian float32 values
+func encodeEmbedding(embedding []float32) []byte {
+	buf := make([]byte, len(embedding)*4)
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeEmbedding(data []byte) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("corrupt cache entry of %d bytes", len(data))
+	}
+	embedding := make([]float32, len(data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return embedding, nil
+}
@@ -0,0 +1,50 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces embedding entries in a shared Redis instance
+const redisKeyPrefix = "embedding:"
+
+// RedisCache stores embeddings in Redis so they are shared between processes.
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache connects to the Redis server at addr.
+func NewRedisCache(addr string) (*RedisCache, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", addr, err)
+	}
+	return &RedisCache{client: client}, nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]float32, bool, error) {
+	data, err := c.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	embedding, err := decodeEmbedding(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return embedding, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, embedding []float32) error {
+	// Entries are content-addressed, so they never go stale and need no expiry
+	if err := c.client.Set(ctx, redisKeyPrefix+key, encodeEmbedding(embedding), 0).Err(); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
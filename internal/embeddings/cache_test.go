@@ -0,0 +1,122 @@
+package embeddings
+
+import (
+	"context"
+	"testing"
+
+	"intelligent-doc-assistant/internal/usage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockEmbedder is a mock implementation of Embedder
+type MockEmbedder struct {
+	mock.Mock
+}
+
+func (m *MockEmbedder) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	args := m.Called(ctx, texts)
+	return args.Get(0).([][]float32), args.Error(1)
+}
+
+func (m *MockEmbedder) Model() string {
+	return "test-model"
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	mockEmbedder := new(MockEmbedder)
+	mockEmbedder.On("CreateEmbeddings", mock.Anything, []string{"a", "b"}).
+		Return([][]float32{{1}, {2}}, nil).Once()
+	mockEmbedder.On("CreateEmbeddings", mock.Anything, []string{"c"}).
+		Return([][]float32{{3}}, nil).Once()
+
+	embedder := NewCachedEmbedder(mockEmbedder, NewLRUCache(10)).(*CachedEmbedder)
+	ctx := context.Background()
+
+	got, err := embedder.CreateEmbeddings(ctx, []string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{1}, {2}}, got)
+
+	// Only the unseen text reaches the wrapped embedder, and order is preserved
+	got, err = embedder.CreateEmbeddings(ctx, []string{"b", "c", "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{2}, {3}, {1}}, got)
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 3}, embedder.Stats())
+	mockEmbedder.AssertExpectations(t)
+}
+
+func TestMeteredEmbedderBehindCache(t *testing.T) {
+	mockEmbedder := new(MockEmbedder)
+	mockEmbedder.On("CreateEmbeddings", mock.Anything, []string{"abcd", "efghij"}).
+		Return([][]float32{{1}, {2}}, nil).Once()
+
+	embedder := NewCachedEmbedder(NewMeteredEmbedder(mockEmbedder), NewLRUCache(10))
+	meter := usage.NewMeter(usage.Prices{})
+	ctx := usage.WithMeter(context.Background(), meter)
+
+	_, err := embedder.CreateEmbeddings(ctx, []string{"abcd", "efghij"})
+	assert.NoError(t, err)
+	// Cache hits cost nothing, so they are not metered
+	_, err = embedder.CreateEmbeddings(ctx, []string{"efghij"})
+	assert.NoError(t, err)
+
+	totals := meter.Totals()
+	assert.Equal(t, 1, totals.EmbeddingCalls)
+	assert.Equal(t, 10, totals.EmbeddingChars)
+	assert.Equal(t, 3, totals.EmbeddingTokens)
+	mockEmbedder.AssertExpectations(t)
+}
+
+func TestCacheKeyIncludesModel(t *testing.T) {
+	assert.Equal(t, CacheKey("m1", "text"), CacheKey("m1", "text"))
+	assert.NotEqual(t, CacheKey("m1", "text"), CacheKey("m2", "text"))
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache(2)
+	ctx := context.Background()
+
+	cache.Set(ctx, "a", []float32{1})
+	cache.Set(ctx, "b", []float32{2})
+	cache.Get(ctx, "a") // a is now most recently used
+	cache.Set(ctx, "c", []float32{3})
+
+	_, ok, _ := cache.Get(ctx, "b")
+	assert.False(t, ok)
+	got, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []float32{1}, got)
+}
+
+func TestLRUCacheCopies(t *testing.T) {
+	cache := NewLRUCache(2)
+	ctx := context.Background()
+
+	embedding := []float32{3, 4}
+	cache.Set(ctx, "a", embedding)
+	embedding[0] = 0
+	got, _, _ := cache.Get(ctx, "a")
+	got[1] = 0
+
+	got, _, _ = cache.Get(ctx, "a")
+	assert.Equal(t, []float32{3, 4}, got)
+}
+
+func TestDiskCache(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	key := CacheKey("test-model", "text")
+
+	_, ok, err := cache.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, cache.Set(ctx, key, []float32{0.5, -1.25}))
+	got, ok, err := cache.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []float32{0.5, -1.25}, got)
+}
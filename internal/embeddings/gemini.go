@@ -6,36 +6,117 @@ import (
 
 	genai "cloud.google.com/go/ai/generativelanguage/apiv1"
 	pb "cloud.google.com/go/ai/generativelanguage/apiv1/generativelanguagepb"
+	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/time/rate"
 	"google.golang.org/api/option"
 )
 
+// DefaultModel is the embedding model used when none is configured.
+const DefaultModel = "models/embedding-001"
+
+// MaxBatchSize is the maximum number of texts Gemini accepts in one batch embedding request.
+const MaxBatchSize = 100
+
+// embedAPI is the subset of the Gemini client used for embeddings.
+type embedAPI interface {
+	BatchEmbedContents(ctx context.Context, req *pb.BatchEmbedContentsRequest, opts ...gax.CallOption) (*pb.BatchEmbedContentsResponse, error)
+	Close() error
+}
+
+// newEmbedAPI creates the underlying Gemini client; replaced in tests.
+var newEmbedAPI = func(ctx context.Context, apiKey string) (embedAPI, error) {
+	return genai.NewGenerativeClient(ctx, option.WithAPIKey(apiKey))
+}
+
 // GeminiClient handles communication with Gemini's embedding API.
 type GeminiClient struct {
-	client *genai.GenerativeClient
-	model  string
+	client  embedAPI
+	model   string
+	retry   RetryPolicy
+	limiter *rate.Limiter
+}
+
+// Option configures a GeminiClient.
+type Option func(*GeminiClient)
+
+// WithRetryPolicy overrides the backoff used for transient API failures.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *GeminiClient) {
+		c.retry = p
+	}
+}
+
+// WithRateLimit caps outgoing requests with a token bucket; a non-positive rate disables limiting.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(c *GeminiClient) {
+		c.limiter = newLimiter(requestsPerSecond, burst)
+	}
+}
+
+// NewGeminiClient initializes a new GeminiClient using the default model.
+func NewGeminiClient(apiKey string, opts ...Option) (*GeminiClient, error) {
+	return NewGeminiClientWithModel(apiKey, DefaultModel, opts...)
 }
 
-// NewGeminiClient initializes a new GeminiClient.
-func NewGeminiClient(apiKey string) (*GeminiClient, error) {
+// NewGeminiClientWithModel initializes a new GeminiClient for the given embedding model.
+func NewGeminiClientWithModel(apiKey, model string, opts ...Option) (*GeminiClient, error) {
 	ctx := context.Background()
-	client, err := genai.NewGenerativeClient(ctx, option.WithAPIKey(apiKey))
+	client, err := newEmbedAPI(ctx, apiKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 
-	return &GeminiClient{
-		client: client,
-		model:  "models/embedding-001",
-	}, nil
+	c := &GeminiClient{
+		client:  client,
+		model:   model,
+		retry:   DefaultRetryPolicy,
+		limiter: newLimiter(0, 0),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
-// CreateEmbeddings generates embeddings for the given input text.
-func (c *GeminiClient) CreateEmbeddings(input []string) ([][]float32, error) {
-	ctx := context.Background()
-	var embeddings [][]float32
+// Model returns the name of the embedding model used by the client.
+func (c *GeminiClient) Model() string {
+	return c.model
+}
+
+// Close releases the underlying API connection.
+func (c *GeminiClient) Close() error {
+	return c.client.Close()
+}
+
+// CreateEmbeddings generates embeddings for the given input text, sending up to
+// MaxBatchSize texts per request. Transient failures are retried with backoff and
+// requests are paced by the client's rate limiter; both respect ctx cancellation.
+func (c *GeminiClient) CreateEmbeddings(ctx context.Context, input []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(input))
 
-	for _, text := range input {
-		request := &pb.EmbedContentRequest{
+	for start := 0; start < len(input); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(input) {
+			end = len(input)
+		}
+
+		batch, err := c.embedBatch(ctx, input[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+
+	return embeddings, nil
+}
+
+func (c *GeminiClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	request := &pb.BatchEmbedContentsRequest{
+		Model:    c.model,
+		Requests: make([]*pb.EmbedContentRequest, len(texts)),
+	}
+	for i, text := range texts {
+		request.Requests[i] = &pb.EmbedContentRequest{
 			Model: c.model,
 			Content: &pb.Content{
 				Parts: []*pb.Part{
@@ -43,36 +124,44 @@ func (c *GeminiClient) CreateEmbeddings(input []string) ([][]float32, error) {
 				},
 			},
 		}
-		response, err := c.client.EmbedContent(ctx, request)
-		if err != nil {
-			return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+
+	var response *pb.BatchEmbedContentsResponse
+	err := c.retry.do(ctx, func(ctx context.Context) error {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
 		}
-		embeddings = append(embeddings, response.GetEmbedding().GetValues())
+		var err error
+		response, err = c.client.BatchEmbedContents(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+
+	if len(response.GetEmbeddings()) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.GetEmbeddings()))
 	}
 
+	embeddings := make([][]float32, len(texts))
+	for i, embedding := range response.GetEmbeddings() {
+		embeddings[i] = embedding.GetValues()
+	}
 	return embeddings, nil
 }
 
 // GetEmbedding generates an embedding for a single text
 func GetEmbedding(ctx context.Context, text string, apiKey string) ([]float32, error) {
-	client, err := genai.NewGenerativeClient(ctx, option.WithAPIKey(apiKey))
+	client, err := NewGeminiClient(apiKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+		return nil, err
 	}
 	defer client.Close()
 
-	request := &pb.EmbedContentRequest{
-		Model: "models/embedding-001",
-		Content: &pb.Content{
-			Parts: []*pb.Part{
-				{Data: &pb.Part_Text{Text: text}},
-			},
-		},
-	}
-	response, err := client.EmbedContent(ctx, request)
+	embeddings, err := client.CreateEmbeddings(ctx, []string{text})
 	if err != nil {
-		return nil, fmt.Errorf("embedding request failed: %w", err)
+		return nil, err
 	}
 
-	return response.GetEmbedding().GetValues(), nil
+	return embeddings[0], nil
 }
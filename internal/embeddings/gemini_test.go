@@ -3,9 +3,14 @@ package embeddings
 import (
 	"context"
 	"testing"
+	"time"
 
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1/generativelanguagepb"
+	"github.com/googleapis/gax-go/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // MockGeminiAPI mocks the Gemini API client
@@ -13,9 +18,33 @@ type MockGeminiAPI struct {
 	mock.Mock
 }
 
-func (m *MockGeminiAPI) EmbedContent(ctx context.Context, text string) ([]float32, error) {
-	args := m.Called(ctx, text)
-	return args.Get(0).([]float32), args.Error(1)
+func (m *MockGeminiAPI) BatchEmbedContents(ctx context.Context, req *pb.BatchEmbedContentsRequest, opts ...gax.CallOption) (*pb.BatchEmbedContentsResponse, error) {
+	texts := make([]string, len(req.Requests))
+	for i, r := range req.Requests {
+		texts[i] = r.Content.Parts[0].GetText()
+	}
+
+	args := m.Called(ctx, texts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	resp := &pb.BatchEmbedContentsResponse{}
+	for _, values := range args.Get(0).([][]float32) {
+		resp.Embeddings = append(resp.Embeddings, &pb.ContentEmbedding{Values: values})
+	}
+	return resp, args.Error(1)
+}
+
+func (m *MockGeminiAPI) Close() error {
+	return nil
+}
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+	Multiplier:     2,
 }
 
 func TestCreateEmbeddings(t *testing.T) {
@@ -30,10 +59,8 @@ func TestCreateEmbeddings(t *testing.T) {
 			name:  "successful embedding generation",
 			texts: []string{"test code", "another test"},
 			setup: func(m *MockGeminiAPI) {
-				m.On("EmbedContent", mock.Anything, "test code").
-					Return([]float32{0.1, 0.2, 0.3}, nil)
-				m.On("EmbedContent", mock.Anything, "another test").
-					Return([]float32{0.4, 0.5, 0.6}, nil)
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code", "another test"}).
+					Return([][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}}, nil)
 			},
 			want: [][]float32{
 				{0.1, 0.2, 0.3},
@@ -48,6 +75,36 @@ func TestCreateEmbeddings(t *testing.T) {
 			want:    [][]float32{},
 			wantErr: false,
 		},
+		{
+			name:  "retries retryable errors",
+			texts: []string{"test code"},
+			setup: func(m *MockGeminiAPI) {
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code"}).
+					Return(nil, status.Error(codes.ResourceExhausted, "quota")).Once()
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code"}).
+					Return([][]float32{{0.1, 0.2, 0.3}}, nil).Once()
+			},
+			want:    [][]float32{{0.1, 0.2, 0.3}},
+			wantErr: false,
+		},
+		{
+			name:  "does not retry permanent errors",
+			texts: []string{"test code"},
+			setup: func(m *MockGeminiAPI) {
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code"}).
+					Return(nil, status.Error(codes.InvalidArgument, "bad request")).Once()
+			},
+			wantErr: true,
+		},
+		{
+			name:  "gives up after max attempts",
+			texts: []string{"test code"},
+			setup: func(m *MockGeminiAPI) {
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code"}).
+					Return(nil, status.Error(codes.Unavailable, "down")).Times(3)
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -56,10 +113,12 @@ func TestCreateEmbeddings(t *testing.T) {
 			tt.setup(mockAPI)
 
 			client := &GeminiClient{
-				client: mockAPI,
+				client:  mockAPI,
+				retry:   testRetryPolicy,
+				limiter: newLimiter(0, 0),
 			}
 
-			got, err := client.CreateEmbeddings(tt.texts)
+			got, err := client.CreateEmbeddings(context.Background(), tt.texts)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -73,6 +132,41 @@ func TestCreateEmbeddings(t *testing.T) {
 	}
 }
 
+func TestCreateEmbeddingsSplitsBatches(t *testing.T) {
+	mockAPI := new(MockGeminiAPI)
+	texts := make([]string, MaxBatchSize+1)
+	first := make([][]float32, MaxBatchSize)
+	for i := range texts {
+		texts[i] = "text"
+	}
+	for i := range first {
+		first[i] = []float32{1}
+	}
+	mockAPI.On("BatchEmbedContents", mock.Anything, texts[:MaxBatchSize]).Return(first, nil).Once()
+	mockAPI.On("BatchEmbedContents", mock.Anything, texts[MaxBatchSize:]).Return([][]float32{{2}}, nil).Once()
+
+	client := &GeminiClient{client: mockAPI, retry: testRetryPolicy, limiter: newLimiter(0, 0)}
+	got, err := client.CreateEmbeddings(context.Background(), texts)
+
+	assert.NoError(t, err)
+	assert.Len(t, got, MaxBatchSize+1)
+	assert.Equal(t, []float32{2}, got[MaxBatchSize])
+	mockAPI.AssertExpectations(t)
+}
+
+func TestCreateEmbeddingsCancelled(t *testing.T) {
+	mockAPI := new(MockGeminiAPI)
+	client := &GeminiClient{client: mockAPI, retry: testRetryPolicy, limiter: newLimiter(0.001, 1)}
+	client.limiter.Allow() // drain the only token
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.CreateEmbeddings(ctx, []string{"test code"})
+	assert.Error(t, err)
+	mockAPI.AssertNotCalled(t, "BatchEmbedContents", mock.Anything, mock.Anything)
+}
+
 func TestGetEmbedding(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -85,8 +179,8 @@ func TestGetEmbedding(t *testing.T) {
 			name: "successful single embedding",
 			text: "test code",
 			setup: func(m *MockGeminiAPI) {
-				m.On("EmbedContent", mock.Anything, "test code").
-					Return([]float32{0.1, 0.2, 0.3}, nil)
+				m.On("BatchEmbedContents", mock.Anything, []string{"test code"}).
+					Return([][]float32{{0.1, 0.2, 0.3}}, nil)
 			},
 			want:    []float32{0.1, 0.2, 0.3},
 			wantErr: false,
@@ -95,8 +189,8 @@ func TestGetEmbedding(t *testing.T) {
 			name: "empty text",
 			text: "",
 			setup: func(m *MockGeminiAPI) {
-				m.On("EmbedContent", mock.Anything, "").
-					Return([]float32{}, nil)
+				m.On("BatchEmbedContents", mock.Anything, []string{""}).
+					Return([][]float32{{}}, nil)
 			},
 			want:    []float32{},
 			wantErr: false,
@@ -108,6 +202,12 @@ func TestGetEmbedding(t *testing.T) {
 			mockAPI := new(MockGeminiAPI)
 			tt.setup(mockAPI)
 
+			original := newEmbedAPI
+			newEmbedAPI = func(ctx context.Context, apiKey string) (embedAPI, error) {
+				return mockAPI, nil
+			}
+			defer func() { newEmbedAPI = original }()
+
 			ctx := context.Background()
 			got, err := GetEmbedding(ctx, tt.text, "test-api-key")
 
@@ -0,0 +1,33 @@
+package embeddings
+
+import (
+	"context"
+
+	"intelligent-doc-assistant/internal/usage"
+)
+
+// MeteredEmbedder records the input of each embedding call in the usage.Meter of the call's
+// context. Placed behind a cache, it only meters the texts actually sent to the provider.
+type MeteredEmbedder struct {
+	embedder Embedder
+}
+
+// NewMeteredEmbedder wraps embedder so its calls are metered.
+func NewMeteredEmbedder(embedder Embedder) *MeteredEmbedder {
+	return &MeteredEmbedder{embedder: embedder}
+}
+
+// Model returns the model of the wrapped embedder.
+func (m *MeteredEmbedder) Model() string {
+	return m.embedder.Model()
+}
+
+// CreateEmbeddings embeds input with the wrapped embedder and meters the call.
+func (m *MeteredEmbedder) CreateEmbeddings(ctx context.Context, input []string) ([][]float32, error) {
+	embeddings, err := m.embedder.CreateEmbeddings(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	usage.FromContext(ctx).AddEmbedding(input)
+	return embeddings, nil
+}
@@ -0,0 +1,270 @@
+// Package fake provides deterministic stand-ins for the chat model and embedder, so the
+// API can be exercised end to end without calling an LLM provider.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"intelligent-doc-assistant/internal/llm"
+)
+
+// Exchange is one request to a chat model and its reply, as recorded in a transcript.
+type Exchange struct {
+	Prompt    string               `json:"prompt"`
+	Params    llm.GenerationParams `json:"params"`
+	Reply     string               `json:"reply"`
+	ToolCalls []llm.ToolCall       `json:"toolCalls,omitempty"`
+	// FinishReason is set for replies the model did not finish, e.g. llm.FinishMaxTokens
+	FinishReason string `json:"finishReason,omitempty"`
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	reply   string
+	calls   []llm.ToolCall
+	finish  string
+}
+
+// ChatModel replies with canned text chosen by the first rule whose pattern matches the
+// last message of the request, or with the default reply. Every exchange is recorded.
+type ChatModel struct {
+	mu           sync.Mutex
+	rules        []rule
+	defaultReply string
+	hasDefault   bool
+	transcript   []Exchange
+}
+
+// NewChatModel creates a chat model with no rules; requests fail until rules are added.
+func NewChatModel() *ChatModel {
+	return &ChatModel{}
+}
+
+// On replies with reply to prompts matching the regular expression pattern. Rules are
+// tried in the order they were added.
+func (m *ChatModel) On(pattern, reply string) *ChatModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule{pattern: regexp.MustCompile(pattern), reply: reply})
+	return m
+}
+
+// OnCall replies to prompts matching pattern by calling tools. In agent mode the prompt is
+// the question at first and then the result of the last tool call.
+func (m *ChatModel) OnCall(pattern string, calls ...llm.ToolCall) *ChatModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule{pattern: regexp.MustCompile(pattern), calls: calls})
+	return m
+}
+
+// OnUnfinished replies to prompts matching pattern with reply, reported as stopped for
+// reason, e.g. llm.FinishMaxTokens or llm.FinishSafety.
+func (m *ChatModel) OnUnfinished(pattern, reply, reason string) *ChatModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule{pattern: regexp.MustCompile(pattern), reply: reply, finish: reason})
+	return m
+}
+
+// Default replies with reply to prompts that match no rule.
+func (m *ChatModel) Default(reply string) *ChatModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaultReply, m.hasDefault = reply, true
+	return m
+}
+
+// Transcript returns the exchanges so far, oldest first.
+func (m *ChatModel) Transcript() []Exchange {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Exchange(nil), m.transcript...)
+}
+
+func (m *ChatModel) Generate(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prompt := lastMessage(req)
+	rule, ok := m.reply(prompt, len(req.Tools) > 0)
+	if !ok {
+		return llm.ChatResponse{}, fmt.Errorf("fake chat model has no reply for prompt: %.200q", prompt)
+	}
+	exchange := Exchange{Prompt: prompt, Params: req.Params, Reply: rule.reply, ToolCalls: rule.calls, FinishReason: rule.finish}
+	m.transcript = append(m.transcript, exchange)
+	return response(exchange), nil
+}
+
+func (m *ChatModel) Stream(ctx context.Context, req llm.ChatRequest, onToken func(string) error) (llm.ChatResponse, error) {
+	resp, err := m.Generate(ctx, req)
+	if err != nil {
+		return llm.ChatResponse{}, err
+	}
+	return resp, streamWords(ctx, resp.Text, onToken)
+}
+
+// reply picks the rule for prompt, skipping tool calls when no tools were offered; the
+// caller must hold m.mu
+func (m *ChatModel) reply(prompt string, tools bool) (rule, bool) {
+	for _, rule := range m.rules {
+		if len(rule.calls) > 0 && !tools {
+			continue
+		}
+		if rule.pattern.MatchString(prompt) {
+			return rule, true
+		}
+	}
+	return rule{reply: m.defaultReply}, m.hasDefault
+}
+
+// ReplayChatModel replays a recorded transcript: each request must match the next recorded
+// prompt exactly, and gets the recorded reply.
+type ReplayChatModel struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+}
+
+// NewReplayChatModel replays exchanges in order.
+func NewReplayChatModel(exchanges []Exchange) *ReplayChatModel {
+	return &ReplayChatModel{exchanges: exchanges}
+}
+
+// LoadTranscript reads a transcript written by SaveTranscript.
+func LoadTranscript(path string) ([]Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	var exchanges []Exchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("failed to parse transcript %s: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// SaveTranscript writes exchanges as indented JSON, e.g. to record a session with a real model.
+func SaveTranscript(path string, exchanges []Exchange) error {
+	data, err := json.MarshalIndent(exchanges, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// Remaining returns how many recorded exchanges have not been replayed.
+func (m *ReplayChatModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.exchanges) - m.next
+}
+
+func (m *ReplayChatModel) Generate(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prompt := lastMessage(req)
+	if m.next >= len(m.exchanges) {
+		return llm.ChatResponse{}, fmt.Errorf("transcript exhausted after %d exchanges, got prompt: %.200q", len(m.exchanges), prompt)
+	}
+	exchange := m.exchanges[m.next]
+	if exchange.Prompt != prompt {
+		return llm.ChatResponse{}, fmt.Errorf("transcript mismatch at exchange %d: expected prompt %.200q, got %.200q", m.next+1, exchange.Prompt, prompt)
+	}
+	m.next++
+	return response(exchange), nil
+}
+
+func (m *ReplayChatModel) Stream(ctx context.Context, req llm.ChatRequest, onToken func(string) error) (llm.ChatResponse, error) {
+	resp, err := m.Generate(ctx, req)
+	if err != nil {
+		return llm.ChatResponse{}, err
+	}
+	return resp, streamWords(ctx, resp.Text, onToken)
+}
+
+// Recorder wraps a chat model and records its exchanges, for producing transcripts to replay.
+type Recorder struct {
+	Model llm.ChatModel
+
+	mu         sync.Mutex
+	transcript []Exchange
+}
+
+// Transcript returns the exchanges recorded so far.
+func (r *Recorder) Transcript() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Exchange(nil), r.transcript...)
+}
+
+func (r *Recorder) Generate(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	resp, err := r.Model.Generate(ctx, req)
+	if err == nil {
+		r.record(req, resp)
+	}
+	return resp, err
+}
+
+func (r *Recorder) Stream(ctx context.Context, req llm.ChatRequest, onToken func(string) error) (llm.ChatResponse, error) {
+	resp, err := r.Model.Stream(ctx, req, onToken)
+	if err == nil {
+		r.record(req, resp)
+	}
+	return resp, err
+}
+
+func (r *Recorder) record(req llm.ChatRequest, resp llm.ChatResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transcript = append(r.transcript, Exchange{Prompt: lastMessage(req), Params: req.Params, Reply: resp.Text, ToolCalls: resp.ToolCalls, FinishReason: resp.FinishReason})
+}
+
+// lastMessage returns the content of the final message of req, which holds the prompt
+func lastMessage(req llm.ChatRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	return req.Messages[len(req.Messages)-1].Content
+}
+
+// response builds the reply to exchange with usage counted in words, so it is deterministic
+func response(exchange Exchange) llm.ChatResponse {
+	promptTokens, replyTokens := len(strings.Fields(exchange.Prompt)), len(strings.Fields(exchange.Reply))
+	return llm.ChatResponse{
+		Text:         exchange.Reply,
+		ToolCalls:    exchange.ToolCalls,
+		FinishReason: exchange.FinishReason,
+		Usage: llm.Usage{
+			PromptTokens:    promptTokens,
+			CandidateTokens: replyTokens,
+			TotalTokens:     promptTokens + replyTokens,
+		},
+	}
+}
+
+// streamWords passes text to onToken a word at a time, keeping the spaces
+func streamWords(ctx context.Context, text string, onToken func(string) error) error {
+	for _, word := range strings.SplitAfter(text, " ") {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if word == "" {
+			continue
+		}
+		if err := onToken(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package fake
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// DefaultDimension is the size of the vectors Embedder produces.
+const DefaultDimension = 64
+
+// Embedder embeds text deterministically by hashing its search terms into a fixed number of
+// dimensions, so texts sharing identifiers and words end up close together. Specific texts
+// can be pinned to chosen vectors with Set.
+type Embedder struct {
+	mu        sync.Mutex
+	dimension int
+	vectors   map[string][]float32
+	calls     int
+}
+
+// NewEmbedder creates an embedder producing vectors of dimension dimensions.
+func NewEmbedder(dimension int) *Embedder {
+	return &Embedder{dimension: dimension, vectors: make(map[string][]float32)}
+}
+
+// Set makes text embed to vector.
+func (e *Embedder) Set(text string, vector []float32) *Embedder {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vectors[text] = vector
+	return e
+}
+
+// Calls returns how many CreateEmbeddings calls were made.
+func (e *Embedder) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func (e *Embedder) Model() string {
+	return "fake-embedding"
+}
+
+func (e *Embedder) CreateEmbeddings(ctx context.Context, input []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls++
+	embeddings := make([][]float32, len(input))
+	for i, text := range input {
+		if vector, ok := e.vectors[text]; ok {
+			embeddings[i] = vector
+			continue
+		}
+		embeddings[i] = e.hash(text)
+	}
+	return embeddings, nil
+}
+
+// hash sums a signed unit per search term in the bucket the term hashes to, then normalizes
+func (e *Embedder) hash(text string) []float32 {
+	vector := make([]float32, e.dimension)
+	for _, term := range storage.QueryTerms(text) {
+		h := fnv.New32a()
+		h.Write([]byte(term))
+		sum := h.Sum32()
+
+		sign := float32(1)
+		if sum&1 == 1 {
+			sign = -1
+		}
+		vector[(sum>>1)%uint32(e.dimension)] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / math.Sqrt(norm))
+	}
+	return vector
+}
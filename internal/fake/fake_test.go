@@ -0,0 +1,102 @@
+package fake
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"intelligent-doc-assistant/internal/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prompt(text string) llm.ChatRequest {
+	return llm.ChatRequest{Messages: []llm.ChatMessage{{Role: llm.RoleUser, Content: text}}}
+}
+
+func TestChatModel(t *testing.T) {
+	ctx := context.Background()
+	model := NewChatModel().
+		On(`Follow-up question`, "Where is ParseFile called?").
+		On(`(?i)parse`, "ParseFile reads a Go file [1].")
+
+	resp, err := model.Generate(ctx, prompt("Question: what does ParseFile do?"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ParseFile reads a Go file [1].", resp.Text)
+	assert.Equal(t, llm.Usage{PromptTokens: 5, CandidateTokens: 6, TotalTokens: 11}, resp.Usage)
+
+	var tokens []string
+	resp, err = model.Stream(ctx, prompt("Follow-up question: and where?"), func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Where ", "is ", "ParseFile ", "called?"}, tokens)
+	assert.Equal(t, "Where is ParseFile called?", resp.Text)
+
+	_, err = model.Generate(ctx, prompt("unrelated"))
+	assert.Error(t, err)
+
+	model.Default("I don't know.")
+	resp, err = model.Generate(ctx, prompt("unrelated"))
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know.", resp.Text)
+	assert.Len(t, model.Transcript(), 3)
+}
+
+func TestChatModelToolCalls(t *testing.T) {
+	ctx := context.Background()
+	search := llm.ToolCall{ID: "call_1", Name: llm.ToolSearchCode, Args: map[string]interface{}{"query": "parse"}}
+	model := NewChatModel().
+		OnCall(`ParseFile`, search).
+		Default("ParseFile reads a Go file.")
+
+	req := prompt("What does ParseFile do?")
+	req.Tools = llm.AgentTools
+	resp, err := model.Generate(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []llm.ToolCall{search}, resp.ToolCalls)
+	assert.Empty(t, resp.Text)
+
+	// Without tools on offer, tool call rules are skipped
+	resp, err = model.Generate(ctx, prompt("What does ParseFile do?"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ParseFile reads a Go file.", resp.Text)
+	assert.Equal(t, []llm.ToolCall{search}, model.Transcript()[0].ToolCalls)
+}
+
+func TestTranscriptReplay(t *testing.T) {
+	ctx := context.Background()
+	recorder := &Recorder{Model: NewChatModel().Default("It parses files.")}
+	_, err := recorder.Generate(ctx, prompt("What does Parse do?"))
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	assert.NoError(t, SaveTranscript(path, recorder.Transcript()))
+	exchanges, err := LoadTranscript(path)
+	assert.NoError(t, err)
+
+	replay := NewReplayChatModel(exchanges)
+	_, err = replay.Generate(ctx, prompt("What does Store do?"))
+	assert.ErrorContains(t, err, "transcript mismatch at exchange 1")
+
+	resp, err := replay.Generate(ctx, prompt("What does Parse do?"))
+	assert.NoError(t, err)
+	assert.Equal(t, "It parses files.", resp.Text)
+	assert.Equal(t, 0, replay.Remaining())
+
+	_, err = replay.Generate(ctx, prompt("What does Parse do?"))
+	assert.ErrorContains(t, err, "transcript exhausted")
+}
+
+func TestEmbedder(t *testing.T) {
+	embedder := NewEmbedder(DefaultDimension).Set("pinned", []float32{1, 0})
+
+	embeddings, err := embedder.CreateEmbeddings(context.Background(), []string{"ParseFile reads files", "ParseFile reads files", "pinned"})
+
+	assert.NoError(t, err)
+	assert.Len(t, embeddings[0], DefaultDimension)
+	assert.Equal(t, embeddings[0], embeddings[1])
+	assert.Equal(t, []float32{1, 0}, embeddings[2])
+	assert.Equal(t, 1, embedder.Calls())
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// DefaultAgentMaxSteps is the number of tool calls an agent may make when none is configured.
+const DefaultAgentMaxSteps = 6
+
+// maxStepOutput bounds the tool output kept in an agent's transcript, in bytes
+const maxStepOutput = 1000
+
+const agentInstructions = `You answer questions about a Go codebase. Use the tools to look up the code you need before answering; do not guess at code you have not seen.
+
+Tools number every function and method they return, e.g. [3]. Cite the code your answer relies on with these numbers in square brackets, e.g. [3] or [1, 3]. Only cite numbers that a tool returned.
+
+If the tools do not turn up the code needed to answer, say so.`
+
+// agentFinalPrompt asks for an answer once the agent has used up its steps
+const agentFinalPrompt = "You have reached the limit of tool calls. Answer the question now from the code you have retrieved, citing it by number."
+
+// AgentStep is one tool call made by an agent, with its (possibly truncated) result.
+type AgentStep struct {
+	Tool   string                 `json:"tool"`
+	Args   map[string]interface{} `json:"args"`
+	Output string                 `json:"output,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// RunAgent answers question by letting the model call tools that look up code in store,
+// within the repository and search settings of opts. The model may make up to maxSteps
+// tool calls before it is asked for its answer. The answer cites the chunks the tools
+// returned, and the steps record every call made. params override the deployment's
+// generation parameters.
+func (c *Client) RunAgent(ctx context.Context, question string, history []session.Message, store storage.ChunkStore, opts storage.SearchOptions, maxSteps int, params GenerationParams) (Answer, []AgentStep, error) {
+	if c.model == nil {
+		return Answer{}, nil, fmt.Errorf("chat model not initialized")
+	}
+	if maxSteps <= 0 {
+		maxSteps = DefaultAgentMaxSteps
+	}
+
+	messages := []ChatMessage{{Role: RoleSystem, Content: agentInstructions}}
+	// Earlier answers cite chunks numbered for their own turn, so the citations are dropped
+	fitted, _ := fitHistory(history, c.promptTokenBudget/historyBudgetDivisor)
+	for _, message := range fitted {
+		role := RoleUser
+		if message.Role == session.RoleAssistant {
+			role = RoleAssistant
+		}
+		messages = append(messages, ChatMessage{Role: role, Content: message.Content})
+	}
+	messages = append(messages, ChatMessage{Role: RoleUser, Content: question})
+
+	tools := newToolbox(store, opts, c.guard)
+	req := ChatRequest{Params: c.params.Merge(params), Tools: AgentTools}
+	var steps []AgentStep
+	var usage Usage
+	for {
+		if len(steps) >= maxSteps && req.Tools != nil {
+			req.Tools = nil
+			messages = append(messages, ChatMessage{Role: RoleUser, Content: agentFinalPrompt})
+		}
+		req.Messages = messages
+
+		resp, err := c.model.Generate(ctx, req)
+		if err != nil {
+			return Answer{}, steps, err
+		}
+		final := len(resp.ToolCalls) == 0 || req.Tools == nil
+		if final {
+			if resp, err = c.complete(ctx, req, resp, nil); err != nil {
+				return Answer{}, steps, err
+			}
+		}
+		usage = usage.Add(resp.Usage)
+
+		if final {
+			answer, err := c.finishAnswer(resp, tools.chunks)
+			if err != nil {
+				return Answer{}, steps, err
+			}
+			answer.Usage = usage
+			return answer, steps, nil
+		}
+
+		messages = append(messages, ChatMessage{Role: RoleAssistant, Content: resp.Text, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			// Every call needs a result, so calls past the limit are answered with an error
+			output, err := "", fmt.Errorf("tool call limit reached")
+			if len(steps) < maxSteps {
+				output, err = tools.run(ctx, call)
+				steps = append(steps, newAgentStep(call, output, err))
+			}
+			if err != nil {
+				output = "Error: " + err.Error()
+			}
+			messages = append(messages, ChatMessage{Role: RoleTool, ToolCallID: call.ID, Name: call.Name, Content: output})
+		}
+	}
+}
+
+func newAgentStep(call ToolCall, output string, err error) AgentStep {
+	step := AgentStep{Tool: call.Name, Args: call.Args}
+	if err != nil {
+		step.Error = err.Error()
+		return step
+	}
+	if len(output) > maxStepOutput {
+		// Cut on a rune boundary so the output stays valid UTF-8
+		cut := maxStepOutput
+		for cut > 0 && !utf8.RuneStart(output[cut]) {
+			cut--
+		}
+		output = output[:cut] + "..."
+	}
+	step.Output = output
+	return step
+}
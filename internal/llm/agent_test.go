@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedModel replies with responses in order and records the requests it gets
+type scriptedModel struct {
+	responses []ChatResponse
+	requests  []ChatRequest
+}
+
+func (m *scriptedModel) Generate(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	m.requests = append(m.requests, req)
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func (m *scriptedModel) Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error) {
+	return m.Generate(ctx, req)
+}
+
+func newToolCall(id, name string, args map[string]interface{}) ToolCall {
+	return ToolCall{ID: id, Name: name, Args: args}
+}
+
+func TestRunAgent(t *testing.T) {
+	model := &scriptedModel{responses: []ChatResponse{
+		{ToolCalls: []ToolCall{newToolCall("call_1", ToolFindCallers, map[string]interface{}{"name": "Apply"})}, Usage: Usage{TotalTokens: 10}},
+		{ToolCalls: []ToolCall{newToolCall("call_2", ToolGetSymbol, map[string]interface{}{"symbol": "Apply"}), newToolCall("call_3", "unknown", nil)}, Usage: Usage{TotalTokens: 20}},
+		{Text: "Total [1] calls Apply [2], which subtracts the discount [9].", Usage: Usage{TotalTokens: 30}},
+	}}
+	client := &Client{model: model, promptTokenBudget: DefaultPromptTokenBudget}
+	tools := newTestToolbox(t)
+	history := []session.Message{
+		{Role: session.RoleUser, Content: "What is a Discount?"},
+		{Role: session.RoleAssistant, Content: "A percentage off [1]."},
+	}
+
+	answer, steps, err := client.RunAgent(context.Background(), "Who calls Apply?", history, tools.store, tools.opts, 5, GenerationParams{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Total [1] calls Apply [2], which subtracts the discount.", answer.Text)
+	assert.Equal(t, []int{9}, answer.InvalidCitations)
+	require.Len(t, answer.Sources, 2)
+	assert.Equal(t, "shop.(*Cart).Total", answer.Sources[0].Symbol)
+	assert.True(t, answer.Sources[1].Cited)
+	assert.Equal(t, 60, answer.Usage.TotalTokens)
+
+	require.Len(t, steps, 3)
+	assert.Equal(t, ToolFindCallers, steps[0].Tool)
+	assert.Contains(t, steps[0].Output, "shop.(*Cart).Total")
+	assert.Equal(t, `unknown tool "unknown"`, steps[2].Error)
+
+	first := model.requests[0]
+	assert.Equal(t, AgentTools, first.Tools)
+	assert.Equal(t, RoleSystem, first.Messages[0].Role)
+	assert.Equal(t, ChatMessage{Role: RoleAssistant, Content: "A percentage off."}, first.Messages[2])
+	assert.Equal(t, ChatMessage{Role: RoleUser, Content: "Who calls Apply?"}, first.Messages[3])
+
+	last := model.requests[2].Messages
+	assert.Equal(t, ChatMessage{Role: RoleTool, ToolCallID: "call_3", Name: "unknown", Content: `Error: unknown tool "unknown"`}, last[len(last)-1])
+	assert.Equal(t, RoleTool, last[len(last)-2].Role)
+	assert.Equal(t, "call_2", last[len(last)-2].ToolCallID)
+}
+
+func TestRunAgentStepLimit(t *testing.T) {
+	search := newToolCall("call_1", ToolSearchCode, map[string]interface{}{"query": "cart"})
+	model := &scriptedModel{responses: []ChatResponse{
+		{ToolCalls: []ToolCall{search, search}},
+		{Text: "The cart sums its items [1]."},
+	}}
+	client := &Client{model: model, promptTokenBudget: DefaultPromptTokenBudget}
+	tools := newTestToolbox(t)
+
+	answer, steps, err := client.RunAgent(context.Background(), "How is the total computed?", nil, tools.store, tools.opts, 1, GenerationParams{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "The cart sums its items [1].", answer.Text)
+	assert.Len(t, steps, 1)
+
+	final := model.requests[1]
+	assert.Nil(t, final.Tools)
+	assert.Equal(t, "Error: tool call limit reached", final.Messages[len(final.Messages)-2].Content)
+	assert.Equal(t, ChatMessage{Role: RoleUser, Content: agentFinalPrompt}, final.Messages[len(final.Messages)-1])
+}
+
+func TestRunAgentWithoutModel(t *testing.T) {
+	_, _, err := (&Client{}).RunAgent(context.Background(), "Q", nil, nil, storage.DefaultSearchOptions(), 3, GenerationParams{})
+	assert.EqualError(t, err, "chat model not initialized")
+}
+
+func TestNewAgentStepTruncatesOnRuneBoundary(t *testing.T) {
+	// The limit falls inside the second byte of a three-byte rune
+	output := strings.Repeat("a", maxStepOutput-1) + "€€"
+
+	step := newAgentStep(ToolCall{Name: ToolGetSymbol}, output, nil)
+
+	assert.True(t, utf8.ValidString(step.Output))
+	assert.Equal(t, strings.Repeat("a", maxStepOutput-1)+"...", step.Output)
+}
@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/usage"
+)
+
+// Chat message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages carry the result of a tool call back to the model
+	RoleTool = "tool"
+)
+
+// ChatMessage is one message sent to a chat model.
+type ChatMessage struct {
+	Role    string
+	Content string
+	// ToolCalls are the tools an assistant message asked to call
+	ToolCalls []ToolCall
+	// ToolCallID and Name identify the call a tool message answers
+	ToolCallID string
+	Name       string
+}
+
+// Tool is a function the model may ask to call, with its arguments described by Parameters.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  *Schema
+}
+
+// ToolCall is a model's request to call a tool. ID pairs it with its result; providers that
+// do not assign IDs get generated ones.
+type ToolCall struct {
+	ID   string                 `json:"id"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// GenerationParams selects the model and sampling settings for a request. Unset fields
+// (empty, zero or nil) leave the choice to the next level: request, deployment, provider.
+type GenerationParams struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	TopK        *int     `json:"topK,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+}
+
+// Merge returns p with the fields set in override replacing its own.
+func (p GenerationParams) Merge(override GenerationParams) GenerationParams {
+	if override.Model != "" {
+		p.Model = override.Model
+	}
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.TopK != nil {
+		p.TopK = override.TopK
+	}
+	if override.MaxTokens > 0 {
+		p.MaxTokens = override.MaxTokens
+	}
+	return p
+}
+
+// Validate checks that the parameters are in the ranges the providers accept.
+func (p GenerationParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return fmt.Errorf("topP must be between 0 and 1")
+	}
+	if p.TopK != nil && *p.TopK < 0 {
+		return fmt.Errorf("topK must not be negative")
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("maxTokens must not be negative")
+	}
+	return nil
+}
+
+// ChatRequest is a conversation to continue with the given parameters. The model may
+// answer with calls to Tools instead of text. With a ResponseSchema the model is asked to
+// reply with JSON conforming to it; providers constrain the output as far as they support.
+type ChatRequest struct {
+	Messages       []ChatMessage
+	Params         GenerationParams
+	Tools          []Tool
+	ResponseSchema *Schema
+}
+
+// Reasons a model stops before finishing a reply, as reported in ChatResponse.FinishReason
+const (
+	// FinishMaxTokens replies were cut off at the output token limit
+	FinishMaxTokens = "max_tokens"
+	// FinishSafety replies, or the prompts for them, were blocked by safety filters
+	FinishSafety = "safety"
+	// FinishRecitation replies were blocked for reproducing training data
+	FinishRecitation = "recitation"
+	// FinishOther replies were stopped for any other reason
+	FinishOther = "other"
+)
+
+// ChatResponse is the text a model generated, the tools it asked to call and the tokens it used.
+type ChatResponse struct {
+	Text      string
+	ToolCalls []ToolCall
+	Usage     Usage
+	// FinishReason is why the model stopped if it did not finish the reply, e.g.
+	// FinishMaxTokens; it is empty for finished replies and providers that do not say
+	FinishReason string
+	// SafetyCategories are the categories a FinishSafety reply was blocked for, if known
+	SafetyCategories []string
+}
+
+// Usage reports the tokens a model counted for a request.
+type Usage struct {
+	PromptTokens    int `json:"promptTokens"`
+	CandidateTokens int `json:"candidateTokens"`
+	TotalTokens     int `json:"totalTokens"`
+}
+
+// Add returns the sum of u and other, e.g. for requests that take several model calls.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:    u.PromptTokens + other.PromptTokens,
+		CandidateTokens: u.CandidateTokens + other.CandidateTokens,
+		TotalTokens:     u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// ChatModel generates replies from a chat LLM provider.
+type ChatModel interface {
+	// Generate returns the model's reply to req.
+	Generate(ctx context.Context, req ChatRequest) (ChatResponse, error)
+	// Stream is Generate with onToken called for each piece of the reply as it arrives.
+	// An error from onToken stops the stream and is returned.
+	Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error)
+}
+
+// meteredModel records the usage of each call in the usage.Meter of the call's context
+type meteredModel struct {
+	ChatModel
+}
+
+func (m meteredModel) Generate(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := m.ChatModel.Generate(ctx, req)
+	if err == nil {
+		usage.FromContext(ctx).AddChat(resp.Usage.PromptTokens, resp.Usage.CandidateTokens, resp.Usage.TotalTokens)
+	}
+	return resp, err
+}
+
+func (m meteredModel) Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error) {
+	resp, err := m.ChatModel.Stream(ctx, req, onToken)
+	if err == nil {
+		usage.FromContext(ctx).AddChat(resp.Usage.PromptTokens, resp.Usage.CandidateTokens, resp.Usage.TotalTokens)
+	}
+	return resp, err
+}
+
+// NewChatModelFromConfig creates the chat model selected by LLM_PROVIDER.
+func NewChatModelFromConfig(cfg *config.Config) (ChatModel, error) {
+	switch cfg.LLMProvider {
+	case "", "gemini":
+		safety, err := ParseSafetySettings(cfg.GeminiSafetySettings)
+		if err != nil {
+			return nil, err
+		}
+		return NewGeminiChat(cfg.GeminiAPIKey, safety)
+	case "openai":
+		return NewOpenAIChat(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey), nil
+	case "ollama":
+		return NewOllamaChat(cfg.OllamaURL), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLMProvider)
+	}
+}
+
+// DeploymentParams returns the answer generation parameters configured for the deployment.
+func DeploymentParams(cfg *config.Config) GenerationParams {
+	temperature, topP, topK := cfg.LLMTemperature, cfg.LLMTopP, cfg.LLMTopK
+	return GenerationParams{
+		Model:       cfg.LLMModel,
+		Temperature: &temperature,
+		TopP:        &topP,
+		TopK:        &topK,
+		MaxTokens:   cfg.LLMMaxTokens,
+	}
+}
+
+// userPrompt wraps a single-turn prompt as a chat request
+func userPrompt(prompt string, params GenerationParams) ChatRequest {
+	return ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: prompt}}, Params: params}
+}
+
+// chatHTTPTimeout bounds a whole request to an HTTP chat API, including reading a streamed
+// reply, so a hung server cannot block a request forever. Local models can be slow to answer.
+const chatHTTPTimeout = 5 * time.Minute
+
+// newChatHTTPClient returns the client used by the HTTP chat models
+func newChatHTTPClient() *http.Client {
+	return &http.Client{Timeout: chatHTTPTimeout}
+}
+
+// postJSON sends body as JSON to url and returns the response, which the caller must close.
+// Non-2xx responses are returned as errors including the start of the response body.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// toolCallID generates an ID for the nth tool call of a response, for providers without IDs
+func toolCallID(n int) string {
+	return fmt.Sprintf("call_%d", n+1)
+}
+
+// float64Ptr helps set optional generation parameters
+func float64Ptr(v float64) *float64 { return &v }
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"intelligent-doc-assistant/internal/usage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationParamsMerge(t *testing.T) {
+	topK := 40
+	deployment := GenerationParams{Model: "gemini-2.0-flash-001", Temperature: float64Ptr(0.3), TopK: &topK, MaxTokens: 1024}
+
+	got := deployment.Merge(GenerationParams{Temperature: float64Ptr(0), MaxTokens: 2048})
+
+	assert.Equal(t, GenerationParams{Model: "gemini-2.0-flash-001", Temperature: float64Ptr(0), TopK: &topK, MaxTokens: 2048}, got)
+	assert.Equal(t, deployment, deployment.Merge(GenerationParams{}))
+}
+
+func TestGenerationParamsValidate(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name    string
+		params  GenerationParams
+		wantErr bool
+	}{
+		{"empty", GenerationParams{}, false},
+		{"valid", GenerationParams{Temperature: float64Ptr(1.5), TopP: float64Ptr(0.9), MaxTokens: 100}, false},
+		{"temperature too high", GenerationParams{Temperature: float64Ptr(2.5)}, true},
+		{"topP above 1", GenerationParams{TopP: float64Ptr(1.1)}, true},
+		{"negative topK", GenerationParams{TopK: &negative}, true},
+		{"negative maxTokens", GenerationParams{MaxTokens: -5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMeteredModel(t *testing.T) {
+	model := &scriptedModel{responses: []ChatResponse{
+		{Text: "a", Usage: Usage{PromptTokens: 10, CandidateTokens: 2, TotalTokens: 12}},
+		{Text: "b", Usage: Usage{PromptTokens: 20, CandidateTokens: 3, TotalTokens: 23}},
+		{Text: "c", Usage: Usage{PromptTokens: 5, CandidateTokens: 5, TotalTokens: 10}},
+	}}
+	client := NewClientWithModel(model)
+	meter := usage.NewMeter(usage.Prices{})
+	ctx := usage.WithMeter(context.Background(), meter)
+
+	_, err := client.model.Generate(ctx, ChatRequest{})
+	require.NoError(t, err)
+	_, err = client.model.Stream(ctx, ChatRequest{}, func(string) error { return nil })
+	require.NoError(t, err)
+	// Calls without a meter are not recorded anywhere
+	_, err = client.model.Generate(context.Background(), ChatRequest{})
+	require.NoError(t, err)
+
+	totals := meter.Totals()
+	assert.Equal(t, 2, totals.ChatCalls)
+	assert.Equal(t, 30, totals.PromptTokens)
+	assert.Equal(t, 5, totals.CompletionTokens)
+	assert.Equal(t, 35, totals.TotalTokens)
+}
+
+func TestHTTPChatModelsTimeOut(t *testing.T) {
+	assert.Equal(t, chatHTTPTimeout, NewOpenAIChat("http://localhost", "").client.Timeout)
+	assert.Equal(t, chatHTTPTimeout, NewOllamaChat("http://localhost").client.Timeout)
+}
@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is a chunk that was shown to the model, numbered as it appeared in the prompt.
+type Source struct {
+	ID        int     `json:"id"`
+	Repo      string  `json:"repo,omitempty"`
+	Commit    string  `json:"commit,omitempty"`
+	FilePath  string  `json:"filePath"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Symbol    string  `json:"symbol"`
+	Score     float64 `json:"score"`
+	Cited     bool    `json:"cited"`
+}
+
+// Answer is a generated answer with the sources it was grounded in.
+type Answer struct {
+	// Text references sources with numbered citations such as [1] or [1, 3]
+	Text    string
+	Sources []Source
+	// InvalidCitations lists citation numbers that matched no source; they are removed from Text
+	InvalidCitations []int
+	// Usage is the token usage reported by the chat model for generating the answer
+	Usage Usage
+	// Structured is set for answers requested in structured form; Text is then its summary
+	Structured *StructuredAnswer
+}
+
+// citationGroup matches bracketed citation lists such as [2] or [1, 3], together with the
+// preceding character so that index expressions like chunks[0] are not mistaken for citations
+var citationGroup = regexp.MustCompile(`(^|[^\w\])])\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// validateCitations marks the sources cited in text and strips citations of sources that were
+// not in the prompt, so every remaining citation refers to code the model was actually shown.
+// Fenced code blocks are left untouched.
+func validateCitations(text string, sources []Source) Answer {
+	byID := make(map[int]*Source, len(sources))
+	for i := range sources {
+		byID[sources[i].ID] = &sources[i]
+	}
+
+	invalid := make(map[int]bool)
+	replace := func(group string) string {
+		match := citationGroup.FindStringSubmatch(group)
+		prefix, ids := match[1], match[2]
+
+		var valid []string
+		for _, field := range strings.Split(ids, ",") {
+			id, _ := strconv.Atoi(strings.TrimSpace(field))
+			if source, ok := byID[id]; ok {
+				source.Cited = true
+				valid = append(valid, strconv.Itoa(id))
+			} else {
+				invalid[id] = true
+			}
+		}
+		if len(valid) == 0 {
+			// Drop the space before a removed citation too
+			return strings.TrimRight(prefix, " ")
+		}
+		return prefix + "[" + strings.Join(valid, ", ") + "]"
+	}
+
+	segments := strings.Split(text, "```")
+	for i := 0; i < len(segments); i += 2 {
+		segments[i] = citationGroup.ReplaceAllStringFunc(segments[i], replace)
+	}
+
+	answer := Answer{Text: strings.TrimSpace(strings.Join(segments, "```")), Sources: sources}
+	for id := range invalid {
+		answer.InvalidCitations = append(answer.InvalidCitations, id)
+	}
+	sort.Ints(answer.InvalidCitations)
+	return answer
+}
+
+// stripCitations removes all citations from text, leaving fenced code blocks untouched
+func stripCitations(text string) string {
+	return validateCitations(text, nil).Text
+}
+
+// sourcesFor numbers the chunks included in a prompt as sources, starting at 1
+func sourcesFor(chunks []PromptChunk) []Source {
+	sources := make([]Source, len(chunks))
+	for i, chunk := range chunks {
+		symbol := chunk.Symbol
+		if symbol == "" {
+			symbol = chunk.Name
+		}
+		sources[i] = Source{
+			ID:        chunk.Number,
+			Repo:      chunk.Repo,
+			Commit:    chunk.Commit,
+			FilePath:  chunk.FilePath,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Symbol:    symbol,
+			Score:     chunk.Score,
+		}
+	}
+	return sources
+}
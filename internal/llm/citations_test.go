@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCitations(t *testing.T) {
+	sources := func() []Source {
+		return []Source{{ID: 1, Symbol: "storage.(*Store).StoreChunks"}, {ID: 2, Symbol: "storage.insertChunks"}}
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		cited   []bool
+		invalid []int
+	}{
+		{
+			name:  "valid citations",
+			text:  "StoreChunks embeds chunks [1] and upserts them in batches [1, 2].",
+			want:  "StoreChunks embeds chunks [1] and upserts them in batches [1, 2].",
+			cited: []bool{true, true},
+		},
+		{
+			name:    "unknown sources are removed",
+			text:    "It retries on failure [3]. Rows are batched [2, 4].",
+			want:    "It retries on failure. Rows are batched [2].",
+			cited:   []bool{false, true},
+			invalid: []int{3, 4},
+		},
+		{
+			name:  "index expressions and code blocks are not citations",
+			text:  "It reads embeddings[0] [1].\n```go\nx := chunks[7]\n// [9]\n```",
+			want:  "It reads embeddings[0] [1].\n```go\nx := chunks[7]\n// [9]\n```",
+			cited: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateCitations(tt.text, sources())
+
+			assert.Equal(t, tt.want, got.Text)
+			assert.Equal(t, tt.invalid, got.InvalidCitations)
+			for i, cited := range tt.cited {
+				assert.Equal(t, cited, got.Sources[i].Cited, "source %d", i+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/guardrails"
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+type Client struct {
+	model ChatModel
+	// Answer generation parameters configured for the deployment; requests may override them
+	params GenerationParams
+
+	// Prompt template for answers and the token budget for code context in it
+	promptTemplate    *template.Template
+	promptTokenBudget int
+
+	// guard redacts secrets from code before it is sent to the model and flags injected instructions
+	guard *guardrails.Guard
+
+	// maxContinuations is how many times an answer cut off at the token limit is continued
+	maxContinuations int
+}
+
+// NewClient creates a client for the chat model configured by LLM_PROVIDER.
+func NewClient() *Client {
+	model, err := NewChatModelFromConfig(config.GetConfig())
+	if err != nil {
+		fmt.Printf("Failed to create chat model: %v\n", err)
+	}
+	return NewClientWithModel(model)
+}
+
+// NewClientWithModel creates a client that answers with model, configured from the environment.
+// Calls to model are recorded in the usage.Meter of their context.
+func NewClientWithModel(model ChatModel) *Client {
+	cfg := config.GetConfig()
+
+	tmpl, err := LoadPromptTemplate(cfg.PromptTemplate)
+	if err != nil {
+		fmt.Printf("Using default prompt template: %v\n", err)
+		tmpl, _ = LoadPromptTemplate("")
+	}
+	budget := cfg.PromptTokenBudget
+	if budget <= 0 {
+		budget = DefaultPromptTokenBudget
+	}
+
+	guard, err := guardrails.NewFromConfig(cfg)
+	if err != nil {
+		fmt.Printf("Using the built-in guardrails: %v\n", err)
+		guard = defaultGuard()
+	}
+
+	// Every model call a client makes is metered, including rewriting and reranking
+	if model != nil {
+		model = meteredModel{model}
+	}
+	return &Client{
+		model:             model,
+		params:            DeploymentParams(cfg),
+		promptTemplate:    tmpl,
+		promptTokenBudget: budget,
+		guard:             guard,
+		maxContinuations:  cfg.LLMMaxContinuations,
+	}
+}
+
+// Guard returns the guardrails the client applies to code, nil if they are disabled.
+func (c *Client) Guard() *guardrails.Guard {
+	return c.guard
+}
+
+// defaultGuard applies the built-in rule packs, for when the configured ones are invalid
+func defaultGuard() *guardrails.Guard {
+	secrets, _ := guardrails.Pack("secrets")
+	injection, _ := guardrails.Pack("injection")
+	guard, _ := guardrails.New(append(secrets, injection...), nil)
+	return guard
+}
+
+// GenerateAnswer generates a response to a user's question using relevant code chunks and their
+// similarity scores, following on from the earlier messages of the conversation in history.
+// params override the deployment's generation parameters. The answer cites the chunks it
+// relies on, and citations are checked against the chunks that were actually sent. Answers
+// cut off at the token limit are continued; answers the model does not finish return a
+// FinishError.
+func (c *Client) GenerateAnswer(ctx context.Context, question string, history []session.Message, searchResults []storage.SearchResult, params GenerationParams) (Answer, error) {
+	req, chunks, err := c.answerRequest(question, history, searchResults, params)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	resp, err := c.model.Generate(ctx, req)
+	if err != nil {
+		return Answer{}, err
+	}
+	if resp, err = c.complete(ctx, req, resp, nil); err != nil {
+		return Answer{}, err
+	}
+	return c.finishAnswer(resp, chunks)
+}
+
+// StreamAnswer is GenerateAnswer with the answer streamed: onToken receives each piece of text
+// as the model produces it. Citations are validated once the whole answer has arrived, so the
+// streamed text may still contain citations that the returned Answer drops. Cancelling ctx
+// stops the stream; an error from onToken does too and is returned.
+func (c *Client) StreamAnswer(ctx context.Context, question string, history []session.Message, searchResults []storage.SearchResult, params GenerationParams, onToken func(string) error) (Answer, error) {
+	req, chunks, err := c.answerRequest(question, history, searchResults, params)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	resp, err := c.model.Stream(ctx, req, onToken)
+	if err != nil {
+		return Answer{}, err
+	}
+	if resp, err = c.complete(ctx, req, resp, onToken); err != nil {
+		return Answer{}, err
+	}
+	return c.finishAnswer(resp, chunks)
+}
+
+// answerRequest builds the chat request for answering question from history and searchResults
+func (c *Client) answerRequest(question string, history []session.Message, searchResults []storage.SearchResult, params GenerationParams) (ChatRequest, []PromptChunk, error) {
+	if c.model == nil {
+		return ChatRequest{}, nil, fmt.Errorf("chat model not initialized")
+	}
+
+	if len(searchResults) == 0 {
+		return ChatRequest{}, nil, fmt.Errorf("no relevant code found in the codebase for the question. Please make sure to ingest the codebase first using the /ingest endpoint")
+	}
+
+	// Build the prompt by including relevant code chunks, their source and similarity scores
+	prompt, chunks, err := buildPrompt(c.promptTemplate, c.guard, question, history, searchResults, c.promptTokenBudget)
+	if err != nil {
+		return ChatRequest{}, nil, err
+	}
+
+	return userPrompt(prompt, c.params.Merge(params)), chunks, nil
+}
+
+// finishAnswer checks the citations in the model's reply against the chunks that were sent
+func (c *Client) finishAnswer(resp ChatResponse, chunks []PromptChunk) (Answer, error) {
+	text := strings.TrimSpace(resp.Text)
+	if text == "" {
+		return Answer{}, fmt.Errorf("no text content in model response")
+	}
+
+	answer := validateCitations(text, sourcesFor(chunks))
+	answer.Usage = resp.Usage
+	return answer, nil
+}
+
+// generateText sends a single-turn prompt to the deployment's model and returns the reply.
+// Only the model is taken from the deployment parameters; callers choose their own sampling.
+// Replies the model does not finish return a FinishError.
+func (c *Client) generateText(ctx context.Context, prompt string, params GenerationParams) (string, error) {
+	if c.model == nil {
+		return "", fmt.Errorf("chat model not initialized")
+	}
+
+	resp, err := c.model.Generate(ctx, userPrompt(prompt, GenerationParams{Model: c.params.Model}.Merge(params)))
+	if err != nil {
+		return "", err
+	}
+	if err := checkFinish(resp); err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(resp.Text)
+	if text == "" {
+		return "", fmt.Errorf("no text content in model response")
+	}
+	return text, nil
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"intelligent-doc-assistant/internal/session"
+)
+
+// condenseHistoryTokens bounds the conversation sent when condensing a follow-up question
+const condenseHistoryTokens = 1000
+
+// CondenseQuestion rewrites a follow-up question such as "and where is that called?" into a
+// standalone question that can be searched for without the conversation in history. With no
+// history the question is returned unchanged.
+func (c *Client) CondenseQuestion(ctx context.Context, history []session.Message, question string) (string, error) {
+	if len(history) == 0 {
+		return question, nil
+	}
+
+	text, err := c.generateText(ctx, buildCondensePrompt(history, question), GenerationParams{
+		Temperature: float64Ptr(0),
+		MaxTokens:   256,
+	})
+	if err != nil {
+		return "", err
+	}
+	return parseCondensed(text), nil
+}
+
+func buildCondensePrompt(history []session.Message, question string) string {
+	messages, _ := fitHistory(history, condenseHistoryTokens)
+
+	var prompt strings.Builder
+	prompt.WriteString("Below is a conversation about a Go code base, followed by a follow-up question.\n\n")
+	for _, message := range messages {
+		role := "Assistant"
+		if message.Role == session.RoleUser {
+			role = "User"
+		}
+		fmt.Fprintf(&prompt, "%s: %s\n", role, message.Content)
+	}
+	fmt.Fprintf(&prompt, "\nFollow-up question: %s\n\n", question)
+	prompt.WriteString("Rewrite the follow-up question as a standalone question that can be understood without the conversation, " +
+		"naming the functions, types and files it refers to. Respond with only the rewritten question.")
+	return prompt.String()
+}
+
+// parseCondensed strips labels and quotes the model sometimes puts around the question
+func parseCondensed(text string) string {
+	text = strings.TrimSpace(text)
+	for _, label := range []string{"Standalone question:", "Rewritten question:", "Question:"} {
+		text = strings.TrimSpace(strings.TrimPrefix(text, label))
+	}
+	return strings.Trim(text, "\"'`")
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"testing"
+
+	"intelligent-doc-assistant/internal/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCondensePrompt(t *testing.T) {
+	prompt := buildCondensePrompt([]session.Message{
+		{Role: session.RoleUser, Content: "What does StoreChunks do?"},
+		{Role: session.RoleAssistant, Content: "It embeds and upserts chunks [1]."},
+	}, "and where is that called?")
+
+	assert.Contains(t, prompt, "User: What does StoreChunks do?\nAssistant: It embeds and upserts chunks.\n")
+	assert.Contains(t, prompt, "Follow-up question: and where is that called?")
+}
+
+func TestParseCondensed(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Where is StoreChunks called?", "Where is StoreChunks called?"},
+		{"Standalone question: \"Where is StoreChunks called?\"\n", "Where is StoreChunks called?"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseCondensed(tt.text))
+	}
+}
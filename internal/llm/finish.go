@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors for replies the model did not finish, to match FinishErrors with errors.Is
+var (
+	ErrTruncated  = errors.New("answer truncated at the output token limit")
+	ErrBlocked    = errors.New("answer blocked by safety filters")
+	ErrRecitation = errors.New("answer blocked for reciting training data")
+	ErrIncomplete = errors.New("model stopped before finishing the answer")
+)
+
+// FinishError reports a reply the model stopped before finishing.
+type FinishError struct {
+	// Reason is the ChatResponse.FinishReason of the reply
+	Reason string
+	// Categories are the safety categories a blocked reply was flagged in, if known
+	Categories []string
+	// Text is what the model generated before it stopped
+	Text string
+}
+
+func (e *FinishError) Error() string {
+	if len(e.Categories) > 0 {
+		return fmt.Sprintf("%v (%s)", e.Unwrap(), strings.Join(e.Categories, ", "))
+	}
+	return e.Unwrap().Error()
+}
+
+// Unwrap returns the sentinel error for the reason the model stopped
+func (e *FinishError) Unwrap() error {
+	switch e.Reason {
+	case FinishMaxTokens:
+		return ErrTruncated
+	case FinishSafety:
+		return ErrBlocked
+	case FinishRecitation:
+		return ErrRecitation
+	default:
+		return ErrIncomplete
+	}
+}
+
+// checkFinish returns a FinishError if the model did not finish resp
+func checkFinish(resp ChatResponse) error {
+	if resp.FinishReason == "" {
+		return nil
+	}
+	return &FinishError{Reason: resp.FinishReason, Categories: resp.SafetyCategories, Text: resp.Text}
+}
+
+const continuePrompt = "Your answer was cut off. Continue it exactly where it stopped, without repeating any of it or starting over."
+
+// complete asks the model to continue resp, its reply to req, for as long as the reply is
+// cut off at the token limit, up to maxContinuations times. The continuations are streamed
+// to onToken when it is set. It returns the whole reply with the usage of every call, or a
+// FinishError if the model did not finish it.
+func (c *Client) complete(ctx context.Context, req ChatRequest, resp ChatResponse, onToken func(string) error) (ChatResponse, error) {
+	for n := 1; n <= c.maxContinuations && resp.FinishReason == FinishMaxTokens && len(resp.ToolCalls) == 0; n++ {
+		next := req
+		next.Messages = append(append([]ChatMessage{}, req.Messages...),
+			ChatMessage{Role: RoleAssistant, Content: resp.Text},
+			ChatMessage{Role: RoleUser, Content: continuePrompt})
+		var more ChatResponse
+		var err error
+		if onToken != nil {
+			more, err = c.model.Stream(ctx, next, onToken)
+		} else {
+			more, err = c.model.Generate(ctx, next)
+		}
+		if err != nil {
+			return ChatResponse{}, err
+		}
+
+		// Continuations pick up mid-word as often as not, so they are joined as they are
+		more.Text = resp.Text + more.Text
+		more.Usage = resp.Usage.Add(more.Usage)
+		resp = more
+	}
+	return resp, checkFinish(resp)
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAnswerContinuesTruncated(t *testing.T) {
+	model := &scriptedModel{responses: []ChatResponse{
+		{Text: "Short returns wit", FinishReason: FinishMaxTokens, Usage: Usage{PromptTokens: 100, CandidateTokens: 5, TotalTokens: 105}},
+		{Text: "hout doing anything [1].", Usage: Usage{PromptTokens: 110, CandidateTokens: 6, TotalTokens: 116}},
+	}}
+	client := NewClientWithModel(model)
+	results := []storage.SearchResult{result("Short", "func Short() {}")}
+
+	answer, err := client.GenerateAnswer(context.Background(), "What does Short do?", nil, results, GenerationParams{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Short returns without doing anything [1].", answer.Text)
+	assert.Equal(t, Usage{PromptTokens: 210, CandidateTokens: 11, TotalTokens: 221}, answer.Usage)
+	// The continuation request carries the cut-off answer back to the model
+	require.Len(t, model.requests, 2)
+	messages := model.requests[1].Messages
+	assert.Equal(t, ChatMessage{Role: RoleAssistant, Content: "Short returns wit"}, messages[len(messages)-2])
+	assert.Equal(t, ChatMessage{Role: RoleUser, Content: continuePrompt}, messages[len(messages)-1])
+	assert.Len(t, model.requests[0].Messages, 1)
+}
+
+func TestGenerateAnswerUnfinished(t *testing.T) {
+	results := []storage.SearchResult{result("Short", "func Short() {}")}
+	truncated := ChatResponse{Text: "Short", FinishReason: FinishMaxTokens}
+
+	tests := []struct {
+		name      string
+		responses []ChatResponse
+		want      error
+		wantText  string
+		wantError string
+	}{
+		{
+			name:      "still truncated after the continuations",
+			responses: []ChatResponse{truncated, truncated, truncated},
+			want:      ErrTruncated,
+			wantText:  "ShortShortShort",
+			wantError: "answer truncated at the output token limit",
+		},
+		{
+			name:      "blocked",
+			responses: []ChatResponse{{FinishReason: FinishSafety, SafetyCategories: []string{"dangerous_content"}}},
+			want:      ErrBlocked,
+			wantError: "answer blocked by safety filters (dangerous_content)",
+		},
+		{
+			name:      "recitation",
+			responses: []ChatResponse{{Text: "Copyright", FinishReason: FinishRecitation}},
+			want:      ErrRecitation,
+			wantText:  "Copyright",
+			wantError: "answer blocked for reciting training data",
+		},
+		{
+			name:      "blocked while continuing",
+			responses: []ChatResponse{truncated, {FinishReason: FinishSafety}},
+			want:      ErrBlocked,
+			wantText:  "Short",
+			wantError: "answer blocked by safety filters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClientWithModel(&scriptedModel{responses: tt.responses})
+
+			_, err := client.GenerateAnswer(context.Background(), "Q", nil, results, GenerationParams{})
+
+			assert.ErrorIs(t, err, tt.want)
+			assert.EqualError(t, err, tt.wantError)
+			var finish *FinishError
+			require.True(t, errors.As(err, &finish))
+			assert.Equal(t, tt.wantText, finish.Text)
+		})
+	}
+}
+
+func TestGenerateTextUnfinished(t *testing.T) {
+	client := NewClientWithModel(&scriptedModel{responses: []ChatResponse{{Text: "1. cart", FinishReason: FinishMaxTokens}}})
+
+	// Short helper prompts are not continued
+	_, err := client.generateText(context.Background(), "Q", GenerationParams{})
+	assert.ErrorIs(t, err, ErrTruncated)
+}
@@ -2,131 +2,444 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
-	"intelligent-doc-assistant/config"
-	"intelligent-doc-assistant/internal/storage"
-
-	genai "cloud.google.com/go/ai/generativelanguage/apiv1"
-	pb "cloud.google.com/go/ai/generativelanguage/apiv1/generativelanguagepb"
+	genai "cloud.google.com/go/ai/generativelanguage/apiv1beta"
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
 	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type Client struct {
-	genaiClient *genai.GenerativeClient
+// DefaultGeminiModel is the Gemini model used when none is configured.
+const DefaultGeminiModel = "models/gemini-2.0-flash-001"
+
+// GeminiChat generates replies with Google's Gemini API.
+type GeminiChat struct {
+	client *genai.GenerativeClient
+	// safety overrides Gemini's default safety thresholds; nil keeps them
+	safety []*pb.SafetySetting
 }
 
-func NewClient() *Client {
-	cfg := config.GetConfig()
-	ctx := context.Background()
+// NewGeminiChat creates a Gemini chat model authenticated with apiKey, with the given
+// safety settings (see ParseSafetySettings).
+func NewGeminiChat(apiKey string, safety []*pb.SafetySetting) (*GeminiChat, error) {
+	client, err := genai.NewGenerativeClient(context.Background(), option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	return &GeminiChat{client: client, safety: safety}, nil
+}
 
-	client, err := genai.NewGenerativeClient(ctx, option.WithAPIKey(cfg.GeminiAPIKey))
+// Generate returns the reply of the best candidate Gemini generated (see selectCandidate).
+// Replies that were cut off or blocked are returned with their FinishReason.
+func (g *GeminiChat) Generate(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := g.client.GenerateContent(ctx, g.request(req))
 	if err != nil {
-		fmt.Printf("Failed to create Gemini client: %v", err)
-		return &Client{}
+		return ChatResponse{}, fmt.Errorf("Gemini API error: %w", err)
 	}
 
-	return &Client{
-		genaiClient: client,
+	if resp == nil {
+		return ChatResponse{}, fmt.Errorf("no response generated from Gemini")
 	}
+	return geminiResponse(resp), nil
 }
 
-// GenerateAnswer generates a response to a user's question using relevant code chunks and their similarity scores
-func (c *Client) GenerateAnswer(ctx context.Context, question string, searchResults []storage.SearchResult) (string, error) {
-	if c.genaiClient == nil {
-		return "", fmt.Errorf("Gemini client not initialized")
-	}
+func (g *GeminiChat) Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error) {
+	// The stream is abandoned with ctx when we return early, e.g. because onToken failed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if len(searchResults) == 0 {
-		return "", fmt.Errorf("no relevant code found in the codebase for the question. Please make sure to ingest the codebase first using the /ingest endpoint")
+	stream, err := g.client.StreamGenerateContent(ctx, g.request(req))
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("Gemini API error: %w", err)
 	}
+	return collectStream(stream.Recv, onToken)
+}
 
-	// Build the prompt by including relevant code chunks and their similarity scores
-	prompt := buildPromptWithScores(question, searchResults)
-
-	fmt.Printf("Sending prompt to Gemini: %s\n", prompt) // Debug log
+// request converts req to a GenerateContentRequest with the model's safety settings
+func (g *GeminiChat) request(req ChatRequest) *pb.GenerateContentRequest {
+	request := geminiRequest(req)
+	request.SafetySettings = g.safety
+	return request
+}
 
-	// Create float32 and int32 pointers for config
-	temp := float32(0.3)
-	topP := float32(0.8)
-	topK := int32(40)
-	maxTokens := int32(1024)
+// geminiRequest converts req to a GenerateContentRequest. System messages become the system
+// instruction, and tool calls and results become function call and response parts.
+func geminiRequest(req ChatRequest) *pb.GenerateContentRequest {
+	model := req.Params.Model
+	if model == "" {
+		model = DefaultGeminiModel
+	}
+	if !strings.HasPrefix(model, "models/") {
+		model = "models/" + model
+	}
 
-	// Create the generate content request
-	req := &pb.GenerateContentRequest{
-		Model: "models/gemini-2.0-flash-001",
-		Contents: []*pb.Content{
-			{
+	var system []string
+	var contents []*pb.Content
+	for _, message := range req.Messages {
+		switch message.Role {
+		case RoleSystem:
+			system = append(system, message.Content)
+		case RoleTool:
+			part := &pb.Part{Data: &pb.Part_FunctionResponse{FunctionResponse: &pb.FunctionResponse{
+				Name:     message.Name,
+				Response: functionResponse(message.Content),
+			}}}
+			// Results of the calls made in one turn go back together in one turn
+			if last := len(contents) - 1; last >= 0 && contents[last].Parts[0].GetFunctionResponse() != nil {
+				contents[last].Parts = append(contents[last].Parts, part)
+				continue
+			}
+			contents = append(contents, &pb.Content{Role: "user", Parts: []*pb.Part{part}})
+		case RoleAssistant:
+			content := &pb.Content{Role: "model"}
+			if message.Content != "" || len(message.ToolCalls) == 0 {
+				content.Parts = append(content.Parts, &pb.Part{Data: &pb.Part_Text{Text: message.Content}})
+			}
+			for _, call := range message.ToolCalls {
+				args, _ := structpb.NewStruct(call.Args)
+				content.Parts = append(content.Parts, &pb.Part{Data: &pb.Part_FunctionCall{FunctionCall: &pb.FunctionCall{
+					Name: call.Name,
+					Args: args,
+				}}})
+			}
+			contents = append(contents, content)
+		default:
+			contents = append(contents, &pb.Content{
+				Role: "user",
 				Parts: []*pb.Part{
 					{
 						Data: &pb.Part_Text{
-							Text: prompt,
+							Text: message.Content,
 						},
 					},
 				},
-			},
-		},
-		GenerationConfig: &pb.GenerationConfig{
-			Temperature:     &temp,
-			TopP:            &topP,
-			TopK:            &topK,
-			MaxOutputTokens: &maxTokens,
-		},
-		SafetySettings: []*pb.SafetySetting{
-			{
-				Category:  pb.HarmCategory_HARM_CATEGORY_HARASSMENT,
-				Threshold: pb.SafetySetting_HARM_BLOCK_THRESHOLD_UNSPECIFIED,
-			},
-			{
-				Category:  pb.HarmCategory_HARM_CATEGORY_HATE_SPEECH,
-				Threshold: pb.SafetySetting_HARM_BLOCK_THRESHOLD_UNSPECIFIED,
-			},
-		},
-	}
-
-	// Generate response
-	resp, err := c.genaiClient.GenerateContent(ctx, req)
-	if err != nil {
-		return "", fmt.Errorf("Gemini API error: %w", err)
+			})
+		}
 	}
 
-	if resp == nil {
-		return "", fmt.Errorf("no response generated from Gemini")
+	var instruction *pb.Content
+	if len(system) > 0 {
+		instruction = &pb.Content{Parts: []*pb.Part{{Data: &pb.Part_Text{Text: strings.Join(system, "\n\n")}}}}
 	}
 
-	var answer strings.Builder
-	for _, candidate := range resp.Candidates {
-		if candidate != nil && len(candidate.Content.Parts) > 0 {
-			for _, part := range candidate.Content.Parts {
-				if text := part.GetText(); text != "" {
-					answer.WriteString(text)
-					answer.WriteString(" ")
-				}
+	var tools []*pb.Tool
+	if len(req.Tools) > 0 {
+		tool := &pb.Tool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, &pb.FunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  geminiSchema(t.Parameters),
+			})
+		}
+		tools = []*pb.Tool{tool}
+	}
+
+	config := geminiConfig(req.Params)
+	if req.ResponseSchema != nil {
+		config.ResponseMimeType = "application/json"
+		config.ResponseSchema = geminiSchema(req.ResponseSchema)
+	}
+
+	return &pb.GenerateContentRequest{
+		Model:             model,
+		Contents:          contents,
+		SystemInstruction: instruction,
+		Tools:             tools,
+		GenerationConfig:  config,
+	}
+}
+
+// safetyCategories are the harm categories Gemini models apply safety settings to
+var safetyCategories = []pb.HarmCategory{
+	pb.HarmCategory_HARM_CATEGORY_HARASSMENT,
+	pb.HarmCategory_HARM_CATEGORY_HATE_SPEECH,
+	pb.HarmCategory_HARM_CATEGORY_SEXUALLY_EXPLICIT,
+	pb.HarmCategory_HARM_CATEGORY_DANGEROUS_CONTENT,
+}
+
+// ParseSafetySettings parses Gemini safety settings given as comma-separated
+// category=threshold pairs, e.g. "harassment=block_only_high,dangerous_content=block_none",
+// or as a single threshold for every category. Categories may omit the HARM_CATEGORY_
+// prefix and names are case-insensitive. An empty spec returns nil, which keeps Gemini's
+// default thresholds.
+func ParseSafetySettings(spec string) ([]*pb.SafetySetting, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var settings []*pb.SafetySetting
+	for _, pair := range strings.Split(spec, ",") {
+		category, threshold, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			category, threshold = "", category
+		}
+		value, ok := pb.SafetySetting_HarmBlockThreshold_value[strings.ToUpper(strings.TrimSpace(threshold))]
+		if !ok || value == int32(pb.SafetySetting_HARM_BLOCK_THRESHOLD_UNSPECIFIED) {
+			return nil, fmt.Errorf("unknown safety threshold %q", threshold)
+		}
+
+		categories := safetyCategories
+		if found {
+			name := strings.ToUpper(strings.TrimSpace(category))
+			if !strings.HasPrefix(name, "HARM_CATEGORY_") {
+				name = "HARM_CATEGORY_" + name
+			}
+			harm := pb.HarmCategory(pb.HarmCategory_value[name])
+			if !containsCategory(safetyCategories, harm) {
+				return nil, fmt.Errorf("unknown safety category %q", category)
 			}
+			categories = []pb.HarmCategory{harm}
+		}
+
+		for _, harm := range categories {
+			settings = setThreshold(settings, harm, pb.SafetySetting_HarmBlockThreshold(value))
 		}
 	}
+	return settings, nil
+}
 
-	result := strings.TrimSpace(answer.String())
-	if result == "" {
-		return "", fmt.Errorf("no text content in Gemini response")
+// setThreshold sets the threshold of category in settings, replacing an earlier one
+func setThreshold(settings []*pb.SafetySetting, category pb.HarmCategory, threshold pb.SafetySetting_HarmBlockThreshold) []*pb.SafetySetting {
+	for _, setting := range settings {
+		if setting.Category == category {
+			setting.Threshold = threshold
+			return settings
+		}
+	}
+	return append(settings, &pb.SafetySetting{Category: category, Threshold: threshold})
+}
+
+func containsCategory(categories []pb.HarmCategory, category pb.HarmCategory) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
 	}
+	return false
+}
 
-	fmt.Printf("Generated answer: %s\n", result) // Debug log
-	return result, nil
+// geminiConfig converts the set generation parameters, leaving the rest to Gemini's defaults
+func geminiConfig(params GenerationParams) *pb.GenerationConfig {
+	config := &pb.GenerationConfig{}
+	if params.Temperature != nil {
+		temp := float32(*params.Temperature)
+		config.Temperature = &temp
+	}
+	if params.TopP != nil {
+		topP := float32(*params.TopP)
+		config.TopP = &topP
+	}
+	if params.TopK != nil {
+		topK := int32(*params.TopK)
+		config.TopK = &topK
+	}
+	if params.MaxTokens > 0 {
+		maxTokens := int32(params.MaxTokens)
+		config.MaxOutputTokens = &maxTokens
+	}
+	return config
 }
 
-func buildPromptWithScores(question string, results []storage.SearchResult) string {
-	var prompt string
-	prompt = fmt.Sprintf("Question: %s\n\nRelevant code context (sorted by similarity):\n", question)
+// geminiTypes maps Schema types to Gemini's
+var geminiTypes = map[string]pb.Type{
+	TypeString:  pb.Type_STRING,
+	TypeNumber:  pb.Type_NUMBER,
+	TypeInteger: pb.Type_INTEGER,
+	TypeBoolean: pb.Type_BOOLEAN,
+	TypeArray:   pb.Type_ARRAY,
+	TypeObject:  pb.Type_OBJECT,
+}
 
-	for _, result := range results {
-		chunk := result.Chunk
-		prompt += fmt.Sprintf("\nFile: %s (Lines %d-%d)\nFunction: %s\nDescription: %s\nRelevance Score: %.2f\n",
-			chunk.FilePath, chunk.StartLine, chunk.EndLine, chunk.Name, chunk.Description, result.Similarity)
+// geminiSchema converts schema to Gemini's schema message
+func geminiSchema(schema *Schema) *pb.Schema {
+	if schema == nil {
+		return nil
+	}
+	converted := &pb.Schema{
+		Type:        geminiTypes[schema.Type],
+		Description: schema.Description,
+		Required:    schema.Required,
+		Enum:        schema.Enum,
+		Items:       geminiSchema(schema.Items),
 	}
+	if len(schema.Enum) > 0 {
+		converted.Format = "enum"
+	}
+	if len(schema.Properties) > 0 {
+		converted.Properties = make(map[string]*pb.Schema, len(schema.Properties))
+		for name, property := range schema.Properties {
+			converted.Properties[name] = geminiSchema(property)
+		}
+	}
+	return converted
+}
+
+// functionResponse wraps a tool result for Gemini, which expects an object: JSON objects are
+// passed as they are and anything else as {"result": content}
+func functionResponse(content string) *structpb.Struct {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &object); err == nil && object != nil {
+		if response, err := structpb.NewStruct(object); err == nil {
+			return response
+		}
+	}
+	response, _ := structpb.NewStruct(map[string]interface{}{"result": content})
+	return response
+}
+
+// geminiResponse converts resp, taking the reply of the candidate selectCandidate picks.
+// Prompts that were blocked have no candidates and are reported as FinishSafety.
+func geminiResponse(resp *pb.GenerateContentResponse) ChatResponse {
+	reply := ChatResponse{Usage: usageFrom(resp.GetUsageMetadata())}
+	if feedback := resp.GetPromptFeedback(); feedback.GetBlockReason() != pb.GenerateContentResponse_PromptFeedback_BLOCK_REASON_UNSPECIFIED {
+		reply.FinishReason = FinishSafety
+		reply.SafetyCategories = blockedCategories(feedback.GetSafetyRatings())
+		return reply
+	}
+
+	candidate := selectCandidate(resp.GetCandidates())
+	reply.Text = candidateText(candidate)
+	reply.ToolCalls = candidateToolCalls(candidate)
+	reply.FinishReason = finishReason(candidate.GetFinishReason())
+	if reply.FinishReason == FinishSafety {
+		reply.SafetyCategories = blockedCategories(candidate.GetSafetyRatings())
+	}
+	return reply
+}
+
+// selectCandidate returns the candidate to reply with: the first that finished with
+// content, or else the first with content, or else the first. Candidates are alternative
+// replies, so they are never merged.
+func selectCandidate(candidates []*pb.Candidate) *pb.Candidate {
+	var partial *pb.Candidate
+	for _, candidate := range candidates {
+		if len(candidate.GetContent().GetParts()) == 0 {
+			continue
+		}
+		if finishReason(candidate.GetFinishReason()) == "" {
+			return candidate
+		}
+		if partial == nil {
+			partial = candidate
+		}
+	}
+	if partial == nil && len(candidates) > 0 {
+		return candidates[0]
+	}
+	return partial
+}
+
+// finishReason converts Gemini's finish reason to a ChatResponse.FinishReason. Candidates
+// still being streamed have none.
+func finishReason(reason pb.Candidate_FinishReason) string {
+	switch reason {
+	case pb.Candidate_FINISH_REASON_UNSPECIFIED, pb.Candidate_STOP:
+		return ""
+	case pb.Candidate_MAX_TOKENS:
+		return FinishMaxTokens
+	case pb.Candidate_SAFETY:
+		return FinishSafety
+	case pb.Candidate_RECITATION:
+		return FinishRecitation
+	default:
+		return FinishOther
+	}
+}
+
+// blockedCategories returns the categories of the ratings that blocked a prompt or reply,
+// e.g. "dangerous_content"
+func blockedCategories(ratings []*pb.SafetyRating) []string {
+	var categories []string
+	for _, rating := range ratings {
+		if rating.GetBlocked() {
+			categories = append(categories, strings.ToLower(strings.TrimPrefix(rating.GetCategory().String(), "HARM_CATEGORY_")))
+		}
+	}
+	return categories
+}
 
-	prompt += "\nBased on the code context above, with consideration for the relevance scores, please provide a clear and concise answer to the question."
+// candidateToolCalls returns the function calls in candidate. Gemini does not identify
+// calls, so they are numbered in order.
+func candidateToolCalls(candidate *pb.Candidate) []ToolCall {
+	var calls []ToolCall
+	for _, part := range candidate.GetContent().GetParts() {
+		if call := part.GetFunctionCall(); call != nil {
+			calls = append(calls, ToolCall{ID: toolCallID(len(calls)), Name: call.Name, Args: call.GetArgs().AsMap()})
+		}
+	}
+	return calls
+}
 
-	return prompt
+// candidateText returns the text parts of candidate. They are pieces of one reply, so they
+// are joined as they are.
+func candidateText(candidate *pb.Candidate) string {
+	var text strings.Builder
+	for _, part := range candidate.GetContent().GetParts() {
+		text.WriteString(part.GetText())
+	}
+	return strings.TrimSpace(text.String())
+}
+
+func usageFrom(metadata *pb.GenerateContentResponse_UsageMetadata) Usage {
+	return Usage{
+		PromptTokens:    int(metadata.GetPromptTokenCount()),
+		CandidateTokens: int(metadata.GetCandidatesTokenCount()),
+		TotalTokens:     int(metadata.GetTotalTokenCount()),
+	}
+}
+
+// collectStream reads responses from recv until io.EOF, passing the text of each to onToken.
+// Only the first candidate is streamed. It returns the full text, the usage reported last,
+// which covers the whole response, and how the candidate finished.
+func collectStream(recv func() (*pb.GenerateContentResponse, error), onToken func(string) error) (ChatResponse, error) {
+	var text strings.Builder
+	var reply ChatResponse
+	for {
+		resp, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, fmt.Errorf("Gemini API error: %w", err)
+		}
+
+		if metadata := resp.GetUsageMetadata(); metadata != nil {
+			reply.Usage = usageFrom(metadata)
+		}
+		if feedback := resp.GetPromptFeedback(); feedback.GetBlockReason() != pb.GenerateContentResponse_PromptFeedback_BLOCK_REASON_UNSPECIFIED {
+			reply.FinishReason = FinishSafety
+			reply.SafetyCategories = blockedCategories(feedback.GetSafetyRatings())
+		}
+
+		// Streamed pieces split words, so they are joined as they are
+		var piece strings.Builder
+		for _, candidate := range resp.GetCandidates() {
+			if candidate.GetIndex() != 0 {
+				continue
+			}
+			for _, part := range candidate.GetContent().GetParts() {
+				piece.WriteString(part.GetText())
+			}
+			if reason := finishReason(candidate.GetFinishReason()); reason != "" {
+				reply.FinishReason = reason
+				if reason == FinishSafety {
+					reply.SafetyCategories = blockedCategories(candidate.GetSafetyRatings())
+				}
+			}
+		}
+		if piece.Len() == 0 {
+			continue
+		}
+		text.WriteString(piece.String())
+		if err := onToken(piece.String()); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	reply.Text = text.String()
+	return reply, nil
 }
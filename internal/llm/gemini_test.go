@@ -0,0 +1,310 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func textResponse(text string) *pb.GenerateContentResponse {
+	return &pb.GenerateContentResponse{
+		Candidates: []*pb.Candidate{{
+			Content: &pb.Content{Parts: []*pb.Part{{Data: &pb.Part_Text{Text: text}}}},
+		}},
+	}
+}
+
+// replay returns a recv function yielding responses and then err
+func replay(err error, responses ...*pb.GenerateContentResponse) func() (*pb.GenerateContentResponse, error) {
+	return func() (*pb.GenerateContentResponse, error) {
+		if len(responses) == 0 {
+			return nil, err
+		}
+		resp := responses[0]
+		responses = responses[1:]
+		return resp, nil
+	}
+}
+
+func TestCollectStream(t *testing.T) {
+	last := textResponse("ens [1].")
+	last.UsageMetadata = &pb.GenerateContentResponse_UsageMetadata{
+		PromptTokenCount:     120,
+		CandidatesTokenCount: 9,
+		TotalTokenCount:      129,
+	}
+	abort := errors.New("client went away")
+
+	tests := []struct {
+		name       string
+		recv       func() (*pb.GenerateContentResponse, error)
+		onTokenErr error
+		wantText   string
+		wantTokens []string
+		wantUsage  Usage
+		wantFinish string
+		wantErr    error
+	}{
+		{
+			name:       "joins pieces without separators",
+			recv:       replay(io.EOF, textResponse("It validates tok"), &pb.GenerateContentResponse{}, last),
+			wantText:   "It validates tokens [1].",
+			wantTokens: []string{"It validates tok", "ens [1]."},
+			wantUsage:  Usage{PromptTokens: 120, CandidateTokens: 9, TotalTokens: 129},
+		},
+		{
+			name: "empty stream",
+			recv: replay(io.EOF),
+		},
+		{
+			name:       "reports how the candidate finished",
+			recv:       replay(io.EOF, textResponse("It validates tok"), &pb.GenerateContentResponse{Candidates: []*pb.Candidate{candidate("ens", pb.Candidate_MAX_TOKENS)}}),
+			wantText:   "It validates tokens",
+			wantTokens: []string{"It validates tok", "ens"},
+			wantFinish: FinishMaxTokens,
+		},
+		{
+			name:    "stream error",
+			recv:    replay(errors.New("unavailable")),
+			wantErr: errors.New("Gemini API error: unavailable"),
+		},
+		{
+			name:       "stops when onToken fails",
+			recv:       replay(io.EOF, textResponse("It"), textResponse(" validates")),
+			onTokenErr: abort,
+			wantTokens: []string{"It"},
+			wantErr:    abort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens []string
+			resp, err := collectStream(tt.recv, func(token string) error {
+				tokens = append(tokens, token)
+				return tt.onTokenErr
+			})
+
+			assert.Equal(t, tt.wantTokens, tokens)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, ChatResponse{Text: tt.wantText, Usage: tt.wantUsage, FinishReason: tt.wantFinish}, resp)
+		})
+	}
+}
+
+func TestGeminiRequest(t *testing.T) {
+	req := geminiRequest(ChatRequest{
+		Messages: []ChatMessage{
+			{Role: RoleSystem, Content: "Answer briefly."},
+			{Role: RoleUser, Content: "What does Parse do?"},
+			{Role: RoleAssistant, Content: "It parses Go files."},
+			{Role: RoleUser, Content: "Where is it called?"},
+		},
+		Params: GenerationParams{Model: "gemini-1.5-pro", Temperature: float64Ptr(0.5), MaxTokens: 256},
+	})
+
+	assert.Equal(t, "models/gemini-1.5-pro", req.Model)
+	var roles, texts []string
+	for _, content := range req.Contents {
+		roles = append(roles, content.Role)
+		texts = append(texts, content.Parts[0].GetText())
+	}
+	assert.Equal(t, []string{"user", "model", "user"}, roles)
+	assert.Equal(t, "What does Parse do?", texts[0])
+	assert.Equal(t, "Answer briefly.", req.SystemInstruction.Parts[0].GetText())
+	assert.Equal(t, float32(0.5), req.GenerationConfig.GetTemperature())
+	assert.Equal(t, int32(256), req.GenerationConfig.GetMaxOutputTokens())
+	assert.Nil(t, req.GenerationConfig.TopK)
+
+	assert.Equal(t, DefaultGeminiModel, geminiRequest(ChatRequest{}).Model)
+}
+
+func TestGeminiRequestTools(t *testing.T) {
+	req := geminiRequest(ChatRequest{
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "Who calls Apply?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "call_1", Name: "find_callers", Args: map[string]interface{}{"name": "Apply"}},
+				{ID: "call_2", Name: "get_symbol", Args: map[string]interface{}{"symbol": "Apply"}},
+			}},
+			{Role: RoleTool, ToolCallID: "call_1", Name: "find_callers", Content: "Total in cart.go"},
+			{Role: RoleTool, ToolCallID: "call_2", Name: "get_symbol", Content: `{"found": true}`},
+		},
+		Tools: []Tool{{
+			Name:        "find_callers",
+			Description: "Find callers",
+			Parameters: &Schema{
+				Type:       TypeObject,
+				Properties: map[string]*Schema{"name": {Type: TypeString}},
+				Required:   []string{"name"},
+			},
+		}},
+	})
+
+	assert.Nil(t, req.SystemInstruction)
+	assert.Len(t, req.Contents, 3)
+	assert.Equal(t, "model", req.Contents[1].Role)
+	assert.Equal(t, "find_callers", req.Contents[1].Parts[0].GetFunctionCall().Name)
+	assert.Equal(t, "Apply", req.Contents[1].Parts[0].GetFunctionCall().Args.AsMap()["name"])
+
+	results := req.Contents[2].Parts
+	assert.Len(t, results, 2)
+	assert.Equal(t, map[string]interface{}{"result": "Total in cart.go"}, results[0].GetFunctionResponse().Response.AsMap())
+	assert.Equal(t, map[string]interface{}{"found": true}, results[1].GetFunctionResponse().Response.AsMap())
+
+	declaration := req.Tools[0].FunctionDeclarations[0]
+	assert.Equal(t, "find_callers", declaration.Name)
+	assert.Equal(t, pb.Type_OBJECT, declaration.Parameters.Type)
+	assert.Equal(t, pb.Type_STRING, declaration.Parameters.Properties["name"].Type)
+	assert.Equal(t, []string{"name"}, declaration.Parameters.Required)
+}
+
+func candidate(text string, reason pb.Candidate_FinishReason) *pb.Candidate {
+	c := &pb.Candidate{FinishReason: reason}
+	if text != "" {
+		c.Content = &pb.Content{Parts: []*pb.Part{{Data: &pb.Part_Text{Text: text}}}}
+	}
+	return c
+}
+
+func TestGeminiResponse(t *testing.T) {
+	blocked := []*pb.SafetyRating{
+		{Category: pb.HarmCategory_HARM_CATEGORY_HARASSMENT, Probability: pb.SafetyRating_LOW},
+		{Category: pb.HarmCategory_HARM_CATEGORY_DANGEROUS_CONTENT, Probability: pb.SafetyRating_HIGH, Blocked: true},
+	}
+
+	tests := []struct {
+		name string
+		resp *pb.GenerateContentResponse
+		want ChatResponse
+	}{
+		{
+			name: "finished",
+			resp: &pb.GenerateContentResponse{Candidates: []*pb.Candidate{candidate("It parses Go files.", pb.Candidate_STOP)}},
+			want: ChatResponse{Text: "It parses Go files."},
+		},
+		{
+			name: "picks one candidate instead of joining them",
+			resp: &pb.GenerateContentResponse{Candidates: []*pb.Candidate{
+				candidate("It parses", pb.Candidate_MAX_TOKENS),
+				candidate("", pb.Candidate_STOP),
+				candidate("It parses Go files.", pb.Candidate_STOP),
+				candidate("It reads Go files.", pb.Candidate_STOP),
+			}},
+			want: ChatResponse{Text: "It parses Go files."},
+		},
+		{
+			name: "truncated",
+			resp: &pb.GenerateContentResponse{Candidates: []*pb.Candidate{candidate("It parses", pb.Candidate_MAX_TOKENS)}},
+			want: ChatResponse{Text: "It parses", FinishReason: FinishMaxTokens},
+		},
+		{
+			name: "blocked reply",
+			resp: &pb.GenerateContentResponse{Candidates: []*pb.Candidate{{FinishReason: pb.Candidate_SAFETY, SafetyRatings: blocked}}},
+			want: ChatResponse{FinishReason: FinishSafety, SafetyCategories: []string{"dangerous_content"}},
+		},
+		{
+			name: "blocked prompt",
+			resp: &pb.GenerateContentResponse{PromptFeedback: &pb.GenerateContentResponse_PromptFeedback{
+				BlockReason:   pb.GenerateContentResponse_PromptFeedback_SAFETY,
+				SafetyRatings: blocked,
+			}},
+			want: ChatResponse{FinishReason: FinishSafety, SafetyCategories: []string{"dangerous_content"}},
+		},
+		{
+			name: "recitation",
+			resp: &pb.GenerateContentResponse{Candidates: []*pb.Candidate{candidate("", pb.Candidate_RECITATION)}},
+			want: ChatResponse{FinishReason: FinishRecitation},
+		},
+		{
+			name: "no candidates",
+			resp: &pb.GenerateContentResponse{},
+			want: ChatResponse{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, geminiResponse(tt.resp))
+		})
+	}
+}
+
+func TestGeminiResponseToolCalls(t *testing.T) {
+	args, _ := structpb.NewStruct(map[string]interface{}{"path": "cart.go", "start": 1.0})
+	resp := &pb.GenerateContentResponse{
+		Candidates: []*pb.Candidate{{
+			Content: &pb.Content{Parts: []*pb.Part{
+				{Data: &pb.Part_Text{Text: "Let me look."}},
+				{Data: &pb.Part_FunctionCall{FunctionCall: &pb.FunctionCall{Name: "get_file_lines", Args: args}}},
+			}},
+		}},
+	}
+
+	reply := geminiResponse(resp)
+	assert.Equal(t, []ToolCall{{ID: "call_1", Name: "get_file_lines", Args: map[string]interface{}{"path": "cart.go", "start": 1.0}}}, reply.ToolCalls)
+	assert.Equal(t, "Let me look.", reply.Text)
+}
+
+func TestParseSafetySettings(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []*pb.SafetySetting
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "harassment=block_only_high,HARM_CATEGORY_DANGEROUS_CONTENT=BLOCK_NONE", want: []*pb.SafetySetting{
+			{Category: pb.HarmCategory_HARM_CATEGORY_HARASSMENT, Threshold: pb.SafetySetting_BLOCK_ONLY_HIGH},
+			{Category: pb.HarmCategory_HARM_CATEGORY_DANGEROUS_CONTENT, Threshold: pb.SafetySetting_BLOCK_NONE},
+		}},
+		{spec: "block_medium_and_above, hate_speech=block_low_and_above", want: []*pb.SafetySetting{
+			{Category: pb.HarmCategory_HARM_CATEGORY_HARASSMENT, Threshold: pb.SafetySetting_BLOCK_MEDIUM_AND_ABOVE},
+			{Category: pb.HarmCategory_HARM_CATEGORY_HATE_SPEECH, Threshold: pb.SafetySetting_BLOCK_LOW_AND_ABOVE},
+			{Category: pb.HarmCategory_HARM_CATEGORY_SEXUALLY_EXPLICIT, Threshold: pb.SafetySetting_BLOCK_MEDIUM_AND_ABOVE},
+			{Category: pb.HarmCategory_HARM_CATEGORY_DANGEROUS_CONTENT, Threshold: pb.SafetySetting_BLOCK_MEDIUM_AND_ABOVE},
+		}},
+		{spec: "harassment=block_some", wantErr: true},
+		{spec: "harassment=harm_block_threshold_unspecified", wantErr: true},
+		{spec: "medical=block_none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSafetySettings(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.want), len(got))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].Category, got[i].Category)
+				assert.Equal(t, tt.want[i].Threshold, got[i].Threshold)
+			}
+		})
+	}
+
+	// Settings are sent with every request, replacing Gemini's defaults only when set
+	safety, _ := ParseSafetySettings("block_none")
+	assert.Len(t, (&GeminiChat{safety: safety}).request(ChatRequest{}).SafetySettings, 4)
+	assert.Nil(t, (&GeminiChat{}).request(ChatRequest{}).SafetySettings)
+}
+
+func TestGeminiRequestResponseSchema(t *testing.T) {
+	req := geminiRequest(ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: "Q"}}, ResponseSchema: AnswerSchema})
+
+	assert.Equal(t, "application/json", req.GenerationConfig.ResponseMimeType)
+	assert.Equal(t, pb.Type_OBJECT, req.GenerationConfig.ResponseSchema.Type)
+	assert.Equal(t, pb.Type_INTEGER, req.GenerationConfig.ResponseSchema.Properties["citations"].Items.Type)
+	assert.Equal(t, AnswerSchema.Required, req.GenerationConfig.ResponseSchema.Required)
+
+	assert.Empty(t, geminiRequest(ChatRequest{}).GenerationConfig.ResponseMimeType)
+}
@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultOllamaModel is the model used with Ollama when none is configured.
+const DefaultOllamaModel = "llama3.1"
+
+// OllamaChat generates replies with a local Ollama server.
+type OllamaChat struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOllamaChat creates a chat model for the Ollama server at baseURL (e.g. http://localhost:11434).
+func NewOllamaChat(baseURL string) *OllamaChat {
+	return &OllamaChat{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  newChatHTTPClient(),
+	}
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	// ToolName names the tool whose result a tool message carries
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	// Tools use the OpenAI format
+	Tools []openAITool `json:"tools,omitempty"`
+	// Format constrains the reply to JSON conforming to a schema
+	Format *Schema `json:"format,omitempty"`
+	// Stream must always be sent, Ollama streams by default
+	Stream  bool          `json:"stream"`
+	Options ollamaOptions `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (o *OllamaChat) Generate(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := o.post(ctx, o.request(req, false))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var reply ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to decode Ollama response: %w", err)
+	}
+	if reply.Error != "" {
+		return ChatResponse{}, fmt.Errorf("Ollama API error: %s", reply.Error)
+	}
+	// Ollama does not identify tool calls, so they are numbered in order
+	var calls []ToolCall
+	for _, call := range reply.Message.ToolCalls {
+		calls = append(calls, ToolCall{ID: toolCallID(len(calls)), Name: call.Function.Name, Args: call.Function.Arguments})
+	}
+	return ChatResponse{Text: reply.Message.Content, ToolCalls: calls, Usage: reply.usage(), FinishReason: reply.finishReason()}, nil
+}
+
+// Stream reads the newline-delimited JSON replies until the one marked done, which carries the token counts
+func (o *OllamaChat) Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := o.post(ctx, o.request(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage Usage
+	var finish string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var reply ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+			return ChatResponse{}, fmt.Errorf("failed to decode Ollama stream reply: %w", err)
+		}
+		if reply.Error != "" {
+			return ChatResponse{}, fmt.Errorf("Ollama API error: %s", reply.Error)
+		}
+		if content := reply.Message.Content; content != "" {
+			text.WriteString(content)
+			if err := onToken(content); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+		if reply.Done {
+			usage = reply.usage()
+			finish = reply.finishReason()
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to read Ollama stream: %w", err)
+	}
+	return ChatResponse{Text: text.String(), Usage: usage, FinishReason: finish}, nil
+}
+
+func (o *OllamaChat) request(req ChatRequest, stream bool) ollamaRequest {
+	model := req.Params.Model
+	if model == "" {
+		model = DefaultOllamaModel
+	}
+
+	body := ollamaRequest{
+		Model:  model,
+		Stream: stream,
+		Format: req.ResponseSchema,
+		Options: ollamaOptions{
+			Temperature: req.Params.Temperature,
+			TopP:        req.Params.TopP,
+			TopK:        req.Params.TopK,
+			NumPredict:  req.Params.MaxTokens,
+		},
+	}
+	for _, message := range req.Messages {
+		converted := ollamaMessage{Role: message.Role, Content: message.Content, ToolName: message.Name}
+		for _, call := range message.ToolCalls {
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = call.Args
+			converted.ToolCalls = append(converted.ToolCalls, toolCall)
+		}
+		body.Messages = append(body.Messages, converted)
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{
+			Type:     "function",
+			Function: openAIToolFunction{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+	return body
+}
+
+func (o *OllamaChat) post(ctx context.Context, body ollamaRequest) (*http.Response, error) {
+	resp, err := postJSON(ctx, o.client, o.baseURL+"/api/chat", nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama API error: %w", err)
+	}
+	return resp, nil
+}
+
+func (r ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:    r.PromptEvalCount,
+		CandidateTokens: r.EvalCount,
+		TotalTokens:     r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// finishReason reports replies cut off at num_predict; Ollama has no safety filters
+func (r ollamaResponse) finishReason() string {
+	if r.DoneReason == "length" {
+		return FinishMaxTokens
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOllamaChatGenerate(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		fmt.Fprint(w, `{"message": {"role": "assistant", "content": "It parses Go files."}, "done": true,
+			"prompt_eval_count": 40, "eval_count": 6}`)
+	}))
+	defer server.Close()
+
+	topK := 20
+	chat := NewOllamaChat(server.URL)
+	resp, err := chat.Generate(context.Background(), userPrompt("Q", GenerationParams{Temperature: float64Ptr(0.2), TopK: &topK, MaxTokens: 128}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, ChatResponse{Text: "It parses Go files.", Usage: Usage{PromptTokens: 40, CandidateTokens: 6, TotalTokens: 46}}, resp)
+	assert.Equal(t, DefaultOllamaModel, got["model"])
+	assert.Equal(t, false, got["stream"])
+	assert.Equal(t, map[string]interface{}{"temperature": 0.2, "top_k": 20.0, "num_predict": 128.0}, got["options"])
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "It par"}, "done": false}`)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "ses Go files."}, "done": false}`)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 40, "eval_count": 6}`)
+	}))
+	defer server.Close()
+
+	var tokens []string
+	resp, err := NewOllamaChat(server.URL).Stream(context.Background(), userPrompt("Q", GenerationParams{}), func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"It par", "ses Go files."}, tokens)
+	assert.Equal(t, ChatResponse{Text: "It parses Go files.", Usage: Usage{PromptTokens: 40, CandidateTokens: 6, TotalTokens: 46}}, resp)
+}
+
+func TestOllamaChatTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "It par"}, "done": false}`)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "length"}`)
+	}))
+	defer server.Close()
+
+	resp, err := NewOllamaChat(server.URL).Stream(context.Background(), userPrompt("Q", GenerationParams{MaxTokens: 2}), func(string) error { return nil })
+
+	assert.NoError(t, err)
+	assert.Equal(t, "It par", resp.Text)
+	assert.Equal(t, FinishMaxTokens, resp.FinishReason)
+}
+
+func TestOllamaChatStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"error": "model \"llama9\" not found"}`)
+	}))
+	defer server.Close()
+
+	_, err := NewOllamaChat(server.URL).Stream(context.Background(), userPrompt("Q", GenerationParams{Model: "llama9"}), func(string) error { return nil })
+
+	assert.EqualError(t, err, `Ollama API error: model "llama9" not found`)
+}
+
+func TestOllamaChatTools(t *testing.T) {
+	var got ollamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		fmt.Fprint(w, `{"message": {"role": "assistant", "content": "", "tool_calls": [
+			{"function": {"name": "list_package", "arguments": {"package": "shop"}}}]}, "done": true}`)
+	}))
+	defer server.Close()
+
+	resp, err := NewOllamaChat(server.URL).Generate(context.Background(), ChatRequest{
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "Q"},
+			{Role: RoleTool, ToolCallID: "call_1", Name: "search_code", Content: "no results"},
+		},
+		Tools: []Tool{{Name: "list_package", Parameters: &Schema{Type: TypeObject}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ToolCall{{ID: "call_1", Name: "list_package", Args: map[string]interface{}{"package": "shop"}}}, resp.ToolCalls)
+	assert.Equal(t, "search_code", got.Messages[1].ToolName)
+	assert.Equal(t, "list_package", got.Tools[0].Function.Name)
+}
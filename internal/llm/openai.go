@@ -0,0 +1,257 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultOpenAIModel is the model used with OpenAI-compatible APIs when none is configured.
+const DefaultOpenAIModel = "gpt-4o-mini"
+
+// OpenAIChat generates replies with an OpenAI-compatible chat completions API, such as
+// OpenAI itself, Azure OpenAI, vLLM or LM Studio.
+type OpenAIChat struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewOpenAIChat creates a chat model for the API at baseURL (e.g. https://api.openai.com/v1).
+// apiKey may be empty for local servers that do not require one.
+func NewOpenAIChat(baseURL, apiKey string) *OpenAIChat {
+	return &OpenAIChat{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  newChatHTTPClient(),
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments is a JSON object encoded as a string
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Parameters  *Schema `json:"parameters,omitempty"`
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	Tools          []openAITool          `json:"tools,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string  `json:"name"`
+		Schema *Schema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func (o *OpenAIChat) Generate(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := o.post(ctx, o.request(req, false))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var completion openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to decode OpenAI response: %w", err)
+	}
+
+	// Choices are alternative replies; only one is requested
+	reply := ChatResponse{Usage: completion.usage()}
+	if len(completion.Choices) == 0 {
+		return reply, nil
+	}
+	choice := completion.Choices[0]
+	reply.Text = choice.Message.Content
+	reply.FinishReason = openAIFinishReason(choice.FinishReason)
+	for _, call := range choice.Message.ToolCalls {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return ChatResponse{}, fmt.Errorf("failed to decode arguments of tool call %s: %w", call.Function.Name, err)
+		}
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Args: args})
+	}
+	return reply, nil
+}
+
+// Stream reads the server-sent completion chunks until the [DONE] marker
+func (o *OpenAIChat) Stream(ctx context.Context, req ChatRequest, onToken func(string) error) (ChatResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := o.post(ctx, o.request(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage Usage
+	var finish string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return ChatResponse{}, fmt.Errorf("failed to decode OpenAI stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finish = openAIFinishReason(choice.FinishReason)
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			if err := onToken(choice.Delta.Content); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to read OpenAI stream: %w", err)
+	}
+	return ChatResponse{Text: text.String(), Usage: usage, FinishReason: finish}, nil
+}
+
+// openAIFinishReason converts a choice's finish_reason to a ChatResponse.FinishReason
+func openAIFinishReason(reason string) string {
+	switch reason {
+	case "", "stop", "tool_calls", "function_call":
+		return ""
+	case "length":
+		return FinishMaxTokens
+	case "content_filter":
+		return FinishSafety
+	default:
+		return FinishOther
+	}
+}
+
+// request converts req to a chat completions request; OpenAI has no top-k sampling
+func (o *OpenAIChat) request(req ChatRequest, stream bool) openAIRequest {
+	model := req.Params.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	body := openAIRequest{
+		Model:       model,
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+		MaxTokens:   req.Params.MaxTokens,
+		Stream:      stream,
+	}
+	for _, message := range req.Messages {
+		converted := openAIMessage{Role: message.Role, Content: message.Content, ToolCallID: message.ToolCallID}
+		for _, call := range message.ToolCalls {
+			args, _ := json.Marshal(call.Args)
+			toolCall := openAIToolCall{ID: call.ID, Type: "function"}
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = string(args)
+			converted.ToolCalls = append(converted.ToolCalls, toolCall)
+		}
+		body.Messages = append(body.Messages, converted)
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{
+			Type:     "function",
+			Function: openAIToolFunction{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+	if req.ResponseSchema != nil {
+		body.ResponseFormat = &openAIResponseFormat{Type: "json_schema"}
+		body.ResponseFormat.JSONSchema.Name = "response"
+		body.ResponseFormat.JSONSchema.Schema = req.ResponseSchema
+	}
+	if stream {
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	return body
+}
+
+func (o *OpenAIChat) post(ctx context.Context, body openAIRequest) (*http.Response, error) {
+	header := http.Header{}
+	if o.apiKey != "" {
+		header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	resp, err := postJSON(ctx, o.client, o.baseURL+"/chat/completions", header, body)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API error: %w", err)
+	}
+	return resp, nil
+}
+
+func (r openAIResponse) usage() Usage {
+	if r.Usage == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:    r.Usage.PromptTokens,
+		CandidateTokens: r.Usage.CompletionTokens,
+		TotalTokens:     r.Usage.TotalTokens,
+	}
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIChatGenerate(t *testing.T) {
+	var got openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "It parses Go files [1]."}}],
+			"usage": {"prompt_tokens": 50, "completion_tokens": 8, "total_tokens": 58}}`)
+	}))
+	defer server.Close()
+
+	chat := NewOpenAIChat(server.URL+"/v1/", "sk-test")
+	resp, err := chat.Generate(context.Background(), userPrompt("What does Parse do?", GenerationParams{Temperature: float64Ptr(0), MaxTokens: 64}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, ChatResponse{Text: "It parses Go files [1].", Usage: Usage{PromptTokens: 50, CandidateTokens: 8, TotalTokens: 58}}, resp)
+	assert.Equal(t, DefaultOpenAIModel, got.Model)
+	assert.Equal(t, []openAIMessage{{Role: RoleUser, Content: "What does Parse do?"}}, got.Messages)
+	assert.Equal(t, float64Ptr(0), got.Temperature)
+	assert.Equal(t, 64, got.MaxTokens)
+	assert.False(t, got.Stream)
+	assert.Nil(t, got.ResponseFormat)
+}
+
+func TestOpenAIChatFinishReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"stop", ""},
+		{"tool_calls", ""},
+		{"length", FinishMaxTokens},
+		{"content_filter", FinishSafety},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": "It parses"}, "finish_reason": %q},
+					{"message": {"role": "assistant", "content": "It reads"}}]}`, tt.reason)
+			}))
+			defer server.Close()
+
+			resp, err := NewOpenAIChat(server.URL, "").Generate(context.Background(), userPrompt("Q", GenerationParams{}))
+
+			assert.NoError(t, err)
+			// Only the first choice is used
+			assert.Equal(t, "It parses", resp.Text)
+			assert.Equal(t, tt.want, resp.FinishReason)
+		})
+	}
+}
+
+func TestOpenAIChatResponseSchema(t *testing.T) {
+	body := NewOpenAIChat("http://localhost", "").request(ChatRequest{ResponseSchema: AnswerSchema}, false)
+
+	assert.Equal(t, "json_schema", body.ResponseFormat.Type)
+	assert.Equal(t, AnswerSchema, body.ResponseFormat.JSONSchema.Schema)
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		assert.Equal(t, "local-model", req.Model)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"role\": \"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"It par\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"ses Go files.\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 50, \"completion_tokens\": 6, \"total_tokens\": 56}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var tokens []string
+	chat := NewOpenAIChat(server.URL, "")
+	resp, err := chat.Stream(context.Background(), userPrompt("Q", GenerationParams{Model: "local-model"}), func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"It par", "ses Go files."}, tokens)
+	assert.Equal(t, ChatResponse{Text: "It parses Go files.", Usage: Usage{PromptTokens: 50, CandidateTokens: 6, TotalTokens: 56}}, resp)
+}
+
+func TestOpenAIChatError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "invalid model"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAIChat(server.URL, "").Generate(context.Background(), userPrompt("Q", GenerationParams{}))
+
+	assert.ErrorContains(t, err, "400 Bad Request")
+	assert.ErrorContains(t, err, "invalid model")
+}
+
+func TestOpenAIChatTools(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [
+			{"id": "call_abc", "type": "function", "function": {"name": "get_symbol", "arguments": "{\"symbol\": \"Total\"}"}}]}}]}`)
+	}))
+	defer server.Close()
+
+	resp, err := NewOpenAIChat(server.URL, "").Generate(context.Background(), ChatRequest{
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "Q"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "search_code", Args: map[string]interface{}{"query": "cart"}}}},
+			{Role: RoleTool, ToolCallID: "call_1", Name: "search_code", Content: "Total in cart.go"},
+		},
+		Tools: []Tool{{Name: "get_symbol", Description: "Look up a symbol", Parameters: &Schema{Type: TypeObject}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ToolCall{{ID: "call_abc", Name: "get_symbol", Args: map[string]interface{}{"symbol": "Total"}}}, resp.ToolCalls)
+
+	messages := got["messages"].([]interface{})
+	call := messages[1].(map[string]interface{})["tool_calls"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "call_1", call["id"])
+	assert.Equal(t, map[string]interface{}{"name": "search_code", "arguments": `{"query":"cart"}`}, call["function"])
+	assert.Equal(t, "call_1", messages[2].(map[string]interface{})["tool_call_id"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": "get_symbol", "description": "Look up a symbol", "parameters": map[string]interface{}{"type": "object"}},
+	}}, got["tools"])
+}
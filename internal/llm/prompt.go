@@ -0,0 +1,244 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"intelligent-doc-assistant/internal/guardrails"
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// DefaultPromptTokenBudget is the default number of tokens of code context sent with a question
+const DefaultPromptTokenBudget = 6000
+
+// historyBudgetDivisor divides the token budget to give the share conversation history may use
+const historyBudgetDivisor = 4
+
+// minTrimmedTokens is the smallest share of the budget worth spending on a truncated chunk;
+// below it the chunk is summarised by its signature instead
+const minTrimmedTokens = 64
+
+// DefaultPromptTemplate renders the question and code context. Custom templates receive
+// the same PromptData.
+const DefaultPromptTemplate = `{{if .History}}Conversation so far (the question may follow up on it):
+{{range .History}}{{if eq .Role "user"}}User{{else}}Assistant{{end}}: {{.Content}}
+{{end}}
+{{end}}Question: {{.Question}}
+
+Relevant code context (most relevant first):
+{{range .Chunks}}
+[{{.Number}}] File: {{.FilePath}} (Lines {{.StartLine}}-{{.EndLine}})
+Function: {{.Name}}
+{{- if .Description}}
+Description: {{.Description}}
+{{- end}}
+Relevance Score: {{printf "%.2f" .Score}}
+{{- if .Warning}}
+Warning: {{.Warning}}
+{{- end}}
+{{- if .Content}}
+` + "```go" + `
+{{.Content}}
+` + "```" + `
+{{- end}}
+{{end}}
+Based on the code context above, with consideration for the relevance scores, please provide a clear and concise answer to the question.
+Cite the snippets your answer relies on by their numbers in square brackets, for example [1] or [2, 3]. Only cite snippets listed above.`
+
+// PromptData is passed to prompt templates.
+type PromptData struct {
+	Question string
+	// History holds the earlier messages of the conversation that fit the budget, oldest first
+	History []session.Message
+	Chunks  []PromptChunk
+}
+
+// PromptChunk is one retrieved chunk as presented to the model.
+type PromptChunk struct {
+	// Number identifies the chunk in citations, starting at 1
+	Number      int
+	Repo        string
+	Commit      string
+	FilePath    string
+	StartLine   int
+	EndLine     int
+	Name        string
+	Symbol      string
+	Description string
+	Score       float64
+	// Content is the chunk source, possibly truncated or reduced to its signature
+	Content string
+	// Truncated and Summarized report how Content was cut to fit the token budget
+	Truncated  bool
+	Summarized bool
+	// Warning notes instruction-like text the guardrails found in the chunk, if any
+	Warning string
+}
+
+// LoadPromptTemplate parses the template in path, or DefaultPromptTemplate when path is empty.
+func LoadPromptTemplate(path string) (*template.Template, error) {
+	text := DefaultPromptTemplate
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// buildPrompt renders question, the conversation history and results with tmpl, fitting them
+// into budget tokens, after guard has redacted the secrets in results. It also returns the
+// chunks that made it into the prompt.
+func buildPrompt(tmpl *template.Template, guard *guardrails.Guard, question string, history []session.Message, results []storage.SearchResult, budget int) (string, []PromptChunk, error) {
+	var prompt strings.Builder
+	data := PromptData{Question: question}
+	var historyTokens int
+	data.History, historyTokens = fitHistory(history, budget/historyBudgetDivisor)
+
+	checked := make([]storage.SearchResult, len(results))
+	warnings := make([]string, len(results))
+	for i, result := range results {
+		var findings []guardrails.Finding
+		result.Chunk, findings = guard.Check(guardrails.StagePrompt, result.Chunk)
+		checked[i], warnings[i] = result, guardrails.Warning(findings)
+	}
+	data.Chunks = fitChunks(checked, budget-historyTokens)
+	for i := range data.Chunks {
+		data.Chunks[i].Warning = warnings[i]
+	}
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", nil, fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return prompt.String(), data.Chunks, nil
+}
+
+// fitHistory returns the newest messages of history that fit in budget tokens, and their cost.
+// Citations are removed from earlier answers, since their numbers referred to other sources.
+func fitHistory(history []session.Message, budget int) ([]session.Message, int) {
+	used := 0
+	start := len(history)
+	for start > 0 {
+		cost := estimateTokens(history[start-1].Content)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	messages := make([]session.Message, 0, len(history)-start)
+	for _, message := range history[start:] {
+		if message.Role == session.RoleAssistant {
+			message.Content = stripCitations(message.Content)
+		}
+		messages = append(messages, message)
+	}
+	return messages, used
+}
+
+// fitChunks converts results to prompt chunks in rank order, spending the token budget on
+// source code. Enough budget is held back to show every lower-ranked chunk by its signature;
+// chunks that do not fit whole are truncated or reduced to their signature, and dropped
+// once not even that fits.
+func fitChunks(results []storage.SearchResult, budget int) []PromptChunk {
+	chunks := make([]PromptChunk, len(results))
+	overheads := make([]int, len(results))
+	// reserve[i] is the cost of summarising results[i:]
+	reserve := make([]int, len(results)+1)
+	for i := len(results) - 1; i >= 0; i-- {
+		chunk := results[i].Chunk
+		chunks[i] = PromptChunk{
+			Number:      i + 1,
+			Repo:        chunk.Repo,
+			Commit:      chunk.Commit,
+			FilePath:    chunk.FilePath,
+			StartLine:   chunk.StartLine,
+			EndLine:     chunk.EndLine,
+			Name:        chunk.Name,
+			Symbol:      chunk.Symbol,
+			Description: chunk.Description,
+			Score:       results[i].Similarity,
+		}
+		overheads[i] = estimateTokens(chunk.FilePath + chunk.Name + chunk.Description)
+		reserve[i] = reserve[i+1] + overheads[i] + estimateTokens(signature(chunk.Content))
+	}
+
+	remaining := budget
+	for i, result := range results {
+		pc := &chunks[i]
+		content := result.Chunk.Content
+		available := remaining - reserve[i+1] - overheads[i]
+
+		switch {
+		case estimateTokens(content) <= available:
+			pc.Content = content
+		case available >= minTrimmedTokens:
+			pc.Content = truncateToTokens(content, available)
+			pc.Truncated = true
+		default:
+			pc.Content = signature(content)
+			pc.Summarized = true
+		}
+
+		cost := overheads[i] + estimateTokens(pc.Content)
+		if cost > remaining {
+			return chunks[:i]
+		}
+		remaining -= cost
+	}
+	return chunks
+}
+
+// estimateTokens approximates LLM tokenizers at four characters per token, which
+// is close for English and Go source and avoids a CountTokens round trip per chunk
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// cutAtRune returns at most the first n bytes of text, backing up to a rune boundary so the
+// result stays valid UTF-8, which the Gemini API requires
+func cutAtRune(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// truncateToTokens cuts text at a line boundary so it fits in tokens, marking the cut
+func truncateToTokens(text string, tokens int) string {
+	const marker = "\n\t// ... truncated"
+	limit := tokens*4 - len(marker)
+	if limit <= 0 {
+		return ""
+	}
+	if len(text) <= limit {
+		return text
+	}
+
+	// A single long line has no newline to cut at, so at least keep whole runes
+	cut := cutAtRune(text, limit)
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + marker
+}
+
+// signature returns the first line of a function's source, i.e. its declaration
+func signature(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "{"))
+}
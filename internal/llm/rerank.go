@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"intelligent-doc-assistant/internal/guardrails"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// maxRerankContent limits how much source of each chunk is shown when scoring relevance
+const maxRerankContent = 1500
+
+// ScoreRelevance asks the chat model to rate how well each search result answers question,
+// returning one score between 0 and 10 per result, in order.
+func (c *Client) ScoreRelevance(ctx context.Context, question string, results []storage.SearchResult) ([]float64, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	// Secrets are redacted before the code reaches the model
+	checked := make([]storage.SearchResult, len(results))
+	for i, result := range results {
+		result.Chunk, _ = c.guard.Check(guardrails.StagePrompt, result.Chunk)
+		checked[i] = result
+	}
+
+	// Scoring should be deterministic and the answer is a short JSON array
+	text, err := c.generateText(ctx, buildRerankPrompt(question, checked), GenerationParams{
+		Temperature: float64Ptr(0),
+		MaxTokens:   16 + 8*len(results),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScores(text, len(results))
+}
+
+func buildRerankPrompt(question string, results []storage.SearchResult) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Question: %s\n\nRate how relevant each of the following code snippets is to answering the question, "+
+		"from 0 (irrelevant) to 10 (directly answers it).\n", question)
+
+	for i, result := range results {
+		chunk := result.Chunk
+		content := chunk.Content
+		if len(content) > maxRerankContent {
+			content = cutAtRune(content, maxRerankContent) + "\n..."
+		}
+		fmt.Fprintf(&prompt, "\n[%d] File: %s (Lines %d-%d)\nFunction: %s\nDescription: %s\n%s\n",
+			i+1, chunk.FilePath, chunk.StartLine, chunk.EndLine, chunk.Name, chunk.Description, content)
+	}
+
+	fmt.Fprintf(&prompt, "\nRespond with only a JSON array of %d numbers, one score per snippet in the order given.", len(results))
+	return prompt.String()
+}
+
+// parseScores extracts a JSON array of n numbers from a model response,
+// tolerating surrounding prose or code fences
+func parseScores(text string, n int) ([]float64, error) {
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no score array in response: %q", text)
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(text[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("failed to parse scores: %w", err)
+	}
+	if len(scores) != n {
+		return nil, fmt.Errorf("expected %d scores, got %d", n, len(scores))
+	}
+	return scores, nil
+}
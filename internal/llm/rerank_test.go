@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScores(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		n       int
+		want    []float64
+		wantErr bool
+	}{
+		{"plain array", "[7, 2, 10]", 3, []float64{7, 2, 10}, false},
+		{"code fence", "```json\n[1.5, 0]\n```", 2, []float64{1.5, 0}, false},
+		{"wrong length", "[1, 2]", 3, nil, true},
+		{"no array", "The first snippet is best.", 1, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScores(tt.text, tt.n)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildRerankPromptTruncatesOnRuneBoundary(t *testing.T) {
+	// The limit falls inside the second byte of a three-byte rune
+	content := strings.Repeat("a", maxRerankContent-1) + "€€"
+
+	prompt := buildRerankPrompt("Q", []storage.SearchResult{{Chunk: parser.CodeChunk{Name: "F", Content: content}}})
+
+	assert.True(t, utf8.ValidString(prompt))
+	assert.Contains(t, prompt, strings.Repeat("a", maxRerankContent-1)+"\n...")
+}
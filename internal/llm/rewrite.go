@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QueryRewrite holds alternative phrasings of a question for retrieval.
+type QueryRewrite struct {
+	// Reformulations restate the question in the vocabulary of the code base
+	Reformulations []string `json:"reformulations"`
+	// Identifiers are function, type or package names likely to be involved
+	Identifiers []string `json:"identifiers"`
+	// HypotheticalCode is a short sketch of code that would answer the question (HyDE);
+	// it embeds closer to real function chunks than prose does
+	HypotheticalCode string `json:"code"`
+}
+
+// Queries returns the non-empty search queries of the rewrite, excluding the original question.
+func (r QueryRewrite) Queries() []string {
+	var queries []string
+	for _, q := range r.Reformulations {
+		if q = strings.TrimSpace(q); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if len(r.Identifiers) > 0 {
+		queries = append(queries, strings.Join(r.Identifiers, " "))
+	}
+	if code := strings.TrimSpace(r.HypotheticalCode); code != "" {
+		queries = append(queries, code)
+	}
+	return queries
+}
+
+// RewriteQuery asks the chat model for up to n reformulations of question, the identifiers it
+// probably concerns and a hypothetical code snippet answering it.
+func (c *Client) RewriteQuery(ctx context.Context, question string, n int) (QueryRewrite, error) {
+	// Some variety helps the reformulations cover different vocabulary
+	text, err := c.generateText(ctx, buildRewritePrompt(question, n), GenerationParams{
+		Temperature: float64Ptr(0.7),
+		MaxTokens:   512,
+	})
+	if err != nil {
+		return QueryRewrite{}, err
+	}
+
+	rewrite, err := parseRewrite(text)
+	if err != nil {
+		return QueryRewrite{}, err
+	}
+	if len(rewrite.Reformulations) > n {
+		rewrite.Reformulations = rewrite.Reformulations[:n]
+	}
+	return rewrite, nil
+}
+
+func buildRewritePrompt(question string, n int) string {
+	return fmt.Sprintf(`You help search a Go code base whose functions are indexed by name, doc comment and source.
+Question: %s
+
+Respond with only a JSON object with these fields:
+- "reformulations": up to %d alternative phrasings of the question using terms likely to appear in code or comments
+- "identifiers": function, method, type or package names likely to be involved
+- "code": a short hypothetical Go function that would answer the question`, question, n)
+}
+
+// parseRewrite extracts the JSON object from a model response, tolerating surrounding prose or code fences
+func parseRewrite(text string) (QueryRewrite, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return QueryRewrite{}, fmt.Errorf("no JSON object in response: %q", text)
+	}
+
+	var rewrite QueryRewrite
+	if err := json.Unmarshal([]byte(text[start:end+1]), &rewrite); err != nil {
+		return QueryRewrite{}, fmt.Errorf("failed to parse query rewrite: %w", err)
+	}
+	return rewrite, nil
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRewrite(t *testing.T) {
+	text := "```json\n" + `{
+  "reformulations": ["how are API requests authenticated", "token validation middleware"],
+  "identifiers": ["AuthMiddleware", "ValidateToken"],
+  "code": "func AuthMiddleware(next http.Handler) http.Handler { return next }"
+}` + "\n```"
+
+	got, err := parseRewrite(text)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"how are API requests authenticated",
+		"token validation middleware",
+		"AuthMiddleware ValidateToken",
+		"func AuthMiddleware(next http.Handler) http.Handler { return next }",
+	}, got.Queries())
+
+	_, err = parseRewrite("I cannot help with that.")
+	assert.Error(t, err)
+}
+
+func TestQueryRewriteQueriesSkipsEmpty(t *testing.T) {
+	rewrite := QueryRewrite{Reformulations: []string{" ", "auth flow"}}
+	assert.Equal(t, []string{"auth flow"}, rewrite.Queries())
+}
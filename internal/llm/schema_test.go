@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"name":  {Type: TypeString, Enum: []string{"a", "b"}},
+			"count": {Type: TypeInteger},
+			"ok":    {Type: TypeBoolean},
+			"tags":  {Type: TypeArray, Items: &Schema{Type: TypeString}},
+		},
+		Required: []string{"name"},
+	}
+
+	tests := []struct {
+		json    string
+		wantErr string
+	}{
+		{json: `{"name": "a", "count": 2, "ok": true, "tags": ["x"], "extra": 1}`},
+		{json: `{"count": 2}`, wantErr: "answer.name is required"},
+		{json: `{"name": null}`, wantErr: "answer.name is required"},
+		{json: `{"name": "c"}`, wantErr: "answer.name must be one of [a b]"},
+		{json: `{"name": "a", "count": 2.5}`, wantErr: "answer.count must be an integer"},
+		{json: `{"name": "a", "ok": "yes"}`, wantErr: "answer.ok must be a boolean"},
+		{json: `{"name": "a", "tags": ["x", 1]}`, wantErr: "answer.tags[1] must be a string"},
+		{json: `{"name": "a", "tags": "x"}`, wantErr: "answer.tags must be an array"},
+		{json: `["a"]`, wantErr: "answer must be an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var value interface{}
+			assert.NoError(t, json.Unmarshal([]byte(tt.json), &value))
+
+			err := schema.Validate(value)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
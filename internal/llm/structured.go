@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"intelligent-doc-assistant/internal/session"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// maxStructuredAttempts bounds how often the model is asked for a structured answer
+// before invalid replies are given up on
+const maxStructuredAttempts = 3
+
+// StructuredAnswer is an answer in machine-readable form, as requested with AnswerSchema.
+type StructuredAnswer struct {
+	Summary string          `json:"summary"`
+	Symbols []SymbolMention `json:"symbols"`
+	// Steps explain the answer in order, e.g. the call path of a request
+	Steps   []string `json:"steps"`
+	Caveats []string `json:"caveats"`
+	// Confidence is the model's own estimate between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Citations are the numbers of the sources the answer relies on
+	Citations []int `json:"citations"`
+}
+
+// SymbolMention is a function or method relevant to a structured answer.
+type SymbolMention struct {
+	Symbol   string `json:"symbol"`
+	FilePath string `json:"filePath,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// AnswerSchema is the response schema for StructuredAnswer.
+var AnswerSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"summary": {Type: TypeString, Description: "Direct answer to the question in one to three sentences"},
+		"symbols": {
+			Type:        TypeArray,
+			Description: "Functions and methods relevant to the answer",
+			Items: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"symbol":   {Type: TypeString, Description: "Qualified symbol, e.g. storage.(*Store).StoreChunks"},
+					"filePath": {Type: TypeString},
+					"role":     {Type: TypeString, Description: "What the symbol does for the answer"},
+				},
+				Required: []string{"symbol"},
+			},
+		},
+		"steps":      {Type: TypeArray, Description: "Explanation of the answer step by step", Items: &Schema{Type: TypeString}},
+		"caveats":    {Type: TypeArray, Description: "Limitations, assumptions and open questions", Items: &Schema{Type: TypeString}},
+		"confidence": {Type: TypeNumber, Description: "Confidence in the answer from 0 to 1"},
+		"citations":  {Type: TypeArray, Description: "Numbers of the code snippets the answer relies on", Items: &Schema{Type: TypeInteger}},
+	},
+	Required: []string{"summary", "symbols", "steps", "caveats", "confidence", "citations"},
+}
+
+const structuredInstructions = `Reply with a single JSON object and nothing else, following the response schema: summary, symbols, steps, caveats, confidence and citations. This replaces any formatting instructions for prose answers. List the numbers of the code snippets you rely on in citations instead of citing them in the text.`
+
+const structuredRetryPrompt = "Your reply was not a valid answer: %v. Reply again with only the corrected JSON object."
+
+// GenerateStructuredAnswer is GenerateAnswer with the answer returned as a StructuredAnswer
+// conforming to AnswerSchema. Replies that are not valid JSON for the schema are repaired
+// when possible and otherwise sent back to the model with the error, up to
+// maxStructuredAttempts times. The Answer's Text is the summary.
+func (c *Client) GenerateStructuredAnswer(ctx context.Context, question string, history []session.Message, searchResults []storage.SearchResult, params GenerationParams) (Answer, error) {
+	req, chunks, err := c.answerRequest(question, history, searchResults, params)
+	if err != nil {
+		return Answer{}, err
+	}
+	req.Messages = append([]ChatMessage{{Role: RoleSystem, Content: structuredInstructions}}, req.Messages...)
+	req.ResponseSchema = AnswerSchema
+
+	var usage Usage
+	for attempt := 1; ; attempt++ {
+		resp, err := c.model.Generate(ctx, req)
+		if err != nil {
+			return Answer{}, err
+		}
+		// JSON cut off at the token limit is continued like prose
+		if resp, err = c.complete(ctx, req, resp, nil); err != nil {
+			return Answer{}, err
+		}
+		usage = usage.Add(resp.Usage)
+
+		structured, err := parseStructured(resp.Text, AnswerSchema)
+		if err == nil {
+			answer := structuredAnswer(structured, sourcesFor(chunks))
+			answer.Usage = usage
+			return answer, nil
+		}
+		if attempt == maxStructuredAttempts {
+			return Answer{}, fmt.Errorf("no valid structured answer after %d attempts: %w", attempt, err)
+		}
+
+		req.Messages = append(req.Messages,
+			ChatMessage{Role: RoleAssistant, Content: resp.Text},
+			ChatMessage{Role: RoleUser, Content: fmt.Sprintf(structuredRetryPrompt, err)})
+	}
+}
+
+// structuredAnswer marks the cited sources and drops citations of sources that were not sent
+func structuredAnswer(structured StructuredAnswer, sources []Source) Answer {
+	byID := make(map[int]*Source, len(sources))
+	for i := range sources {
+		byID[sources[i].ID] = &sources[i]
+	}
+
+	answer := Answer{Text: structured.Summary, Sources: sources}
+	var valid []int
+	seen := make(map[int]bool)
+	for _, id := range structured.Citations {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if source, ok := byID[id]; ok {
+			source.Cited = true
+			valid = append(valid, id)
+		} else {
+			answer.InvalidCitations = append(answer.InvalidCitations, id)
+		}
+	}
+	sort.Ints(answer.InvalidCitations)
+
+	structured.Citations = valid
+	answer.Structured = &structured
+	return answer
+}
+
+// parseStructured decodes text as a StructuredAnswer, repairing common JSON mistakes, and
+// checks it against schema
+func parseStructured(text string, schema *Schema) (StructuredAnswer, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		text = repairJSON(text)
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return StructuredAnswer{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	if err := schema.Validate(value); err != nil {
+		return StructuredAnswer{}, err
+	}
+
+	var structured StructuredAnswer
+	if err := json.Unmarshal([]byte(text), &structured); err != nil {
+		return StructuredAnswer{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if structured.Confidence < 0 || structured.Confidence > 1 {
+		return StructuredAnswer{}, fmt.Errorf("answer.confidence must be between 0 and 1")
+	}
+	if strings.TrimSpace(structured.Summary) == "" {
+		return StructuredAnswer{}, fmt.Errorf("answer.summary must not be empty")
+	}
+	return structured, nil
+}
+
+// trailingComma matches a comma before a closing bracket, which JSON does not allow
+var trailingComma = regexp.MustCompile(`,(\s*[}\]])`)
+
+// repairJSON fixes mistakes models commonly make when asked for JSON: wrapping it in a
+// markdown code fence or prose, and leaving trailing commas
+func repairJSON(text string) string {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return trailingComma.ReplaceAllString(text[start:end+1], "$1")
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"text/template"
+
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validStructured = `{"summary": "Total sums the items and applies the discount.",
+	"symbols": [{"symbol": "shop.(*Cart).Total", "filePath": "cart.go", "role": "computes the total"}],
+	"steps": ["Sum price times quantity", "Apply the discount"],
+	"caveats": [],
+	"confidence": 0.9,
+	"citations": [1]}`
+
+func TestParseStructured(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "valid", text: validStructured},
+		{name: "code fence", text: "```json\n" + validStructured + "\n```"},
+		{name: "prose and trailing commas", text: "Here is the answer:\n" + `{"summary": "S", "symbols": [], "steps": ["a",], "caveats": [], "confidence": 1, "citations": [],}`},
+		{name: "not JSON", text: "Total sums the items.", wantErr: "invalid JSON: invalid character 'T' looking for beginning of value"},
+		{name: "missing field", text: `{"summary": "S", "symbols": [], "steps": [], "caveats": [], "citations": []}`, wantErr: "answer.confidence is required"},
+		{name: "wrong type", text: `{"summary": "S", "symbols": [], "steps": [], "caveats": [], "confidence": 0.5, "citations": ["1"]}`, wantErr: "answer.citations[0] must be an integer"},
+		{name: "confidence out of range", text: `{"summary": "S", "symbols": [], "steps": [], "caveats": [], "confidence": 90, "citations": []}`, wantErr: "answer.confidence must be between 0 and 1"},
+		{name: "empty summary", text: `{"summary": " ", "symbols": [], "steps": [], "caveats": [], "confidence": 0.5, "citations": []}`, wantErr: "answer.summary must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseStructured(tt.text, AnswerSchema)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGenerateStructuredAnswer(t *testing.T) {
+	model := &scriptedModel{responses: []ChatResponse{
+		{Text: `{"summary": "Total sums the items."}`, Usage: Usage{TotalTokens: 10}},
+		{Text: `{"summary": "Total sums the items.", "symbols": [], "steps": [], "caveats": ["Discounts are not shown"], "confidence": 0.7, "citations": [1, 4, 1]}`, Usage: Usage{TotalTokens: 12}},
+	}}
+	client := &Client{model: model, promptTemplate: mustDefaultTemplate(t), promptTokenBudget: DefaultPromptTokenBudget}
+	results := []storage.SearchResult{{Chunk: parser.CodeChunk{Name: "Total", FilePath: "cart.go", Content: "func Total() int"}, Similarity: 0.8}}
+
+	answer, err := client.GenerateStructuredAnswer(context.Background(), "How is the total computed?", nil, results, GenerationParams{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Total sums the items.", answer.Text)
+	assert.Equal(t, []int{1}, answer.Structured.Citations)
+	assert.Equal(t, []int{4}, answer.InvalidCitations)
+	assert.True(t, answer.Sources[0].Cited)
+	assert.Equal(t, []string{"Discounts are not shown"}, answer.Structured.Caveats)
+	assert.Equal(t, 22, answer.Usage.TotalTokens)
+
+	require.Len(t, model.requests, 2)
+	assert.Equal(t, AnswerSchema, model.requests[0].ResponseSchema)
+	assert.Equal(t, RoleSystem, model.requests[0].Messages[0].Role)
+	retry := model.requests[1].Messages
+	assert.Equal(t, ChatMessage{Role: RoleAssistant, Content: `{"summary": "Total sums the items."}`}, retry[len(retry)-2])
+	assert.Equal(t, "Your reply was not a valid answer: answer.symbols is required. Reply again with only the corrected JSON object.", retry[len(retry)-1].Content)
+}
+
+func TestGenerateStructuredAnswerGivesUp(t *testing.T) {
+	model := &scriptedModel{responses: []ChatResponse{{Text: "no"}, {Text: "no"}, {Text: "no"}}}
+	client := &Client{model: model, promptTemplate: mustDefaultTemplate(t), promptTokenBudget: DefaultPromptTokenBudget}
+	results := []storage.SearchResult{{Chunk: parser.CodeChunk{Name: "Total", FilePath: "cart.go"}}}
+
+	_, err := client.GenerateStructuredAnswer(context.Background(), "Q", nil, results, GenerationParams{})
+
+	assert.ErrorContains(t, err, "no valid structured answer after 3 attempts: invalid JSON")
+	assert.Len(t, model.requests, 3)
+}
+
+func mustDefaultTemplate(t *testing.T) *template.Template {
+	tmpl, err := LoadPromptTemplate("")
+	require.NoError(t, err)
+	return tmpl
+}
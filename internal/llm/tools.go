@@ -0,0 +1,437 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"intelligent-doc-assistant/internal/guardrails"
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// Agent tool names
+const (
+	ToolSearchCode   = "search_code"
+	ToolGetSymbol    = "get_symbol"
+	ToolGetFileLines = "get_file_lines"
+	ToolFindCallers  = "find_callers"
+	ToolListPackage  = "list_package"
+)
+
+const (
+	// defaultToolResults and maxToolResults bound how many chunks search_code returns
+	defaultToolResults = 5
+	maxToolResults     = 10
+	// maxSymbolMatches bounds how many definitions get_symbol returns for an ambiguous name
+	maxSymbolMatches = 3
+	// maxFileLines bounds the range get_file_lines returns
+	maxFileLines = 200
+	// maxCallerCandidates bounds the chunks mentioning a name that find_callers checks for calls
+	maxCallerCandidates = 500
+	// maxToolOutputTokens bounds each tool result sent back to the model
+	maxToolOutputTokens = 2000
+)
+
+// AgentTools are the tools offered to the model in agent mode.
+var AgentTools = []Tool{
+	{
+		Name:        ToolSearchCode,
+		Description: "Search the codebase for functions and methods relevant to a natural language query or identifier. Returns the best matches with their source.",
+		Parameters: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"query": {Type: TypeString, Description: "What to look for, e.g. \"how the cart total is computed\" or \"ApplyDiscount\""},
+				"limit": {Type: TypeInteger, Description: fmt.Sprintf("Maximum number of results, at most %d", maxToolResults)},
+			},
+			Required: []string{"query"},
+		},
+	},
+	{
+		Name:        ToolGetSymbol,
+		Description: "Get the full source of a function or method by name, e.g. \"Total\", or by qualified symbol, e.g. \"shop.(*Cart).Total\".",
+		Parameters: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"symbol": {Type: TypeString, Description: "Function or method name, or package-qualified symbol"},
+			},
+			Required: []string{"symbol"},
+		},
+	},
+	{
+		Name:        ToolGetFileLines,
+		Description: fmt.Sprintf("Get numbered source lines of a file, at most %d at a time. Only lines inside functions and methods are indexed.", maxFileLines),
+		Parameters: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"path":  {Type: TypeString, Description: "File path relative to the repository root"},
+				"start": {Type: TypeInteger, Description: "First line, starting at 1"},
+				"end":   {Type: TypeInteger, Description: "Last line"},
+			},
+			Required: []string{"path", "start", "end"},
+		},
+	},
+	{
+		Name:        ToolFindCallers,
+		Description: "Find the functions and methods that call a function or method, given its name.",
+		Parameters: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"name": {Type: TypeString, Description: "Name of the called function or method, e.g. \"Apply\""},
+			},
+			Required: []string{"name"},
+		},
+	},
+	{
+		Name:        ToolListPackage,
+		Description: "List the functions and methods of a package with their signatures.",
+		Parameters: &Schema{
+			Type: TypeObject,
+			Properties: map[string]*Schema{
+				"package": {Type: TypeString, Description: "Package name, e.g. \"storage\""},
+			},
+			Required: []string{"package"},
+		},
+	},
+}
+
+// toolbox runs agent tools against a chunk store. The chunks the tools return are numbered
+// as they are first seen, so the answer can cite them like retrieved chunks.
+type toolbox struct {
+	store storage.ChunkStore
+	// opts holds the request's search settings; their repository filter scopes every tool
+	opts storage.SearchOptions
+	// guard redacts the chunks tools return and flags injected instructions in them
+	guard *guardrails.Guard
+
+	chunks  []PromptChunk
+	numbers map[string]int
+	// warnings holds the guardrail warnings of chunks by key
+	warnings map[string]string
+}
+
+func newToolbox(store storage.ChunkStore, opts storage.SearchOptions, guard *guardrails.Guard) *toolbox {
+	return &toolbox{store: store, opts: opts, guard: guard, numbers: make(map[string]int), warnings: make(map[string]string)}
+}
+
+// run executes call and returns the text to send back to the model
+func (t *toolbox) run(ctx context.Context, call ToolCall) (string, error) {
+	if t.store == nil {
+		return "", fmt.Errorf("code store not initialized")
+	}
+
+	var output string
+	var err error
+	switch call.Name {
+	case ToolSearchCode:
+		output, err = t.searchCode(ctx, call.Args)
+	case ToolGetSymbol:
+		output, err = t.getSymbol(ctx, call.Args)
+	case ToolGetFileLines:
+		output, err = t.getFileLines(ctx, call.Args)
+	case ToolFindCallers:
+		output, err = t.findCallers(ctx, call.Args)
+	case ToolListPackage:
+		output, err = t.listPackage(ctx, call.Args)
+	default:
+		return "", fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncateToTokens(output, maxToolOutputTokens), nil
+}
+
+func (t *toolbox) searchCode(ctx context.Context, args map[string]interface{}) (string, error) {
+	query, err := stringArg(args, "query")
+	if err != nil {
+		return "", err
+	}
+	limit, err := intArg(args, "limit", defaultToolResults)
+	if err != nil {
+		return "", err
+	}
+
+	opts := t.opts
+	opts.Limit = max(1, min(limit, maxToolResults))
+	results, err := t.store.SearchChunks(ctx, query, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to search code: %w", err)
+	}
+	if len(results) == 0 {
+		return "No matching code found.", nil
+	}
+
+	var out strings.Builder
+	for _, result := range results {
+		t.writeChunk(&out, t.check(result.Chunk), result.Similarity, true)
+	}
+	return out.String(), nil
+}
+
+func (t *toolbox) getSymbol(ctx context.Context, args map[string]interface{}) (string, error) {
+	symbol, err := stringArg(args, "symbol")
+	if err != nil {
+		return "", err
+	}
+
+	chunks, err := t.find(ctx, storage.ChunkFilter{Symbol: symbol, Limit: maxSymbolMatches})
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) == 0 {
+		return fmt.Sprintf("No function or method named %s found.", symbol), nil
+	}
+
+	var out strings.Builder
+	for _, chunk := range chunks {
+		t.writeChunk(&out, chunk, 0, true)
+	}
+	return out.String(), nil
+}
+
+// getFileLines reassembles the requested lines from the chunks of the file. Lines outside
+// any chunk, such as type declarations, are not indexed and are reported as gaps.
+func (t *toolbox) getFileLines(ctx context.Context, args map[string]interface{}) (string, error) {
+	path, err := stringArg(args, "path")
+	if err != nil {
+		return "", err
+	}
+	start, err := intArg(args, "start", 0)
+	if err != nil {
+		return "", err
+	}
+	end, err := intArg(args, "end", 0)
+	if err != nil {
+		return "", err
+	}
+	start = max(start, 1)
+	if end < start {
+		return "", fmt.Errorf("end must not be before start")
+	}
+	end = min(end, start+maxFileLines-1)
+
+	// Every chunk spans at least one line, so maxFileLines chunks cover the whole range
+	chunks, err := t.find(ctx, storage.ChunkFilter{FilePath: path, FromLine: start, ToLine: end, Limit: maxFileLines})
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) == 0 {
+		indexed, err := t.find(ctx, storage.ChunkFilter{FilePath: path, Limit: 1})
+		if err != nil {
+			return "", err
+		}
+		if len(indexed) == 0 {
+			return fmt.Sprintf("File %s is not indexed.", path), nil
+		}
+	}
+
+	lines := make(map[int]string)
+	var numbers []string
+	for _, chunk := range chunks {
+		number := fmt.Sprintf("[%d] %s", t.number(chunk, 0), symbolOf(chunk))
+		if warning := t.warnings[chunkKey(chunk)]; warning != "" {
+			number += " (Warning: " + warning + ")"
+		}
+		numbers = append(numbers, number)
+		for i, line := range strings.Split(chunk.Content, "\n") {
+			lines[chunk.StartLine+i] = line
+		}
+	}
+
+	var out strings.Builder
+	if len(numbers) > 0 {
+		fmt.Fprintf(&out, "Chunks: %s\n", strings.Join(numbers, ", "))
+	}
+	gapStart := 0
+	for n := start; n <= end; n++ {
+		line, ok := lines[n]
+		if !ok {
+			if gapStart == 0 {
+				gapStart = n
+			}
+			continue
+		}
+		if gapStart != 0 {
+			fmt.Fprintf(&out, "// lines %d-%d not indexed\n", gapStart, n-1)
+			gapStart = 0
+		}
+		fmt.Fprintf(&out, "%d\t%s\n", n, line)
+	}
+	if gapStart != 0 {
+		fmt.Fprintf(&out, "// lines %d-%d not indexed\n", gapStart, end)
+	}
+	return out.String(), nil
+}
+
+// findCallers looks for chunks mentioning name and keeps those that call it. Calls are
+// matched by name, so methods of other types with the same name are included. At most
+// maxCallerCandidates chunks are checked, and the output says when there may be more.
+func (t *toolbox) findCallers(ctx context.Context, args map[string]interface{}) (string, error) {
+	name, err := stringArg(args, "name")
+	if err != nil {
+		return "", err
+	}
+	// Accept qualified names such as shop.(*Cart).Total
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	chunks, err := t.find(ctx, storage.ChunkFilter{Contains: name, Limit: maxCallerCandidates})
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	// Said first, so that truncating a long list keeps the note
+	if len(chunks) == maxCallerCandidates {
+		fmt.Fprintf(&out, "Only the first %d chunks mentioning %s were checked, so some callers may be missing; use search_code to look further.\n", maxCallerCandidates, name)
+	}
+	found := false
+	for _, chunk := range chunks {
+		if !calls(chunk, name) {
+			continue
+		}
+		t.writeChunk(&out, chunk, 0, false)
+		found = true
+	}
+	if !found {
+		fmt.Fprintf(&out, "No callers of %s found.", name)
+	}
+	return out.String(), nil
+}
+
+func (t *toolbox) listPackage(ctx context.Context, args map[string]interface{}) (string, error) {
+	pkg, err := stringArg(args, "package")
+	if err != nil {
+		return "", err
+	}
+
+	chunks, err := t.find(ctx, storage.ChunkFilter{Package: pkg})
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) == 0 {
+		return fmt.Sprintf("Package %s is not indexed.", pkg), nil
+	}
+
+	var out strings.Builder
+	for _, chunk := range chunks {
+		t.writeChunk(&out, chunk, 0, false)
+	}
+	return out.String(), nil
+}
+
+// find looks up chunks within the repository the request is scoped to
+func (t *toolbox) find(ctx context.Context, filter storage.ChunkFilter) ([]parser.CodeChunk, error) {
+	filter.Repo = t.opts.Repo
+	chunks, err := t.store.FindChunks(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up code: %w", err)
+	}
+	for i := range chunks {
+		chunks[i] = t.check(chunks[i])
+	}
+	return chunks, nil
+}
+
+// check redacts the secrets in chunk and remembers the warning about instructions in it
+func (t *toolbox) check(chunk parser.CodeChunk) parser.CodeChunk {
+	chunk, findings := t.guard.Check(guardrails.StagePrompt, chunk)
+	if warning := guardrails.Warning(findings); warning != "" {
+		t.warnings[chunkKey(chunk)] = warning
+	}
+	return chunk
+}
+
+// writeChunk writes chunk under its citation number, with its full source or only its signature
+func (t *toolbox) writeChunk(out *strings.Builder, chunk parser.CodeChunk, score float64, source bool) {
+	fmt.Fprintf(out, "[%d] %s (%s:%d-%d)\n", t.number(chunk, score), symbolOf(chunk), chunk.FilePath, chunk.StartLine, chunk.EndLine)
+	if warning := t.warnings[chunkKey(chunk)]; warning != "" {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+	if !source {
+		fmt.Fprintf(out, "%s\n", signature(chunk.Content))
+		return
+	}
+	fmt.Fprintf(out, "```go\n%s\n```\n", chunk.Content)
+}
+
+// number returns the citation number of chunk, numbering it if it has not been seen yet
+func (t *toolbox) number(chunk parser.CodeChunk, score float64) int {
+	key := chunkKey(chunk)
+	if n, ok := t.numbers[key]; ok {
+		return n
+	}
+
+	n := len(t.chunks) + 1
+	t.numbers[key] = n
+	t.chunks = append(t.chunks, PromptChunk{
+		Number:      n,
+		Repo:        chunk.Repo,
+		Commit:      chunk.Commit,
+		FilePath:    chunk.FilePath,
+		StartLine:   chunk.StartLine,
+		EndLine:     chunk.EndLine,
+		Name:        chunk.Name,
+		Symbol:      chunk.Symbol,
+		Description: chunk.Description,
+		Score:       score,
+		Warning:     t.warnings[key],
+	})
+	return n
+}
+
+// chunkKey identifies chunk among the chunks tools returned
+func chunkKey(chunk parser.CodeChunk) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%d", chunk.Repo, chunk.FilePath, symbolOf(chunk), chunk.StartLine)
+}
+
+// calls reports whether chunk calls a function or method called name. Chunks that do not
+// parse as Go are matched textually.
+func calls(chunk parser.CodeChunk, name string) bool {
+	names, err := parser.Calls(chunk.Content)
+	if err != nil {
+		return strings.Contains(chunk.Content, name+"(")
+	}
+	for _, called := range names {
+		if called == name {
+			return true
+		}
+	}
+	return false
+}
+
+func symbolOf(chunk parser.CodeChunk) string {
+	if chunk.Symbol != "" {
+		return chunk.Symbol
+	}
+	return chunk.Name
+}
+
+// stringArg returns the required string argument name
+func stringArg(args map[string]interface{}, name string) (string, error) {
+	value, ok := args[name].(string)
+	if !ok || strings.TrimSpace(value) == "" {
+		return "", fmt.Errorf("missing argument %q", name)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// intArg returns the integer argument name, or fallback when it is not given. A zero
+// fallback makes the argument required. JSON numbers decode as float64.
+func intArg(args map[string]interface{}, name string, fallback int) (int, error) {
+	switch value := args[name].(type) {
+	case float64:
+		return int(value), nil
+	case int:
+		return value, nil
+	case nil:
+		if fallback == 0 {
+			return 0, fmt.Errorf("missing argument %q", name)
+		}
+		return fallback, nil
+	default:
+		return 0, fmt.Errorf("argument %q must be a number", name)
+	}
+}
@@ -37,3 +37,13 @@ func IsGitHubURL(path string) bool {
 	return strings.HasPrefix(path, "https://github.com/") ||
 		strings.HasPrefix(path, "git@github.com:")
 }
+
+// RepoCommit returns the commit checked out in the git repository containing dir,
+// or "" when dir is not in a git repository
+func RepoCommit(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
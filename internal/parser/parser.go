@@ -10,8 +10,19 @@ import (
 	"strings"
 )
 
+// Chunk kinds
+const (
+	KindFunction = "function"
+	KindMethod   = "method"
+)
+
 // CodeChunk represents a chunk of code with its metadata
 type CodeChunk struct {
+	Repo        string // Repository the chunk was ingested from
+	Commit      string // Commit the repository was at when ingested, if known
+	Package     string
+	Symbol      string // Package-qualified name, e.g. "storage.(*Store).StoreChunks"
+	Kind        string
 	Name        string
 	Description string
 	Language    string
@@ -98,11 +109,24 @@ func (p *Parser) parseFile(path string) ([]CodeChunk, error) {
 		}
 
 		chunk := CodeChunk{
+			Package:  file.Name.Name,
+			Kind:     KindFunction,
 			Name:     fn.Name.Name,
 			Language: "go",
 			FilePath: path,
 		}
 
+		// Qualify the symbol so methods with the same name on different receivers stay distinct
+		chunk.Symbol = file.Name.Name + "." + fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			chunk.Kind = KindMethod
+			recv := typeToString(fn.Recv.List[0].Type)
+			if strings.HasPrefix(recv, "*") {
+				recv = "(" + recv + ")"
+			}
+			chunk.Symbol = file.Name.Name + "." + recv + "." + fn.Name.Name
+		}
+
 		// Get position information
 		start := p.fset.Position(fn.Pos())
 		end := p.fset.Position(fn.End())
@@ -145,6 +169,29 @@ func (p *Parser) parseFile(path string) ([]CodeChunk, error) {
 	return chunks, nil
 }
 
+// SetRepo records the repository identity and commit on chunks and makes their file paths relative
+// to root, so a chunk's identity does not depend on where the repository was checked out
+func SetRepo(chunks []CodeChunk, repo, commit, root string) {
+	for i := range chunks {
+		chunks[i].Repo = repo
+		chunks[i].Commit = commit
+		if rel, err := filepath.Rel(root, chunks[i].FilePath); err == nil {
+			chunks[i].FilePath = filepath.ToSlash(rel)
+		}
+	}
+}
+
+// RepoID returns a stable identifier for a GitHub URL or local repository path
+func RepoID(pathOrURL string) string {
+	if IsGitHubURL(pathOrURL) {
+		return strings.TrimSuffix(strings.TrimSuffix(pathOrURL, "/"), ".git")
+	}
+	if abs, err := filepath.Abs(pathOrURL); err == nil {
+		return abs
+	}
+	return filepath.Clean(pathOrURL)
+}
+
 func isGoFile(path string) bool {
 	return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go")
 }
@@ -163,3 +210,36 @@ func typeToString(expr ast.Expr) string {
 		return fmt.Sprintf("%T", expr)
 	}
 }
+
+// Calls returns the names of the functions and methods called in content, the source of a
+// chunk, in the order they first appear. Method calls are reported by method name only, since
+// receiver types are not resolved.
+func Calls(content string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+content, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chunk: %w", err)
+	}
+
+	var calls []string
+	seen := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var name string
+		switch fn := call.Fun.(type) {
+		case *ast.Ident:
+			name = fn.Name
+		case *ast.SelectorExpr:
+			name = fn.Sel.Name
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			calls = append(calls, name)
+		}
+		return true
+	})
+	return calls, nil
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,10 +12,13 @@ func TestParseCode(t *testing.T) {
 	testFilePath := "testdata/test.go"
 	want := []CodeChunk{
 		{
+			Package:     "main",
+			Symbol:      "main.TestFunction",
+			Kind:        KindFunction,
 			Name:        "TestFunction",
 			FilePath:    testFilePath,
-			StartLine:   3,
-			EndLine:     5,
+			StartLine:   4,
+			EndLine:     7,
 			Parameters:  []Parameter{{Name: "a", Type: "int"}, {Name: "b", Type: "string"}},
 			Returns:     "string, error",
 			Description: "Test function description",
@@ -24,36 +29,27 @@ func TestParseCode(t *testing.T) {
 
 	p := NewParser()
 	got, err := p.parseFile(testFilePath)
-	
+
 	assert.NoError(t, err)
 	assert.Equal(t, want, got)
 }
 
-			if tt.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.want, got)
-			}
-		})
-	}
-}
-
 func TestChunkCode(t *testing.T) {
 	// Create a temporary file for testing
-	content := []byte(`func LargeFunction() {
-		// First part
-		code1
-		code2
-		// Second part
-		code3
-		code4
-	}`)
-	
-	tmpFilePath := "testdata/large_test.go"
+	content := []byte(`package large
+
+func LargeFunction() {
+	// First part
+	code1()
+	code2()
+	// Second part
+	code3()
+	code4()
+}`)
+
+	tmpFilePath := filepath.Join(t.TempDir(), "large_test.go")
 	err := os.WriteFile(tmpFilePath, content, 0644)
 	assert.NoError(t, err)
-	defer os.Remove(tmpFilePath)
 
 	p := NewParser()
 	chunks, err := p.parseFile(tmpFilePath)
@@ -62,23 +58,82 @@ func TestChunkCode(t *testing.T) {
 
 	// Verify content is captured
 	assert.Contains(t, chunks[0].Content, "LargeFunction")
-					Language:    "go",
-				},
-			},
-			wantErr: false,
+	assert.Contains(t, chunks[0].Content, "code4()")
+}
+
+func TestParseMethodSymbols(t *testing.T) {
+	content := []byte(`package store
+
+type Store struct{}
+
+func (s *Store) Save() {}
+
+func (s Store) Load() {}
+`)
+
+	tmpFilePath := filepath.Join(t.TempDir(), "store.go")
+	assert.NoError(t, os.WriteFile(tmpFilePath, content, 0644))
+
+	chunks, err := NewParser().parseFile(tmpFilePath)
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 2)
+
+	assert.Equal(t, KindMethod, chunks[0].Kind)
+	assert.Equal(t, "store.(*Store).Save", chunks[0].Symbol)
+	assert.Equal(t, "store.Store.Load", chunks[1].Symbol)
+}
+
+func TestSetRepo(t *testing.T) {
+	chunks := []CodeChunk{{FilePath: "/src/repo/pkg/file.go"}}
+	SetRepo(chunks, "https://github.com/org/repo", "0a1b2c", "/src/repo")
+
+	assert.Equal(t, "https://github.com/org/repo", chunks[0].Repo)
+	assert.Equal(t, "0a1b2c", chunks[0].Commit)
+	assert.Equal(t, "pkg/file.go", chunks[0].FilePath)
+}
+
+func TestRepoID(t *testing.T) {
+	assert.Equal(t, "https://github.com/org/repo", RepoID("https://github.com/org/repo.git"))
+	assert.Equal(t, "https://github.com/org/repo", RepoID("https://github.com/org/repo/"))
+	assert.True(t, filepath.IsAbs(RepoID("relative/path")))
+}
+
+func TestRepoCommit(t *testing.T) {
+	assert.Equal(t, "", RepoCommit(t.TempDir()))
+}
+
+func TestCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "functions and methods",
+			content: "func (c *Cart) Total() int {\n\ttotal := sum(c.Items)\n\treturn c.Discount.Apply(total) + sum(nil)\n}",
+			want:    []string{"sum", "Apply"},
+		},
+		{
+			name:    "no calls",
+			content: "func Zero() int { return 0 }",
+		},
+		{
+			name:    "not Go",
+			content: "func {",
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ChunkCode("test.go", tt.content, tt.language, tt.maxSize)
-
+			got, err := Calls(tt.content)
 			if tt.wantErr {
 				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.want, got)
+				return
 			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
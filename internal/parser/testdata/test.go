@@ -1,5 +1,6 @@
 package main
 
+// Test function description
 func TestFunction(a int, b string) (string, error) {
 	// Test function description
 	return "", nil
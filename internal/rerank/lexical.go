@@ -0,0 +1,60 @@
+package rerank
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// Field weights for lexical scoring: a term in the symbol name says more than one in the body
+const (
+	nameWeight        = 3.0
+	descriptionWeight = 2.0
+	contentWeight     = 1.0
+)
+
+// Lexical reranks by weighted overlap between question terms and chunk text.
+// It needs no network access, so it also serves as the fallback for LLM reranking.
+type Lexical struct{}
+
+// NewLexical creates a lexical reranker.
+func NewLexical() *Lexical {
+	return &Lexical{}
+}
+
+// Rerank implements Reranker
+func (r *Lexical) Rerank(ctx context.Context, question string, results []storage.SearchResult) ([]storage.SearchResult, error) {
+	terms := storage.QueryTerms(question)
+	if len(terms) == 0 || len(results) < 2 {
+		return results, nil
+	}
+
+	scores := make([]float64, len(results))
+	for i, result := range results {
+		scores[i] = lexicalScore(terms, result)
+	}
+	return sortByScores(results, scores), nil
+}
+
+// lexicalScore sums log-damped, field-weighted term frequencies, scaled by the share
+// of question terms the chunk covers so that matching many terms beats repeating one
+func lexicalScore(terms []string, result storage.SearchResult) float64 {
+	chunk := result.Chunk
+	name := strings.ToLower(chunk.Symbol + " " + chunk.Name)
+	description := strings.ToLower(chunk.Description)
+	content := strings.ToLower(chunk.Content)
+
+	score, matched := 0.0, 0
+	for _, term := range terms {
+		termScore := nameWeight*math.Log1p(float64(strings.Count(name, term))) +
+			descriptionWeight*math.Log1p(float64(strings.Count(description, term))) +
+			contentWeight*math.Log1p(float64(strings.Count(content, term)))
+		if termScore > 0 {
+			matched++
+		}
+		score += termScore
+	}
+	return score * float64(matched) / float64(len(terms))
+}
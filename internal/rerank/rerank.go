@@ -0,0 +1,79 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// Reranker reorders retrieved results by how well each answers the question.
+type Reranker interface {
+	Rerank(ctx context.Context, question string, results []storage.SearchResult) ([]storage.SearchResult, error)
+}
+
+// Scorer rates each (question, result) pair; higher is more relevant.
+type Scorer interface {
+	ScoreRelevance(ctx context.Context, question string, results []storage.SearchResult) ([]float64, error)
+}
+
+// New returns the reranker named by kind: "none" (or empty) disables reranking, "lexical"
+// scores term overlap locally and "llm" asks scorer, falling back to lexical on failure.
+func New(kind string, scorer Scorer) (Reranker, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "lexical":
+		return NewLexical(), nil
+	case "llm":
+		if scorer == nil {
+			return nil, fmt.Errorf("llm reranker requires a scorer")
+		}
+		return NewLLM(scorer), nil
+	default:
+		return nil, fmt.Errorf("unknown reranker %q", kind)
+	}
+}
+
+// LLM reranks with model-assigned relevance scores.
+type LLM struct {
+	scorer   Scorer
+	fallback Reranker
+}
+
+// NewLLM creates an LLM reranker that falls back to lexical scoring when the model fails.
+func NewLLM(scorer Scorer) *LLM {
+	return &LLM{scorer: scorer, fallback: NewLexical()}
+}
+
+// Rerank implements Reranker
+func (r *LLM) Rerank(ctx context.Context, question string, results []storage.SearchResult) ([]storage.SearchResult, error) {
+	if len(results) < 2 {
+		return results, nil
+	}
+
+	scores, err := r.scorer.ScoreRelevance(ctx, question, results)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		fmt.Printf("LLM reranking failed, using lexical fallback: %v\n", err)
+		return r.fallback.Rerank(ctx, question, results)
+	}
+	return sortByScores(results, scores), nil
+}
+
+// sortByScores returns results ordered by descending score with RerankScore set.
+// Ties keep their retrieval order.
+func sortByScores(results []storage.SearchResult, scores []float64) []storage.SearchResult {
+	sorted := make([]storage.SearchResult, len(results))
+	for i, result := range results {
+		sorted[i] = result
+		sorted[i].RerankScore = scores[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].RerankScore > sorted[j].RerankScore
+	})
+	return sorted
+}
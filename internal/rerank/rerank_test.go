@@ -0,0 +1,91 @@
+package rerank
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockScorer is a mock implementation of Scorer
+type MockScorer struct {
+	mock.Mock
+}
+
+func (m *MockScorer) ScoreRelevance(ctx context.Context, question string, results []storage.SearchResult) ([]float64, error) {
+	args := m.Called(question, len(results))
+	scores, _ := args.Get(0).([]float64)
+	return scores, args.Error(1)
+}
+
+func testResults() []storage.SearchResult {
+	return []storage.SearchResult{
+		{ID: 1, Chunk: parser.CodeChunk{Name: "NewServer", Description: "NewServer wires the HTTP routes"}},
+		{ID: 2, Chunk: parser.CodeChunk{Name: "StoreChunks", Description: "StoreChunks saves chunk embeddings", Content: "embedding := Vector(embeddings[i])"}},
+		{ID: 3, Chunk: parser.CodeChunk{Name: "handleIngest", Description: "handleIngest parses a repository"}},
+	}
+}
+
+func ids(results []storage.SearchResult) []int64 {
+	out := make([]int64, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestLexicalRerank(t *testing.T) {
+	got, err := NewLexical().Rerank(context.Background(), "where are chunk embeddings stored?", testResults())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 1, 3}, ids(got))
+	assert.Greater(t, got[0].RerankScore, 0.0)
+}
+
+func TestLLMRerank(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float64
+		err    error
+		want   []int64
+	}{
+		{"model scores", []float64{2, 5, 9}, nil, []int64{3, 2, 1}},
+		{"ties keep retrieval order", []float64{5, 5, 1}, nil, []int64{1, 2, 3}},
+		{"falls back to lexical", nil, errors.New("quota exceeded"), []int64{2, 1, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := new(MockScorer)
+			question := "where are chunk embeddings stored?"
+			scorer.On("ScoreRelevance", question, 3).Return(tt.scores, tt.err)
+
+			got, err := NewLLM(scorer).Rerank(context.Background(), question, testResults())
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ids(got))
+			scorer.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	r, err := New("none", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	r, err = New("lexical", nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &Lexical{}, r)
+
+	_, err = New("llm", nil)
+	assert.Error(t, err)
+
+	_, err = New("cross-encoder", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// The newest limit messages of a session, returned oldest first. A session whose last
+	// message is older than the cutoff $3 has expired and returns nothing.
+	SELECT_SESSION_MESSAGES = `
+	SELECT role, content, created_at FROM (
+		SELECT id, role, content, created_at
+		FROM session_messages
+		WHERE session_id = $1
+		AND ($3::timestamptz IS NULL
+			OR (SELECT MAX(created_at) FROM session_messages WHERE session_id = $1) >= $3)
+		ORDER BY id DESC
+		LIMIT $2
+	) recent
+	ORDER BY id;`
+
+	INSERT_SESSION_MESSAGE = `
+	INSERT INTO session_messages (session_id, role, content, created_at)
+	VALUES ($1, $2, $3, COALESCE($4::timestamptz, CURRENT_TIMESTAMP));`
+
+	// Sessions idle since before the cutoff
+	DELETE_EXPIRED_SESSIONS = `
+	DELETE FROM session_messages
+	WHERE session_id IN (
+		SELECT session_id FROM session_messages
+		GROUP BY session_id
+		HAVING MAX(created_at) < $1
+	);`
+)
+
+// expireInterval is how often DBStore deletes expired sessions. Expired sessions are hidden
+// from History straight away, so the sweep only reclaims space and need not run on every write.
+const expireInterval = 10 * time.Minute
+
+// DBStore keeps sessions in the session_messages table, so conversations survive restarts
+// and are shared between server instances. Like MemoryStore, it forgets sessions idle for
+// longer than the TTL.
+type DBStore struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu          sync.Mutex
+	lastExpired time.Time
+}
+
+// NewDBStore creates a store on db, which must have the session_messages migration applied;
+// a ttl of 0 keeps sessions forever.
+func NewDBStore(db *sql.DB, ttl time.Duration) *DBStore {
+	return &DBStore{db: db, ttl: ttl, now: time.Now}
+}
+
+// expireDue reports whether expired sessions should be deleted now, at most once per
+// expireInterval
+func (s *DBStore) expireDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastExpired) < expireInterval {
+		return false
+	}
+	s.lastExpired = now
+	return true
+}
+
+// cutoff returns the time before which idle sessions have expired, or nil without a TTL
+func (s *DBStore) cutoff() interface{} {
+	if s.ttl <= 0 {
+		return nil
+	}
+	return s.now().Add(-s.ttl)
+}
+
+func (s *DBStore) History(ctx context.Context, id string, limit int) ([]Message, error) {
+	// LIMIT ALL is spelled as a NULL limit
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := s.db.QueryContext(ctx, SELECT_SESSION_MESSAGES, id, limitArg, s.cutoff())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session history: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var message Message
+		if err := rows.Scan(&message.Role, &message.Content, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load session history: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *DBStore) Append(ctx context.Context, id string, messages ...Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if cutoff := s.cutoff(); cutoff != nil && s.expireDue() {
+		if _, err := tx.ExecContext(ctx, DELETE_EXPIRED_SESSIONS, cutoff); err != nil {
+			return fmt.Errorf("failed to delete expired sessions: %w", err)
+		}
+	}
+
+	for _, message := range messages {
+		var createdAt interface{}
+		if !message.CreatedAt.IsZero() {
+			createdAt = message.CreatedAt
+		}
+		if _, err := tx.ExecContext(ctx, INSERT_SESSION_MESSAGE, id, message.Role, message.Content, createdAt); err != nil {
+			return fmt.Errorf("failed to store session message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session messages: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryMessages bounds the history kept per in-memory session; older messages are dropped
+const maxMemoryMessages = 100
+
+// MemoryStore keeps sessions in process memory. Sessions idle for longer than the TTL are
+// forgotten, so an abandoned conversation does not hold memory forever.
+type MemoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*memorySession
+	now      func() time.Time
+}
+
+type memorySession struct {
+	messages []Message
+	lastUsed time.Time
+}
+
+// NewMemoryStore creates an in-memory store; a ttl of 0 keeps sessions until restart.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttl,
+		sessions: make(map[string]*memorySession),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) History(ctx context.Context, id string, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	messages := session.messages
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return append([]Message(nil), messages...), nil
+}
+
+func (s *MemoryStore) Append(ctx context.Context, id string, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	session, ok := s.sessions[id]
+	if !ok {
+		session = &memorySession{}
+		s.sessions[id] = session
+	}
+
+	now := s.now()
+	for _, message := range messages {
+		if message.CreatedAt.IsZero() {
+			message.CreatedAt = now
+		}
+		session.messages = append(session.messages, message)
+	}
+	if extra := len(session.messages) - maxMemoryMessages; extra > 0 {
+		session.messages = append([]Message(nil), session.messages[extra:]...)
+	}
+	session.lastUsed = now
+	return nil
+}
+
+// expire removes sessions idle for longer than the TTL; the caller must hold s.mu
+func (s *MemoryStore) expire() {
+	if s.ttl <= 0 {
+		return
+	}
+	cutoff := s.now().Add(-s.ttl)
+	for id, session := range s.sessions {
+		if session.lastUsed.Before(cutoff) {
+			delete(s.sessions, id)
+		}
+	}
+}
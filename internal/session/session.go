@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"intelligent-doc-assistant/config"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Store keeps the message history of conversations by session ID.
+type Store interface {
+	// History returns the last limit messages of the session, oldest first.
+	// Unknown sessions have no history.
+	History(ctx context.Context, id string, limit int) ([]Message, error)
+	// Append adds messages to the end of the session, creating it if needed.
+	Append(ctx context.Context, id string, messages ...Message) error
+}
+
+// NewID returns a random session ID.
+func NewID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// NewStoreFromConfig builds the session store selected by SESSION_STORE, using db for the
+// database backend. It returns a nil Store when sessions are disabled.
+func NewStoreFromConfig(cfg *config.Config, db *sql.DB) (Store, error) {
+	switch cfg.SessionStore {
+	case "none":
+		return nil, nil
+	case "", "memory":
+		return NewMemoryStore(time.Duration(cfg.SessionTTLHours) * time.Hour), nil
+	case "database":
+		if db == nil {
+			return nil, fmt.Errorf("database session store requires a database connection")
+		}
+		return NewDBStore(db, time.Duration(cfg.SessionTTLHours)*time.Hour), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.SessionStore)
+	}
+}
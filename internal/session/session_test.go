@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	history, err := store.History(ctx, "s1", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	assert.NoError(t, store.Append(ctx, "s1",
+		Message{Role: RoleUser, Content: "What does Parse do?"},
+		Message{Role: RoleAssistant, Content: "It parses Go files [1]."}))
+	assert.NoError(t, store.Append(ctx, "s1", Message{Role: RoleUser, Content: "Where is it called?"}))
+
+	history, err = store.History(ctx, "s1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{
+		{Role: RoleAssistant, Content: "It parses Go files [1].", CreatedAt: now},
+		{Role: RoleUser, Content: "Where is it called?", CreatedAt: now},
+	}, history)
+
+	// Sessions expire once idle for longer than the TTL
+	now = now.Add(2 * time.Hour)
+	history, err = store.History(ctx, "s1", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestMemoryStoreCapsHistory(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	for i := 0; i < maxMemoryMessages+5; i++ {
+		assert.NoError(t, store.Append(ctx, "s1", Message{Role: RoleUser, Content: "q"}))
+	}
+
+	history, err := store.History(ctx, "s1", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, maxMemoryMessages)
+}
+
+func TestDBStore(t *testing.T) {
+	db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	store := NewDBStore(db, time.Hour)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return created.Add(time.Minute) }
+	cutoff := created.Add(time.Minute - time.Hour)
+
+	mockDB.ExpectQuery(SELECT_SESSION_MESSAGES).WithArgs("s1", 4, cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"role", "content", "created_at"}).
+			AddRow(RoleUser, "What does Parse do?", created).
+			AddRow(RoleAssistant, "It parses Go files.", created))
+
+	history, err := store.History(ctx, "s1", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{
+		{Role: RoleUser, Content: "What does Parse do?", CreatedAt: created},
+		{Role: RoleAssistant, Content: "It parses Go files.", CreatedAt: created},
+	}, history)
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec(DELETE_EXPIRED_SESSIONS).WithArgs(cutoff).WillReturnResult(sqlmock.NewResult(0, 2))
+	mockDB.ExpectExec(INSERT_SESSION_MESSAGE).WithArgs("s1", RoleUser, "Where is it called?", nil).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mockDB.ExpectExec(INSERT_SESSION_MESSAGE).WithArgs("s1", RoleAssistant, "In main [1].", created).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mockDB.ExpectCommit()
+
+	err = store.Append(ctx, "s1",
+		Message{Role: RoleUser, Content: "Where is it called?"},
+		Message{Role: RoleAssistant, Content: "In main [1].", CreatedAt: created})
+	assert.NoError(t, err)
+
+	// Expired sessions are deleted at most once per expireInterval
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec(INSERT_SESSION_MESSAGE).WithArgs("s1", RoleUser, "And Parse?", nil).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mockDB.ExpectCommit()
+	assert.NoError(t, store.Append(ctx, "s1", Message{Role: RoleUser, Content: "And Parse?"}))
+
+	later := created.Add(time.Minute + expireInterval)
+	store.now = func() time.Time { return later }
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec(DELETE_EXPIRED_SESSIONS).WithArgs(later.Add(-time.Hour)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(INSERT_SESSION_MESSAGE).WithArgs("s1", RoleUser, "And Scan?", nil).
+		WillReturnResult(sqlmock.NewResult(6, 1))
+	mockDB.ExpectCommit()
+	assert.NoError(t, store.Append(ctx, "s1", Message{Role: RoleUser, Content: "And Scan?"}))
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestDBStoreWithoutTTL(t *testing.T) {
+	db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	store := NewDBStore(db, 0)
+	ctx := context.Background()
+
+	// No cutoff and no expiry sweep; a zero limit loads the whole session
+	mockDB.ExpectQuery(SELECT_SESSION_MESSAGES).WithArgs("s1", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"role", "content", "created_at"}))
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec(INSERT_SESSION_MESSAGE).WithArgs("s1", RoleUser, "q", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mockDB.ExpectCommit()
+
+	history, err := store.History(ctx, "s1", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+	assert.NoError(t, store.Append(ctx, "s1", Message{Role: RoleUser, Content: "q"}))
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
@@ -0,0 +1,269 @@
+// Package snapshot serialises an index to a portable archive so it can be built once
+// and loaded elsewhere without re-embedding.
+//
+// An archive is a gzip-compressed stream of JSON lines: a header carrying the format
+// version, embedding model and dimension, one line per chunk with its embedding, and
+// a footer with the chunk count and a SHA-256 checksum of the chunk lines.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"time"
+
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+)
+
+// Format identifies snapshot archives; Version is bumped on incompatible changes.
+const (
+	Format  = "intelligent-doc-assistant/snapshot"
+	Version = 1
+)
+
+// maxLineSize bounds a single JSON line, i.e. one chunk with its source and embedding
+const maxLineSize = 64 << 20
+
+// Manifest describes the index a snapshot was taken from.
+type Manifest struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"createdAt"`
+	EmbeddingModel string    `json:"embeddingModel"`
+	Dimension      int       `json:"dimension"`
+}
+
+// record is one chunk line; embeddings are little-endian float32s, base64 encoded by encoding/json
+type record struct {
+	Chunk     parser.CodeChunk `json:"chunk"`
+	Embedding []byte           `json:"embedding"`
+}
+
+type footer struct {
+	Chunks int    `json:"chunks"`
+	SHA256 string `json:"sha256"`
+}
+
+// Source is a storage backend that can be exported.
+type Source interface {
+	EmbeddingInfo() (model string, dimension int)
+	ExportChunks(ctx context.Context, fn func(storage.StoredChunk) error) error
+}
+
+// Sink is a storage backend that can load a snapshot.
+type Sink interface {
+	ImportChunks(ctx context.Context, model string, dimension int, next func() (storage.StoredChunk, error)) (int, error)
+}
+
+// Export writes every chunk of src to w and returns the manifest and chunk count.
+func Export(ctx context.Context, src Source, w io.Writer) (Manifest, int, error) {
+	model, dimension := src.EmbeddingInfo()
+	manifest := Manifest{
+		Format:         Format,
+		Version:        Version,
+		CreatedAt:      time.Now().UTC(),
+		EmbeddingModel: model,
+		Dimension:      dimension,
+	}
+
+	gz := gzip.NewWriter(w)
+	header, err := json.Marshal(manifest)
+	if err != nil {
+		return Manifest{}, 0, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if _, err := gz.Write(append(header, '\n')); err != nil {
+		return Manifest{}, 0, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	sum := sha256.New()
+	count := 0
+	err = src.ExportChunks(ctx, func(stored storage.StoredChunk) error {
+		if len(stored.Embedding) != dimension {
+			return fmt.Errorf("chunk %s in %s has %d dimensions, expected %d",
+				stored.Chunk.Name, stored.Chunk.FilePath, len(stored.Embedding), dimension)
+		}
+
+		line, err := json.Marshal(record{Chunk: stored.Chunk, Embedding: encodeEmbedding(stored.Embedding)})
+		if err != nil {
+			return fmt.Errorf("failed to encode chunk: %w", err)
+		}
+		line = append(line, '\n')
+		sum.Write(line)
+		if _, err := gz.Write(line); err != nil {
+			return fmt.Errorf("failed to write chunk: %w", err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, 0, err
+	}
+
+	end, err := json.Marshal(footer{Chunks: count, SHA256: hex.EncodeToString(sum.Sum(nil))})
+	if err != nil {
+		return Manifest{}, 0, fmt.Errorf("failed to encode footer: %w", err)
+	}
+	if _, err := gz.Write(append(end, '\n')); err != nil {
+		return Manifest{}, 0, fmt.Errorf("failed to write footer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Manifest{}, 0, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, count, nil
+}
+
+// Import loads the snapshot in r into dst and returns its manifest and the number of chunks loaded.
+// The checksum is verified before dst sees the end of the stream, so a transactional sink
+// rolls back truncated or corrupted archives.
+func Import(ctx context.Context, dst Sink, r io.Reader) (Manifest, int, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return Manifest{}, 0, err
+	}
+
+	manifest := reader.Manifest()
+	count, err := dst.ImportChunks(ctx, manifest.EmbeddingModel, manifest.Dimension, reader.Next)
+	if err != nil {
+		return manifest, 0, err
+	}
+	return manifest, count, nil
+}
+
+// Reader reads chunks from a snapshot archive.
+type Reader struct {
+	scanner  *bufio.Scanner
+	manifest Manifest
+	count    int
+	sum      hash.Hash
+	done     bool
+}
+
+// NewReader opens a snapshot archive and validates its manifest.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot archive: %w", err)
+	}
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("snapshot has no manifest: %w", scannerErr(scanner))
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(scanner.Bytes(), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a snapshot archive (format %q)", manifest.Format)
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", manifest.Version, Version)
+	}
+	if manifest.EmbeddingModel == "" || manifest.Dimension <= 0 {
+		return nil, fmt.Errorf("snapshot manifest has no embedding model or dimension")
+	}
+
+	return &Reader{scanner: scanner, manifest: manifest, sum: sha256.New()}, nil
+}
+
+// Manifest returns the archive's manifest.
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+// Next returns the next chunk, or io.EOF after the footer has been verified.
+func (r *Reader) Next() (storage.StoredChunk, error) {
+	if r.done {
+		return storage.StoredChunk{}, io.EOF
+	}
+	if !r.scanner.Scan() {
+		return storage.StoredChunk{}, fmt.Errorf("snapshot is truncated: %w", scannerErr(r.scanner))
+	}
+	line := r.scanner.Bytes()
+
+	// The footer is the only line without a chunk
+	if !bytes.HasPrefix(line, []byte(`{"chunk":`)) {
+		return storage.StoredChunk{}, r.verify(line)
+	}
+
+	r.sum.Write(line)
+	r.sum.Write([]byte{'\n'})
+
+	var rec record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return storage.StoredChunk{}, fmt.Errorf("failed to decode chunk %d: %w", r.count+1, err)
+	}
+	embedding, err := decodeEmbedding(rec.Embedding)
+	if err != nil {
+		return storage.StoredChunk{}, fmt.Errorf("chunk %d: %w", r.count+1, err)
+	}
+	if len(embedding) != r.manifest.Dimension {
+		return storage.StoredChunk{}, fmt.Errorf("chunk %d has %d dimensions, expected %d", r.count+1, len(embedding), r.manifest.Dimension)
+	}
+
+	r.count++
+	return storage.StoredChunk{Chunk: rec.Chunk, Embedding: embedding}, nil
+}
+
+// verify checks the footer against the chunks read and returns io.EOF when they match
+func (r *Reader) verify(line []byte) error {
+	var end footer
+	if err := json.Unmarshal(line, &end); err != nil {
+		return fmt.Errorf("failed to decode footer: %w", err)
+	}
+	if end.Chunks != r.count {
+		return fmt.Errorf("snapshot footer lists %d chunks but %d were read", end.Chunks, r.count)
+	}
+	if sum := hex.EncodeToString(r.sum.Sum(nil)); sum != end.SHA256 {
+		return fmt.Errorf("snapshot checksum mismatch")
+	}
+	if r.scanner.Scan() {
+		return fmt.Errorf("unexpected data after snapshot footer")
+	}
+	if err := r.scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	r.done = true
+	return io.EOF
+}
+
+// scannerErr reports why a scanner stopped, treating a clean end of input as truncation
+func scannerErr(scanner *bufio.Scanner) error {
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func encodeEmbedding(embedding []float32) []byte {
+	buf := make([]byte, 4*len(embedding))
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) ([]float32, error) {
+	if len(buf)%4 != 0 {
+		return nil, errors.New("embedding length is not a multiple of 4 bytes")
+	}
+	embedding := make([]float32, len(buf)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return embedding, nil
+}
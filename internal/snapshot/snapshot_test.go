@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+	"intelligent-doc-assistant/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Both storage backends can be exported and imported
+var (
+	_ Source = (*storage.Store)(nil)
+	_ Sink   = (*storage.Store)(nil)
+	_ Source = (*storage.MemoryStore)(nil)
+	_ Sink   = (*storage.MemoryStore)(nil)
+)
+
+// memoryIndex is an in-memory Source and Sink
+type memoryIndex struct {
+	model     string
+	dimension int
+	chunks    []storage.StoredChunk
+}
+
+func (m *memoryIndex) EmbeddingInfo() (string, int) {
+	return m.model, m.dimension
+}
+
+func (m *memoryIndex) ExportChunks(ctx context.Context, fn func(storage.StoredChunk) error) error {
+	for _, c := range m.chunks {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryIndex) ImportChunks(ctx context.Context, model string, dimension int, next func() (storage.StoredChunk, error)) (int, error) {
+	var chunks []storage.StoredChunk
+	for {
+		c, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		chunks = append(chunks, c)
+	}
+	// Only commit a fully verified stream
+	m.model, m.dimension, m.chunks = model, dimension, chunks
+	return len(chunks), nil
+}
+
+func testIndex() *memoryIndex {
+	return &memoryIndex{
+		model:     "models/text-embedding-004",
+		dimension: 2,
+		chunks: []storage.StoredChunk{
+			{Chunk: parser.CodeChunk{Repo: "r", Name: "F", FilePath: "f.go"}, Embedding: []float32{0.25, -1}},
+			{Chunk: parser.CodeChunk{Repo: "r", Name: "G", FilePath: "g.go", Content: "func G() {}"}, Embedding: []float32{3, 0}},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	manifest, exported, err := Export(context.Background(), testIndex(), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, exported)
+	assert.Equal(t, Version, manifest.Version)
+
+	dst := &memoryIndex{}
+	got, imported, err := Import(context.Background(), dst, &buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, imported)
+	assert.Equal(t, "models/text-embedding-004", got.EmbeddingModel)
+	assert.Equal(t, testIndex(), dst)
+}
+
+func TestImportRejectsDamagedArchives(t *testing.T) {
+	var buf bytes.Buffer
+	_, _, err := Export(context.Background(), testIndex(), &buf)
+	assert.NoError(t, err)
+	lines := bytes.SplitAfter(gunzip(t, buf.Bytes()), []byte("\n"))
+
+	tests := []struct {
+		name  string
+		lines [][]byte
+	}{
+		{"truncated", lines[:2]},
+		{"missing chunk", [][]byte{lines[0], lines[1], lines[3]}},
+		{"modified chunk", [][]byte{lines[0], bytes.Replace(lines[1], []byte(`"F"`), []byte(`"H"`), 1), lines[2], lines[3]}},
+		{"newer version", [][]byte{bytes.Replace(lines[0], []byte(`"version":1`), []byte(`"version":2`), 1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := &memoryIndex{}
+			_, _, err := Import(context.Background(), dst, bytes.NewReader(gzipLines(t, tt.lines)))
+
+			assert.Error(t, err)
+			assert.Empty(t, dst.chunks)
+		})
+	}
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	out, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	return out
+}
+
+func gzipLines(t *testing.T, lines [][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(bytes.Join(lines, nil))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"intelligent-doc-assistant/config"
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/parser"
+)
+
+// StoredChunk is a chunk together with the embedding it is indexed by.
+type StoredChunk struct {
+	Chunk     parser.CodeChunk
+	Embedding []float32
+}
+
+// EmbeddingInfo returns the model and dimension of the stored vectors.
+func (s *Store) EmbeddingInfo() (string, int) {
+	return s.embedder.Model(), s.dimension
+}
+
+// ExportChunks calls fn for every stored chunk in insertion order.
+func (s *Store) ExportChunks(ctx context.Context, fn func(StoredChunk) error) error {
+	rows, err := s.db.QueryContext(ctx, SELECT_ALL_CHUNKS)
+	if err != nil {
+		return fmt.Errorf("failed to read chunks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			chunkData []byte
+			embedding Vector
+		)
+		if err := rows.Scan(&chunkData, &embedding); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var chunk parser.CodeChunk
+		if err := json.Unmarshal(chunkData, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal chunk: %w", err)
+		}
+		if err := fn(StoredChunk{Chunk: chunk, Embedding: embedding}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportChunks upserts the chunks returned by next, until it returns io.EOF, in one
+// transaction. Vectors from a different model or dimension can only be imported into
+// an empty index, which is then switched to them.
+func (s *Store) ImportChunks(ctx context.Context, model string, dimension int, next func() (StoredChunk, error)) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // will be ignored if tx.Commit() is called
+
+	// Block concurrent ingestion while the index may change model
+	if _, err := tx.ExecContext(ctx, LOCK_CODE_CHUNKS); err != nil {
+		return 0, fmt.Errorf("failed to lock code_chunks: %w", err)
+	}
+
+	currentModel, currentDimension := s.EmbeddingInfo()
+	switchModel := model != currentModel || dimension != currentDimension
+	if switchModel {
+		var rows int
+		if err := tx.QueryRowContext(ctx, COUNT_CODE_CHUNKS).Scan(&rows); err != nil {
+			return 0, fmt.Errorf("failed to count chunks: %w", err)
+		}
+		if rows > 0 {
+			return 0, fmt.Errorf("snapshot was built with %s (%d dimensions) but the index holds %d chunks from %s (%d dimensions); import into an empty index",
+				model, dimension, rows, currentModel, currentDimension)
+		}
+
+		for _, query := range []string{DROP_EMBEDDING_INDEX, fmt.Sprintf(RETYPE_EMBEDDING_COLUMN, dimension)} {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return 0, fmt.Errorf("failed to change embedding dimension: %w", err)
+			}
+		}
+	}
+
+	var (
+		imported int
+		chunks   []parser.CodeChunk
+		vectors  [][]float32
+	)
+	flush := func() error {
+		if err := insertChunks(ctx, tx, chunks, vectors, dimension); err != nil {
+			return err
+		}
+		imported += len(chunks)
+		chunks, vectors = nil, nil
+		return nil
+	}
+
+	for {
+		stored, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		chunks = append(chunks, stored.Chunk)
+		vectors = append(vectors, stored.Embedding)
+		if len(chunks) == insertBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	if switchModel {
+		// Built after loading so IVFFlat lists fit the imported rows
+		if err := s.createIndex(ctx, tx); err != nil {
+			return 0, err
+		}
+		if err := setMetadata(ctx, tx, metaEmbeddingModel, model); err != nil {
+			return 0, err
+		}
+		if err := setMetadata(ctx, tx, metaEmbeddingDimension, strconv.Itoa(dimension)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if switchModel {
+		embedder, err := embeddings.NewEmbedderFromConfig(config.GetConfig(), model)
+		if err != nil {
+			return imported, fmt.Errorf("imported %d chunks but failed to create embedder for %s: %w", imported, model, err)
+		}
+		s.embedder = embedder
+		s.dimension = dimension
+		fmt.Printf("Switched index to embedding model %s (%d dimensions)\n", model, dimension)
+	}
+	return imported, nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportChunks(t *testing.T) {
+	store, mockDB := newMockStore(t, new(MockEmbedder))
+	chunkData, _ := json.Marshal(parser.CodeChunk{Name: "F"})
+	mockDB.ExpectQuery(SELECT_ALL_CHUNKS).
+		WillReturnRows(sqlmock.NewRows([]string{"chunk_text", "embedding"}).AddRow(chunkData, "[1,2,3]"))
+
+	var got []StoredChunk
+	err := store.ExportChunks(context.Background(), func(c StoredChunk) error {
+		got = append(got, c)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []StoredChunk{{Chunk: parser.CodeChunk{Name: "F"}, Embedding: []float32{1, 2, 3}}}, got)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestImportChunks(t *testing.T) {
+	chunks := []StoredChunk{{Chunk: parser.CodeChunk{Repo: "r", Symbol: "p.F", Name: "F", FilePath: "f.go"}, Embedding: []float32{1, 0, 0}}}
+	next := func() func() (StoredChunk, error) {
+		i := 0
+		return func() (StoredChunk, error) {
+			if i == len(chunks) {
+				return StoredChunk{}, io.EOF
+			}
+			i++
+			return chunks[i-1], nil
+		}
+	}
+
+	t.Run("same model", func(t *testing.T) {
+		store, mockDB := newMockStore(t, new(MockEmbedder))
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(LOCK_CODE_CHUNKS).WillReturnResult(sqlmock.NewResult(0, 0))
+		mockDB.ExpectExec(fmt.Sprintf(INSERT_CODE_CHUNKS, insertValues(1))).
+			WithArgs("r", "f.go", "p.F", "", sqlmock.AnyArg(), Vector{1, 0, 0}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mockDB.ExpectCommit()
+
+		imported, err := store.ImportChunks(context.Background(), "test-model", 3, next())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, imported)
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+
+	t.Run("other model into a populated index", func(t *testing.T) {
+		store, mockDB := newMockStore(t, new(MockEmbedder))
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(LOCK_CODE_CHUNKS).WillReturnResult(sqlmock.NewResult(0, 0))
+		mockDB.ExpectQuery(COUNT_CODE_CHUNKS).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+		mockDB.ExpectRollback()
+
+		_, err := store.ImportChunks(context.Background(), "other-model", 3, next())
+
+		assert.ErrorContains(t, err, "import into an empty index")
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Vector index types supported by pgvector
+const (
+	IndexHNSW    = "hnsw"
+	IndexIVFFlat = "ivfflat"
+)
+
+// defaultHNSWEFSearch is pgvector's default hnsw.ef_search. HNSW scans return at most
+// ef_search rows, so searches asking for more candidates raise it.
+const defaultHNSWEFSearch = 40
+
+// IndexConfig describes how the embedding index is built.
+type IndexConfig struct {
+	Type string
+
+	// HNSW build parameters: graph degree and candidate list size during construction
+	M              int
+	EFConstruction int
+
+	// IVFFlat list count; 0 derives it from the number of rows
+	Lists int
+}
+
+// DefaultIndexConfig uses pgvector's default HNSW parameters.
+func DefaultIndexConfig() IndexConfig {
+	return IndexConfig{Type: IndexHNSW, M: 16, EFConstruction: 64}
+}
+
+// Validate reports parameters pgvector would reject.
+func (c IndexConfig) Validate() error {
+	switch c.Type {
+	case IndexHNSW:
+		if c.M < 2 || c.M > 100 {
+			return fmt.Errorf("hnsw m must be between 2 and 100")
+		}
+		if c.EFConstruction < 2*c.M || c.EFConstruction > 1000 {
+			return fmt.Errorf("hnsw ef_construction must be between 2*m and 1000")
+		}
+	case IndexIVFFlat:
+		if c.Lists < 0 || c.Lists > 32768 {
+			return fmt.Errorf("ivfflat lists must be between 1 and 32768, or 0 to derive it from the row count")
+		}
+	default:
+		return fmt.Errorf("unknown index type %q", c.Type)
+	}
+	return nil
+}
+
+// lists returns the IVFFlat list count for a table of rows, following pgvector's
+// guidance of rows/1000 up to a million rows and sqrt(rows) beyond
+func (c IndexConfig) lists(rows int) int {
+	if c.Lists > 0 {
+		return c.Lists
+	}
+	lists := rows / 1000
+	if rows > 1000000 {
+		lists = int(math.Sqrt(float64(rows)))
+	}
+	return max(lists, 1)
+}
+
+// String describes the index as recorded in index metadata, e.g. "hnsw(m=16,ef_construction=64)"
+func (c IndexConfig) String() string {
+	if c.Type == IndexIVFFlat {
+		if c.Lists == 0 {
+			return "ivfflat(lists=auto)"
+		}
+		return fmt.Sprintf("ivfflat(lists=%d)", c.Lists)
+	}
+	return fmt.Sprintf("hnsw(m=%d,ef_construction=%d)", c.M, c.EFConstruction)
+}
+
+// createSQL renders the CREATE INDEX statement for a table of rows
+func (c IndexConfig) createSQL(name string, rows int, concurrently bool) string {
+	with := fmt.Sprintf("m = %d, ef_construction = %d", c.M, c.EFConstruction)
+	if c.Type == IndexIVFFlat {
+		with = fmt.Sprintf("lists = %d", c.lists(rows))
+	}
+
+	mode := ""
+	if concurrently {
+		mode = "CONCURRENTLY "
+	}
+	return fmt.Sprintf(CREATE_EMBEDDING_INDEX, mode, name, c.Type, with)
+}
+
+// createIndex builds the embedding index inside tx, which must hold a lock on code_chunks
+func (s *Store) createIndex(ctx context.Context, tx execQuerier) error {
+	var rows int
+	if err := tx.QueryRowContext(ctx, COUNT_CODE_CHUNKS).Scan(&rows); err != nil {
+		return fmt.Errorf("failed to count chunks: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.index.createSQL(embeddingIndexName, rows, false)); err != nil {
+		return fmt.Errorf("failed to create embedding index: %w", err)
+	}
+	return setMetadata(ctx, tx, metaEmbeddingIndex, s.index.String())
+}
+
+// Reindex rebuilds the embedding index with the configured type and parameters. The new
+// index is built concurrently next to the old one, so searches and ingestion keep working,
+// and then swapped in. Run it after bulk ingestion so IVFFlat lists fit the data.
+func (s *Store) Reindex(ctx context.Context) error {
+	if err := s.index.Validate(); err != nil {
+		return err
+	}
+
+	var rows int
+	if err := s.db.QueryRowContext(ctx, COUNT_CODE_CHUNKS).Scan(&rows); err != nil {
+		return fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	// A failed concurrent build leaves an invalid index behind
+	if _, err := s.db.ExecContext(ctx, DROP_NEXT_EMBEDDING_INDEX); err != nil {
+		return fmt.Errorf("failed to drop leftover index: %w", err)
+	}
+	fmt.Printf("Building %s index over %d chunks...\n", s.index, rows)
+	if _, err := s.db.ExecContext(ctx, s.index.createSQL(nextEmbeddingIndexName, rows, true)); err != nil {
+		return fmt.Errorf("failed to build embedding index: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // will be ignored if tx.Commit() is called
+
+	for _, query := range []string{DROP_EMBEDDING_INDEX, RENAME_NEXT_EMBEDDING_INDEX, ANALYZE_CODE_CHUNKS} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to swap embedding index: %w", err)
+		}
+	}
+	if err := setMetadata(ctx, tx, metaEmbeddingIndex, s.index.String()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// searchSettings returns set_config calls tuning index scans for a search needing candidates rows
+func (s *Store) searchSettings(opts SearchOptions, candidates int) [][2]string {
+	efSearch := opts.EFSearch
+	if efSearch == 0 {
+		efSearch = s.efSearch
+	}
+	if efSearch == 0 && candidates > defaultHNSWEFSearch {
+		efSearch = candidates
+	}
+	probes := opts.Probes
+	if probes == 0 {
+		probes = s.probes
+	}
+
+	var settings [][2]string
+	if efSearch > 0 {
+		settings = append(settings, [2]string{"hnsw.ef_search", strconv.Itoa(efSearch)})
+	}
+	if probes > 0 {
+		settings = append(settings, [2]string{"ivfflat.probes", strconv.Itoa(probes)})
+	}
+	return settings
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexConfigCreateSQL(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       IndexConfig
+		rows         int
+		concurrently bool
+		want         string
+	}{
+		{
+			name:   "hnsw",
+			config: DefaultIndexConfig(),
+			want:   "CREATE INDEX IF NOT EXISTS code_chunks_embedding_idx ON code_chunks\n\tUSING hnsw (embedding vector_cosine_ops)\n\tWITH (m = 16, ef_construction = 64);",
+		},
+		{
+			name:         "ivfflat with lists derived from rows",
+			config:       IndexConfig{Type: IndexIVFFlat},
+			rows:         250000,
+			concurrently: true,
+			want:         "CREATE INDEX CONCURRENTLY IF NOT EXISTS code_chunks_embedding_idx ON code_chunks\n\tUSING ivfflat (embedding vector_cosine_ops)\n\tWITH (lists = 250);",
+		},
+		{
+			name:   "ivfflat on a small table",
+			config: IndexConfig{Type: IndexIVFFlat},
+			rows:   10,
+			want:   "CREATE INDEX IF NOT EXISTS code_chunks_embedding_idx ON code_chunks\n\tUSING ivfflat (embedding vector_cosine_ops)\n\tWITH (lists = 1);",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.createSQL(embeddingIndexName, tt.rows, tt.concurrently)
+			assert.Equal(t, "\n\t"+tt.want, got)
+		})
+	}
+}
+
+func TestIndexConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultIndexConfig().Validate())
+	assert.NoError(t, IndexConfig{Type: IndexIVFFlat, Lists: 100}.Validate())
+	assert.Error(t, IndexConfig{Type: IndexHNSW, M: 16, EFConstruction: 8}.Validate())
+	assert.Error(t, IndexConfig{Type: "diskann"}.Validate())
+}
+
+func TestSearchSettings(t *testing.T) {
+	store := &Store{index: DefaultIndexConfig(), probes: 10}
+
+	// Large candidate sets raise ef_search so HNSW scans can return them all
+	assert.Equal(t, [][2]string{{"hnsw.ef_search", "200"}, {"ivfflat.probes", "10"}},
+		store.searchSettings(SearchOptions{}, 200))
+	assert.Equal(t, [][2]string{{"hnsw.ef_search", "64"}, {"ivfflat.probes", "3"}},
+		store.searchSettings(SearchOptions{EFSearch: 64, Probes: 3}, 200))
+
+	store.probes = 0
+	assert.Empty(t, store.searchSettings(SearchOptions{}, 20))
+}
+
+func TestReindex(t *testing.T) {
+	store, mockDB := newMockStore(t, new(MockEmbedder))
+	store.index = IndexConfig{Type: IndexIVFFlat}
+
+	mockDB.ExpectQuery(COUNT_CODE_CHUNKS).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5000))
+	mockDB.ExpectExec(DROP_NEXT_EMBEDDING_INDEX).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(store.index.createSQL(nextEmbeddingIndexName, 5000, true)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec(DROP_EMBEDDING_INDEX).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(RENAME_NEXT_EMBEDDING_INDEX).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(ANALYZE_CODE_CHUNKS).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(SET_INDEX_METADATA).WithArgs(metaEmbeddingIndex, "ivfflat(lists=auto)").WillReturnResult(sqlmock.NewResult(0, 1))
+	mockDB.ExpectCommit()
+
+	assert.NoError(t, store.Reindex(context.Background()))
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
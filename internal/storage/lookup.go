@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"intelligent-doc-assistant/internal/parser"
+)
+
+// DefaultFindLimit bounds the chunks FindChunks returns when the filter sets no limit
+const DefaultFindLimit = 50
+
+// ChunkFilter selects chunks by exact metadata rather than relevance. Empty fields match
+// every chunk.
+type ChunkFilter struct {
+	// Symbol matches the package-qualified symbol or the bare name of a chunk
+	Symbol   string
+	Repo     string
+	FilePath string
+	Package  string
+	// Contains matches chunks whose source contains the text
+	Contains string
+	// FromLine and ToLine, when set, match chunks overlapping that range of lines
+	FromLine int
+	ToLine   int
+	Limit    int
+}
+
+func (f ChunkFilter) limit() int {
+	if f.Limit > 0 {
+		return f.Limit
+	}
+	return DefaultFindLimit
+}
+
+// Matches reports whether chunk passes the filter
+func (f ChunkFilter) Matches(chunk parser.CodeChunk) bool {
+	switch {
+	case f.Symbol != "" && chunk.Symbol != f.Symbol && chunk.Name != f.Symbol:
+		return false
+	case f.Repo != "" && chunk.Repo != f.Repo:
+		return false
+	case f.FilePath != "" && chunk.FilePath != f.FilePath:
+		return false
+	case f.Package != "" && chunk.Package != f.Package:
+		return false
+	case f.Contains != "" && !strings.Contains(chunk.Content, f.Contains):
+		return false
+	case f.FromLine > 0 && chunk.EndLine < f.FromLine:
+		return false
+	case f.ToLine > 0 && chunk.StartLine > f.ToLine:
+		return false
+	}
+	return true
+}
+
+// filterSQL renders the filter as SQL conditions with placeholders numbered from firstArg
+func (f ChunkFilter) filterSQL(firstArg int) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, firstArg+len(args)-1))
+	}
+
+	if f.Symbol != "" {
+		add("(symbol = $%[1]d OR chunk_text->>'Name' = $%[1]d)", f.Symbol)
+	}
+	if f.Repo != "" {
+		add("repo = $%d", f.Repo)
+	}
+	if f.FilePath != "" {
+		add("file_path = $%d", f.FilePath)
+	}
+	if f.Package != "" {
+		add("chunk_text->>'Package' = $%d", f.Package)
+	}
+	if f.Contains != "" {
+		add("strpos(chunk_text->>'Content', $%d) > 0", f.Contains)
+	}
+	if f.FromLine > 0 {
+		add("(chunk_text->>'EndLine')::int >= $%d", f.FromLine)
+	}
+	if f.ToLine > 0 {
+		add("(chunk_text->>'StartLine')::int <= $%d", f.ToLine)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "AND " + strings.Join(conditions, " AND "), args
+}
+
+// FindChunks returns the chunks matching filter, ordered by file and line
+func (s *Store) FindChunks(ctx context.Context, filter ChunkFilter) ([]parser.CodeChunk, error) {
+	conditions, args := filter.filterSQL(2)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(FIND_CHUNKS, conditions), append([]interface{}{filter.limit()}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []parser.CodeChunk
+	for rows.Next() {
+		var chunkData []byte
+		if err := rows.Scan(&chunkData); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var chunk parser.CodeChunk
+		if err := json.Unmarshal(chunkData, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// FindChunks returns the chunks matching filter, ordered by file and line
+func (m *MemoryStore) FindChunks(ctx context.Context, filter ChunkFilter) ([]parser.CodeChunk, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chunks []parser.CodeChunk
+	for _, row := range m.rows {
+		if filter.Matches(row.chunk) {
+			chunks = append(chunks, row.chunk)
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		a, b := chunks[i], chunks[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.StartLine < b.StartLine
+	})
+
+	if limit := filter.limit(); len(chunks) > limit {
+		chunks = chunks[:limit]
+	}
+	return chunks, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChunkFilterSQL(t *testing.T) {
+	conditions, args := ChunkFilter{Symbol: "Parse", Package: "parser", Contains: "Parse("}.filterSQL(2)
+
+	assert.Equal(t, "AND (symbol = $2 OR chunk_text->>'Name' = $2) AND chunk_text->>'Package' = $3 AND strpos(chunk_text->>'Content', $4) > 0", conditions)
+	assert.Equal(t, []interface{}{"Parse", "parser", "Parse("}, args)
+
+	conditions, args = ChunkFilter{FilePath: "cart.go", FromLine: 10, ToLine: 20}.filterSQL(2)
+	assert.Equal(t, "AND file_path = $2 AND (chunk_text->>'EndLine')::int >= $3 AND (chunk_text->>'StartLine')::int <= $4", conditions)
+	assert.Equal(t, []interface{}{"cart.go", 10, 20}, args)
+
+	conditions, args = ChunkFilter{}.filterSQL(2)
+	assert.Empty(t, conditions)
+	assert.Empty(t, args)
+}
+
+func TestStoreFindChunks(t *testing.T) {
+	store, mockDB := newMockStore(t, new(MockEmbedder))
+	chunkData, _ := json.Marshal(parser.CodeChunk{Name: "Parse", FilePath: "parser.go"})
+	mockDB.ExpectQuery(fmt.Sprintf(FIND_CHUNKS, "AND file_path = $2")).
+		WithArgs(10, "parser.go").
+		WillReturnRows(sqlmock.NewRows([]string{"chunk_text"}).AddRow(chunkData))
+
+	chunks, err := store.FindChunks(context.Background(), ChunkFilter{FilePath: "parser.go", Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []parser.CodeChunk{{Name: "Parse", FilePath: "parser.go"}}, chunks)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestMemoryStoreFindChunks(t *testing.T) {
+	embedder := new(MockEmbedder)
+	store := NewMemoryStore(embedder)
+	embedder.On("CreateEmbeddings", mock.Anything).Return([][]float32{{1}, {1}, {1}}, nil)
+	assert.NoError(t, store.StoreChunks(context.Background(), []parser.CodeChunk{
+		{Package: "shop", Symbol: "shop.Total", Name: "Total", FilePath: "cart.go", StartLine: 20, Content: "return discount.Apply(total)"},
+		{Package: "shop", Symbol: "shop.Discount.Apply", Name: "Apply", FilePath: "discount.go", StartLine: 8},
+		{Package: "shop", Symbol: "shop.AddItem", Name: "AddItem", FilePath: "cart.go", StartLine: 5},
+	}))
+
+	chunks, err := store.FindChunks(context.Background(), ChunkFilter{Package: "shop"})
+	assert.NoError(t, err)
+	var names []string
+	for _, chunk := range chunks {
+		names = append(names, chunk.Name)
+	}
+	assert.Equal(t, []string{"AddItem", "Total", "Apply"}, names)
+
+	chunks, err = store.FindChunks(context.Background(), ChunkFilter{Contains: "Apply("})
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 1)
+	assert.Equal(t, "Total", chunks[0].Name)
+
+	chunks, err = store.FindChunks(context.Background(), ChunkFilter{FilePath: "cart.go", ToLine: 10})
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 1)
+	assert.Equal(t, "AddItem", chunks[0].Name)
+
+	chunks, err = store.FindChunks(context.Background(), ChunkFilter{Symbol: "shop.Discount.Apply"})
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 1)
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/parser"
+)
+
+// ChunkStore stores code chunks and retrieves them for questions. It is implemented by
+// Store on PostgreSQL and by MemoryStore.
+type ChunkStore interface {
+	StoreChunks(ctx context.Context, chunks []parser.CodeChunk) error
+	SearchChunks(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error)
+	SearchQueries(ctx context.Context, queries []Query, opts SearchOptions) ([]SearchResult, error)
+	FindChunks(ctx context.Context, filter ChunkFilter) ([]parser.CodeChunk, error)
+	// EmbeddingInfo returns the model and dimension of the stored vectors
+	EmbeddingInfo() (string, int)
+}
+
+// Keyword match weights by field, as ts_rank_cd weighs the A, B and C labels of search_vector
+const (
+	memoryNameWeight        = 1.0
+	memoryDescriptionWeight = 0.4
+	memoryContentWeight     = 0.2
+)
+
+// MemoryStore keeps chunks and their embeddings in process memory and searches them
+// exhaustively. It ranks like Store, fusing vector and keyword matches and diversifying
+// the result, which makes it suitable for tests and small demos without PostgreSQL.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	embedder embeddings.Embedder
+	nextID   int64
+	rows     []memoryRow
+	index    map[chunkIdentity]int
+}
+
+type memoryRow struct {
+	id        int64
+	chunk     parser.CodeChunk
+	embedding Vector
+	// words maps each lower-cased word of the chunk to its best field weight
+	words map[string]float64
+}
+
+// NewMemoryStore creates an empty in-memory store that embeds with embedder.
+func NewMemoryStore(embedder embeddings.Embedder) *MemoryStore {
+	return &MemoryStore{embedder: embedder, index: make(map[chunkIdentity]int)}
+}
+
+// StoreChunks embeds chunks and upserts them by identity
+func (m *MemoryStore) StoreChunks(ctx context.Context, chunks []parser.CodeChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	chunks = dedupeChunks(chunks)
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = embeddingText(chunk)
+	}
+	embeddings, err := m.embedder.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to generate embeddings for %s: %w", chunks[0].FilePath, err)
+	}
+	if len(embeddings) != len(chunks) {
+		return fmt.Errorf("expected %d embeddings, got %d", len(chunks), len(embeddings))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, chunk := range chunks {
+		m.put(chunk, embeddings[i])
+	}
+	return nil
+}
+
+// put upserts a chunk by identity; the caller must hold m.mu
+func (m *MemoryStore) put(chunk parser.CodeChunk, embedding []float32) {
+	row := memoryRow{chunk: chunk, embedding: Vector(embedding), words: chunkWords(chunk)}
+	if at, ok := m.index[identityOf(chunk)]; ok {
+		row.id = m.rows[at].id
+		m.rows[at] = row
+		return
+	}
+	m.nextID++
+	row.id = m.nextID
+	m.index[identityOf(chunk)] = len(m.rows)
+	m.rows = append(m.rows, row)
+}
+
+// EmbeddingInfo returns the embedding model and the dimension of the stored vectors, 0
+// while the store is empty
+func (m *MemoryStore) EmbeddingInfo() (string, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dimension := 0
+	if len(m.rows) > 0 {
+		dimension = len(m.rows[0].embedding)
+	}
+	return m.embedder.Model(), dimension
+}
+
+// ExportChunks calls fn for every stored chunk in insertion order, see Store.ExportChunks
+func (m *MemoryStore) ExportChunks(ctx context.Context, fn func(StoredChunk) error) error {
+	m.mu.RLock()
+	rows := append([]memoryRow(nil), m.rows...)
+	m.mu.RUnlock()
+
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(StoredChunk{Chunk: row.chunk, Embedding: append([]float32(nil), row.embedding...)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportChunks upserts the chunks returned by next, until it returns io.EOF, all or
+// nothing. Unlike Store, a MemoryStore cannot switch embedders, so the snapshot must have
+// been built with its embedding model, and with its dimension unless the store is empty.
+func (m *MemoryStore) ImportChunks(ctx context.Context, model string, dimension int, next func() (StoredChunk, error)) (int, error) {
+	currentModel, currentDimension := m.EmbeddingInfo()
+	if model != currentModel {
+		return 0, fmt.Errorf("snapshot was built with %s but the store embeds with %s", model, currentModel)
+	}
+	if currentDimension != 0 && dimension != currentDimension {
+		return 0, fmt.Errorf("snapshot has %d dimensions but the store holds %d", dimension, currentDimension)
+	}
+
+	var imported []StoredChunk
+	for {
+		stored, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(stored.Embedding) != dimension {
+			return 0, fmt.Errorf("chunk %s has %d dimensions, expected %d", stored.Chunk.FilePath, len(stored.Embedding), dimension)
+		}
+		imported = append(imported, stored)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Checked again in case chunks were stored while reading
+	if len(m.rows) > 0 && len(m.rows[0].embedding) != dimension {
+		return 0, fmt.Errorf("snapshot has %d dimensions but the store holds %d", dimension, len(m.rows[0].embedding))
+	}
+	for _, stored := range imported {
+		m.put(stored.Chunk, append([]float32(nil), stored.Embedding...))
+	}
+	return len(imported), nil
+}
+
+// SearchChunks finds the chunks most relevant to query, see Store.SearchChunks
+func (m *MemoryStore) SearchChunks(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	return m.SearchQueries(ctx, []Query{{Text: query, Weight: 1}}, opts)
+}
+
+// SearchQueries fuses the results of several phrasings of a question, see Store.SearchQueries
+func (m *MemoryStore) SearchQueries(ctx context.Context, queries []Query, opts SearchOptions) ([]SearchResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no search query")
+	}
+
+	texts := make([]string, len(queries))
+	for i, query := range queries {
+		texts[i] = query.Text
+	}
+	embeddings, err := m.embedder.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	if len(embeddings) != len(queries) {
+		return nil, fmt.Errorf("no embedding generated for query")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []memoryRow
+	for _, row := range m.rows {
+		if opts.Matches(row.chunk) {
+			rows = append(rows, row)
+		}
+	}
+
+	limit := opts.limit()
+	candidates := limit * candidateMultiplier
+	var (
+		lists   [][]SearchResult
+		weights []float64
+	)
+
+	for i, query := range queries {
+		if opts.VectorWeight > 0 {
+			var results []SearchResult
+			for _, row := range rows {
+				if similarity := cosineSimilarity(Vector(embeddings[i]), row.embedding); similarity > opts.MinScore {
+					results = append(results, row.result(similarity))
+				}
+			}
+			lists = append(lists, topResults(results, candidates, func(r SearchResult) float64 { return r.Similarity }))
+			weights = append(weights, opts.VectorWeight*query.Weight)
+		}
+
+		if terms := QueryTerms(query.Text); opts.KeywordWeight > 0 && len(terms) > 0 {
+			var results []SearchResult
+			ranks := make(map[int64]float64)
+			for _, row := range rows {
+				rank := 0.0
+				for _, term := range terms {
+					rank += row.words[term]
+				}
+				if rank > 0 {
+					ranks[row.id] = rank
+					// Like SEARCH_KEYWORD_CHUNKS, similarity is reported against the first query
+					results = append(results, row.result(cosineSimilarity(Vector(embeddings[0]), row.embedding)))
+				}
+			}
+			lists = append(lists, topResults(results, candidates, func(r SearchResult) float64 { return ranks[r.ID] }))
+			weights = append(weights, opts.KeywordWeight*query.Weight)
+		}
+	}
+
+	results := fuseResults(lists, weights)
+	return diversify(results, limit, opts.lambda(), opts.MaxPerFile), nil
+}
+
+func (r memoryRow) result(similarity float64) SearchResult {
+	return SearchResult{ID: r.id, Chunk: r.chunk, Similarity: similarity, Embedding: r.embedding}
+}
+
+// topResults sorts results by score, highest first with insertion order breaking ties, and keeps n
+func topResults(results []SearchResult, n int, score func(SearchResult) float64) []SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return score(results[i]) > score(results[j])
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+	return results
+}
+
+// chunkWords indexes the words of a chunk's name, description and source like search_vector
+func chunkWords(chunk parser.CodeChunk) map[string]float64 {
+	words := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, word := range identifierWords(text) {
+			word = strings.ToLower(word)
+			if weight > words[word] {
+				words[word] = weight
+			}
+		}
+	}
+	add(chunk.Name, memoryNameWeight)
+	add(chunk.Description, memoryDescriptionWeight)
+	add(chunk.Content, memoryContentWeight)
+	return words
+}
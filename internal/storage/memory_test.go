@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMemoryStore(t *testing.T) {
+	embedder := new(MockEmbedder)
+	store := NewMemoryStore(embedder)
+	ctx := context.Background()
+
+	chunks := []parser.CodeChunk{
+		{FilePath: "parser.go", Name: "ParseFile", Kind: parser.KindFunction, Language: "go", Content: "func ParseFile() {}"},
+		{FilePath: "store.go", Name: "StoreChunks", Kind: parser.KindMethod, Language: "go", Content: "func (s *Store) StoreChunks() {}"},
+		{FilePath: "util.go", Name: "helper", Kind: parser.KindFunction, Language: "go", Description: "Helper used by ParseFile"},
+	}
+	embedder.On("CreateEmbeddings", mock.Anything).Return([][]float32{{1, 0, 0}, {0, 1, 0}, {0.6, 0, 0.8}}, nil).Once()
+	assert.NoError(t, store.StoreChunks(ctx, chunks))
+
+	t.Run("fuses vector and keyword matches", func(t *testing.T) {
+		embedder.On("CreateEmbeddings", []string{"how does ParseFile work"}).Return([][]float32{{1, 0, 0}}, nil).Once()
+
+		results, err := store.SearchChunks(ctx, "how does ParseFile work", SearchOptions{Limit: 5, MinScore: 0.5, VectorWeight: 1, KeywordWeight: 1})
+
+		assert.NoError(t, err)
+		names := make([]string, len(results))
+		for i, result := range results {
+			names[i] = result.Chunk.Name
+		}
+		assert.Equal(t, []string{"ParseFile", "helper"}, names)
+		assert.Equal(t, int64(1), results[0].ID)
+		assert.InDelta(t, 1.0, results[0].Similarity, 1e-6)
+	})
+
+	t.Run("applies filters", func(t *testing.T) {
+		embedder.On("CreateEmbeddings", []string{"ParseFile"}).Return([][]float32{{1, 0, 0}}, nil).Once()
+
+		results, err := store.SearchChunks(ctx, "ParseFile", SearchOptions{Limit: 5, VectorWeight: 1, KeywordWeight: 1, PathPrefix: "util"})
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "helper", results[0].Chunk.Name)
+	})
+
+	t.Run("upserts by identity", func(t *testing.T) {
+		updated := chunks[1]
+		updated.Content = "func (s *Store) StoreChunks() error { return nil }"
+		embedder.On("CreateEmbeddings", mock.Anything).Return([][]float32{{0, 1, 0}}, nil).Once()
+
+		assert.NoError(t, store.StoreChunks(ctx, []parser.CodeChunk{updated}))
+		assert.Len(t, store.rows, 3)
+		assert.Equal(t, int64(2), store.rows[1].id)
+		assert.Equal(t, updated.Content, store.rows[1].chunk.Content)
+	})
+}
+
+func TestMemoryStoreExportImport(t *testing.T) {
+	embedder := new(MockEmbedder)
+	src := NewMemoryStore(embedder)
+	ctx := context.Background()
+
+	chunks := []parser.CodeChunk{
+		{FilePath: "parser.go", Name: "ParseFile", Kind: parser.KindFunction, Language: "go"},
+		{FilePath: "store.go", Name: "StoreChunks", Kind: parser.KindMethod, Language: "go"},
+	}
+	embedder.On("CreateEmbeddings", mock.Anything).Return([][]float32{{1, 0}, {0, 1}}, nil).Once()
+	assert.NoError(t, src.StoreChunks(ctx, chunks))
+
+	var exported []StoredChunk
+	assert.NoError(t, src.ExportChunks(ctx, func(stored StoredChunk) error {
+		exported = append(exported, stored)
+		return nil
+	}))
+	assert.Equal(t, []StoredChunk{{Chunk: chunks[0], Embedding: []float32{1, 0}}, {Chunk: chunks[1], Embedding: []float32{0, 1}}}, exported)
+
+	reader := func(chunks []StoredChunk) func() (StoredChunk, error) {
+		return func() (StoredChunk, error) {
+			if len(chunks) == 0 {
+				return StoredChunk{}, io.EOF
+			}
+			next := chunks[0]
+			chunks = chunks[1:]
+			return next, nil
+		}
+	}
+
+	dst := NewMemoryStore(embedder)
+	count, err := dst.ImportChunks(ctx, "test-model", 2, reader(exported))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	model, dimension := dst.EmbeddingInfo()
+	assert.Equal(t, "test-model", model)
+	assert.Equal(t, 2, dimension)
+	assert.Equal(t, "StoreChunks", dst.rows[1].chunk.Name)
+
+	// Vectors of another model or dimension are rejected without importing anything
+	_, err = dst.ImportChunks(ctx, "other-model", 2, reader(exported))
+	assert.Error(t, err)
+	_, err = dst.ImportChunks(ctx, "test-model", 3, reader(exported))
+	assert.Error(t, err)
+	_, err = NewMemoryStore(embedder).ImportChunks(ctx, "test-model", 3, reader(exported))
+	assert.Error(t, err)
+	assert.Len(t, dst.rows, 2)
+}
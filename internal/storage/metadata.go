@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Keys stored in the index_metadata table
+const (
+	metaEmbeddingModel     = "embedding_model"
+	metaEmbeddingDimension = "embedding_dimension"
+	metaReembedModel       = "reembed_model"
+	metaEmbeddingIndex     = "embedding_index"
+)
+
+// defaultEmbeddingDimension matches the vector(768) column created by the initial schema
+const defaultEmbeddingDimension = 768
+
+// execQuerier is satisfied by both *sql.DB and *sql.Tx
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getMetadata returns the value stored under key and whether it was present
+func getMetadata(ctx context.Context, q execQuerier, key string) (string, bool, error) {
+	var value string
+	err := q.QueryRowContext(ctx, GET_INDEX_METADATA, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read index metadata %q: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func setMetadata(ctx context.Context, q execQuerier, key, value string) error {
+	if _, err := q.ExecContext(ctx, SET_INDEX_METADATA, key, value); err != nil {
+		return fmt.Errorf("failed to write index metadata %q: %w", key, err)
+	}
+	return nil
+}
+
+func deleteMetadata(ctx context.Context, q execQuerier, key string) error {
+	if _, err := q.ExecContext(ctx, DELETE_INDEX_METADATA, key); err != nil {
+		return fmt.Errorf("failed to delete index metadata %q: %w", key, err)
+	}
+	return nil
+}
+
+// loadEmbeddingInfo returns the model and dimension the stored vectors were built with,
+// recording the configured model on first use
+func loadEmbeddingInfo(ctx context.Context, q execQuerier, configuredModel string) (string, int, error) {
+	model, ok, err := getMetadata(ctx, q, metaEmbeddingModel)
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		model = configuredModel
+		if err := setMetadata(ctx, q, metaEmbeddingModel, model); err != nil {
+			return "", 0, err
+		}
+	}
+
+	dimension := defaultEmbeddingDimension
+	value, ok, err := getMetadata(ctx, q, metaEmbeddingDimension)
+	if err != nil {
+		return "", 0, err
+	}
+	if ok {
+		dimension, err = strconv.Atoi(value)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid embedding dimension %q: %w", value, err)
+		}
+	} else if err := setMetadata(ctx, q, metaEmbeddingDimension, strconv.Itoa(dimension)); err != nil {
+		return "", 0, err
+	}
+
+	return model, dimension, nil
+}
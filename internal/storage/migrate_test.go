@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "pairs and orders migrations",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   {Data: []byte("UP 2")},
+				"m/0001_first.up.sql":    {Data: []byte("UP 1")},
+				"m/0001_first.down.sql":  {Data: []byte("DOWN 1")},
+				"m/0002_second.down.sql": {Data: []byte("DOWN 2")},
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "UP 1", Down: "DOWN 1"},
+				{Version: 2, Name: "second", Up: "UP 2", Down: "DOWN 2"},
+			},
+		},
+		{
+			name:    "missing up script",
+			files:   fstest.MapFS{"m/0001_first.down.sql": {Data: []byte("DOWN 1")}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid file name",
+			files:   fstest.MapFS{"m/first.sql": {Data: []byte("UP")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files, "m")
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	assert.NoError(t, err)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration versions must be consecutive")
+		assert.NotEmpty(t, m.Down, "migration %d has no down script", m.Version)
+	}
+}
+
+func TestHNSWMigrationRecordsIndex(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(migrations), 5)
+
+	hnsw := migrations[4]
+	assert.Equal(t, "hnsw_index", hnsw.Name)
+	assert.Contains(t, hnsw.Up, "'"+metaEmbeddingIndex+"', '"+DefaultIndexConfig().String()+"'")
+	assert.Contains(t, hnsw.Down, "'"+metaEmbeddingIndex+"', '"+IndexConfig{Type: IndexIVFFlat, Lists: 100}.String()+"'")
+}
+
+func TestMigratorUpSkipsApplied(t *testing.T) {
+	db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	migrator := &Migrator{db: db, migrations: []Migration{
+		{Version: 1, Name: "first", Up: "UP 1"},
+		{Version: 2, Name: "second", Up: "UP 2"},
+	}}
+
+	mockDB.ExpectExec(LOCK_MIGRATIONS).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(CREATE_TABLE_SCHEMA_MIGRATIONS).WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectQuery(SELECT_APPLIED_MIGRATIONS).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec("UP 2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec(INSERT_SCHEMA_MIGRATION).WithArgs(2, "second").WillReturnResult(sqlmock.NewResult(0, 1))
+	mockDB.ExpectCommit()
+	mockDB.ExpectExec(UNLOCK_MIGRATIONS).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := migrator.Up(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
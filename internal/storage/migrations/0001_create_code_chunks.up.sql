@@ -0,0 +1,15 @@
+-- Create table with proper vector handling
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS code_chunks (
+	id SERIAL PRIMARY KEY,
+	file_path TEXT NOT NULL,
+	chunk_text JSONB NOT NULL,
+	embedding vector(768) NOT NULL,  -- Gemini embeddings size
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create an index for vector similarity search
+CREATE INDEX IF NOT EXISTS code_chunks_embedding_idx ON code_chunks
+USING ivfflat (embedding vector_cosine_ops)
+WITH (lists = 100);
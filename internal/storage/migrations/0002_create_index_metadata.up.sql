@@ -0,0 +1,5 @@
+-- Key/value metadata describing the stored index (embedding model, dimension, jobs in progress)
+CREATE TABLE IF NOT EXISTS index_metadata (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
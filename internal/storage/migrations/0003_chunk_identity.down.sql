@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS code_chunks_identity_idx;
+
+ALTER TABLE code_chunks DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE code_chunks DROP COLUMN IF EXISTS kind;
+ALTER TABLE code_chunks DROP COLUMN IF EXISTS symbol;
+ALTER TABLE code_chunks DROP COLUMN IF EXISTS repo;
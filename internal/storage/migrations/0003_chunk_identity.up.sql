@@ -0,0 +1,19 @@
+-- Give each chunk a stable identity; older rows are backfilled and de-duplicated
+-- (keeping the newest) before the unique index is created
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS repo TEXT NOT NULL DEFAULT '';
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS symbol TEXT NOT NULL DEFAULT '';
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '';
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE code_chunks SET symbol = chunk_text->>'Name' WHERE symbol = '';
+
+DELETE FROM code_chunks older
+USING code_chunks newer
+WHERE older.id < newer.id
+  AND older.repo = newer.repo
+  AND older.file_path = newer.file_path
+  AND older.symbol = newer.symbol
+  AND older.kind = newer.kind;
+
+CREATE UNIQUE INDEX IF NOT EXISTS code_chunks_identity_idx
+ON code_chunks (repo, file_path, symbol, kind);
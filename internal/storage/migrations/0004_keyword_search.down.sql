@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS code_chunks_search_idx;
+
+ALTER TABLE code_chunks DROP COLUMN IF EXISTS search_vector;
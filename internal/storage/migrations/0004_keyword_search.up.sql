@@ -0,0 +1,10 @@
+-- Full-text index over chunk names, descriptions and source for keyword search.
+-- The 'simple' configuration keeps identifiers intact instead of stemming them.
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS search_vector tsvector
+GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple'::regconfig, coalesce(chunk_text->>'Name', '')), 'A') ||
+	setweight(to_tsvector('simple'::regconfig, coalesce(chunk_text->>'Description', '')), 'B') ||
+	setweight(to_tsvector('simple'::regconfig, coalesce(chunk_text->>'Content', '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS code_chunks_search_idx ON code_chunks USING GIN (search_vector);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS code_chunks_embedding_idx;
+
+CREATE INDEX code_chunks_embedding_idx ON code_chunks
+USING ivfflat (embedding vector_cosine_ops)
+WITH (lists = 100);
+
+INSERT INTO index_metadata (key, value) VALUES ('embedding_index', 'ivfflat(lists=100)')
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
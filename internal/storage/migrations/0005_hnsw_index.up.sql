@@ -0,0 +1,11 @@
+-- The initial ivfflat index was trained on an empty table, so its lists never matched the data.
+-- HNSW needs no training and keeps good recall as rows are added (requires pgvector 0.5.0+).
+DROP INDEX IF EXISTS code_chunks_embedding_idx;
+
+CREATE INDEX code_chunks_embedding_idx ON code_chunks
+USING hnsw (embedding vector_cosine_ops)
+WITH (m = 16, ef_construction = 64);
+
+-- Record the new index so startup does not rebuild it for a config that already matches.
+INSERT INTO index_metadata (key, value) VALUES ('embedding_index', 'hnsw(m=16,ef_construction=64)')
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
@@ -0,0 +1,10 @@
+-- Conversation history for multi-turn /ask sessions
+CREATE TABLE IF NOT EXISTS session_messages (
+	id BIGSERIAL PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS session_messages_session_idx ON session_messages (session_id, id);
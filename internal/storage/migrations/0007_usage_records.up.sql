@@ -0,0 +1,19 @@
+-- Token usage and estimated cost of each API request
+CREATE TABLE IF NOT EXISTS usage_records (
+	id BIGSERIAL PRIMARY KEY,
+	request_id TEXT NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	repo TEXT NOT NULL DEFAULT '',
+	endpoint TEXT NOT NULL,
+	chat_calls INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens BIGINT NOT NULL DEFAULT 0,
+	completion_tokens BIGINT NOT NULL DEFAULT 0,
+	total_tokens BIGINT NOT NULL DEFAULT 0,
+	embedding_calls INTEGER NOT NULL DEFAULT 0,
+	embedding_chars BIGINT NOT NULL DEFAULT 0,
+	embedding_tokens BIGINT NOT NULL DEFAULT 0,
+	cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS usage_records_created_at_idx ON usage_records (created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS session_messages_activity_idx;
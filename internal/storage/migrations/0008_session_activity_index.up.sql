@@ -0,0 +1,2 @@
+-- Finds the last message of a session from the index, for session expiry
+CREATE INDEX IF NOT EXISTS session_messages_activity_idx ON session_messages (session_id, created_at);
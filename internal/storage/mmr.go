@@ -0,0 +1,76 @@
+package storage
+
+import "math"
+
+// diversify selects up to limit results using maximal marginal relevance: each pick
+// maximises lambda*relevance - (1-lambda)*redundancy, where relevance is the fused
+// score normalised to [0, 1] and redundancy is the highest cosine similarity to an
+// already selected result. lambda 1 keeps the fused order. Results from a file that
+// already contributed maxPerFile picks are skipped; maxPerFile 0 means no cap.
+func diversify(results []SearchResult, limit int, lambda float64, maxPerFile int) []SearchResult {
+	maxScore := 0.0
+	for _, r := range results {
+		maxScore = math.Max(maxScore, r.Score)
+	}
+
+	var (
+		selected  []SearchResult
+		perFile   = make(map[string]int)
+		remaining = append([]SearchResult(nil), results...)
+	)
+
+	for len(selected) < limit && len(remaining) > 0 {
+		best, bestValue := -1, math.Inf(-1)
+		for i, candidate := range remaining {
+			if maxPerFile > 0 && perFile[fileKey(candidate)] >= maxPerFile {
+				continue
+			}
+
+			relevance := 0.0
+			if maxScore > 0 {
+				relevance = candidate.Score / maxScore
+			}
+			redundancy := 0.0
+			for _, s := range selected {
+				redundancy = math.Max(redundancy, cosineSimilarity(candidate.Embedding, s.Embedding))
+			}
+
+			// Strict comparison keeps the earlier (higher fused) candidate on ties
+			if value := lambda*relevance - (1-lambda)*redundancy; value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		if best < 0 {
+			break // every remaining candidate is from a capped file
+		}
+
+		selected = append(selected, remaining[best])
+		perFile[fileKey(remaining[best])]++
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+
+	return selected
+}
+
+// fileKey identifies the file a result belongs to across repositories
+func fileKey(r SearchResult) string {
+	return r.Chunk.Repo + "\x00" + r.Chunk.FilePath
+}
+
+// cosineSimilarity returns the cosine similarity of a and b, or 0 when it is undefined
+func cosineSimilarity(a, b Vector) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiversify(t *testing.T) {
+	result := func(id int64, file string, score float64, embedding Vector) SearchResult {
+		return SearchResult{ID: id, Chunk: parser.CodeChunk{FilePath: file}, Score: score, Embedding: embedding}
+	}
+	candidates := []SearchResult{
+		result(1, "a.go", 1.0, Vector{1, 0}),
+		result(2, "a.go", 0.95, Vector{1, 0.01}), // near-duplicate of 1
+		result(3, "b.go", 0.9, Vector{0, 1}),
+		result(4, "a.go", 0.85, Vector{0.7, 0.7}),
+	}
+	ids := func(results []SearchResult) []int64 {
+		var out []int64
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name       string
+		limit      int
+		lambda     float64
+		maxPerFile int
+		want       []int64
+	}{
+		{"relevance only keeps fused order", 3, 1, 0, []int64{1, 2, 3}},
+		{"mmr skips near-duplicates", 3, 0.5, 0, []int64{1, 3, 4}},
+		{"per-file cap", 4, 1, 1, []int64{1, 3}},
+		{"cap and limit", 2, 1, 2, []int64{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diversify(candidates, tt.limit, tt.lambda, tt.maxPerFile)
+			assert.Equal(t, tt.want, ids(got))
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, cosineSimilarity(Vector{1, 2}, Vector{2, 4}), 1e-9)
+	assert.InDelta(t, 0.0, cosineSimilarity(Vector{1, 0}, Vector{0, 1}), 1e-9)
+	assert.Equal(t, 0.0, cosineSimilarity(Vector{1, 0}, Vector{1, 0, 0}))
+	assert.Equal(t, 0.0, cosineSimilarity(nil, nil))
+}
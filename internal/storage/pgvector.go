@@ -23,114 +23,252 @@ func joinFloat32s(v []float32) string {
 	return strings.Join(s, ",")
 }
 
+// embeddingText returns the text that is embedded for a chunk
+func embeddingText(chunk parser.CodeChunk) string {
+	return fmt.Sprintf("%s\n%s", chunk.Name, chunk.Description)
+}
+
+// chunkSymbol returns the qualified symbol identifying a chunk, falling back to its bare name
+func chunkSymbol(chunk parser.CodeChunk) string {
+	if chunk.Symbol != "" {
+		return chunk.Symbol
+	}
+	return chunk.Name
+}
+
+// insertBatchSize bounds rows per INSERT statement, well below PostgreSQL's 65535 parameter limit
+const insertBatchSize = 500
+
+// insertColumns is the number of parameters bound per inserted row
+const insertColumns = 6
+
+// insertValues renders the VALUES tuples of an INSERT_CODE_CHUNKS statement for rows rows
+func insertValues(rows int) string {
+	tuples := make([]string, rows)
+	for i := range tuples {
+		n := i*insertColumns + 1
+		tuples[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d::jsonb, $%d::vector)", n, n+1, n+2, n+3, n+4, n+5)
+	}
+	return strings.Join(tuples, ",\n\t")
+}
+
+// chunkIdentity is the key chunks are upserted by
+type chunkIdentity struct{ repo, filePath, symbol, kind string }
+
+func identityOf(chunk parser.CodeChunk) chunkIdentity {
+	return chunkIdentity{chunk.Repo, chunk.FilePath, chunkSymbol(chunk), chunk.Kind}
+}
+
+// dedupeChunks drops all but the last chunk with each identity, keeping input order
+func dedupeChunks(chunks []parser.CodeChunk) []parser.CodeChunk {
+	last := make(map[chunkIdentity]int, len(chunks))
+	for i, chunk := range chunks {
+		last[identityOf(chunk)] = i
+	}
+	if len(last) == len(chunks) {
+		return chunks
+	}
+
+	deduped := make([]parser.CodeChunk, 0, len(last))
+	for i, chunk := range chunks {
+		if last[identityOf(chunk)] == i {
+			deduped = append(deduped, chunk)
+		}
+	}
+	return deduped
+}
+
+// insertChunks upserts chunks with their embeddings in multi-row statements, with vectors in binary form
+func insertChunks(ctx context.Context, tx *sql.Tx, chunks []parser.CodeChunk, embeddings [][]float32, dimension int) error {
+	for start := 0; start < len(chunks); start += insertBatchSize {
+		end := min(start+insertBatchSize, len(chunks))
+
+		args := make([]interface{}, 0, (end-start)*insertColumns)
+		for i := start; i < end; i++ {
+			chunk := chunks[i]
+			if len(embeddings[i]) != dimension {
+				return fmt.Errorf("unexpected embedding dimension %d for file %s", len(embeddings[i]), chunk.FilePath)
+			}
+
+			// Serialize chunk data as JSONB; passed as a string so it is not sent as binary
+			chunkData, err := json.Marshal(chunk)
+			if err != nil {
+				return fmt.Errorf("failed to marshal chunk for file %s: %w", chunk.FilePath, err)
+			}
+
+			args = append(args,
+				chunk.Repo,
+				chunk.FilePath,
+				chunkSymbol(chunk),
+				chunk.Kind,
+				string(chunkData),
+				Vector(embeddings[i]),
+			)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(INSERT_CODE_CHUNKS, insertValues(end-start)), args...); err != nil {
+			return fmt.Errorf("failed to insert chunks for file %s: %w", chunks[start].FilePath, err)
+		}
+	}
+	return nil
+}
+
 // SearchResult represents a search result with similarity score
 type SearchResult struct {
-	Chunk      parser.CodeChunk
-	Similarity float64
+	ID          int64
+	Chunk       parser.CodeChunk
+	Similarity  float64 // Cosine similarity between the query and chunk embeddings
+	Score       float64 // Fused ranking score
+	RerankScore float64 // Relevance assigned by a reranker, 0 when results were not reranked
+	Embedding   Vector  // Chunk embedding, used to diversify results
 }
 
 type Store struct {
-	db       *sql.DB
-	embedder *embeddings.GeminiClient
+	db        *sql.DB
+	embedder  embeddings.Embedder
+	dimension int
+
+	// Embedding index build parameters and default per-query scan settings (0 keeps the server default)
+	index    IndexConfig
+	efSearch int
+	probes   int
 }
 
-func NewStore() *Store {
+// OpenDB opens a connection pool to the configured PostgreSQL database
+func OpenDB() (*sql.DB, error) {
 	cfg := config.GetConfig()
 	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		// binary_parameters sends Vector values in pgvector's binary format
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable binary_parameters=yes",
 		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName,
 	)
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		fmt.Printf("Failed to connect to database: %v\n", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// DB returns the store's connection pool, for components that keep their own tables in the same database.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Embedder returns the embedder the store embeds chunks and queries with.
+func (s *Store) Embedder() embeddings.Embedder {
+	return s.embedder
+}
+
+func NewStore() *Store {
+	cfg := config.GetConfig()
+
+	db, err := OpenDB()
+	if err != nil {
+		fmt.Printf("%v\n", err)
 		return nil
 	}
 
-	if err := initSchema(db); err != nil {
-		fmt.Printf("Failed to initialize schema: %v\n", err)
+	if cfg.AutoMigrate {
+		if err := initSchema(db); err != nil {
+			fmt.Printf("Failed to initialize schema: %v\n", err)
+			return nil
+		}
+	}
+
+	model, dimension, err := loadEmbeddingInfo(context.Background(), db, cfg.EmbeddingModel)
+	if err != nil {
+		fmt.Printf("Failed to load index metadata: %v\n", err)
 		return nil
 	}
+	if model != cfg.EmbeddingModel {
+		fmt.Printf("Warning: index was built with %s but EMBEDDING_MODEL is %s; run the reembed command\n", model, cfg.EmbeddingModel)
+	}
 
-	embedder, err := embeddings.NewGeminiClient(cfg.GeminiAPIKey)
+	embedder, err := embeddings.NewEmbedderFromConfig(cfg, model)
 	if err != nil {
 		fmt.Printf("Failed to create embedder: %v\n", err)
 		return nil
 	}
+
+	index := IndexConfig{
+		Type:           cfg.VectorIndex,
+		M:              cfg.HNSWM,
+		EFConstruction: cfg.HNSWEFConstruction,
+		Lists:          cfg.IVFFlatLists,
+	}
+	if err := index.Validate(); err != nil {
+		fmt.Printf("Invalid vector index configuration: %v\n", err)
+		return nil
+	}
+	if built, ok, err := getMetadata(context.Background(), db, metaEmbeddingIndex); err == nil && ok && built != index.String() {
+		fmt.Printf("Warning: embedding index is %s but %s is configured; run the reindex command\n", built, index)
+	}
+
 	return &Store{
-		db:       db,
-		embedder: embedder,
+		db:        db,
+		embedder:  embedder,
+		dimension: dimension,
+		index:     index,
+		efSearch:  cfg.HNSWEFSearch,
+		probes:    cfg.IVFFlatProbes,
 	}
 }
 
-func initSchema(db *sql.DB) error {
-	// Drop existing table
-	// if _, err := db.Exec(DROP_TABLE_CODE_CHUNKS); err != nil {
-	// 	return fmt.Errorf("failed to drop existing table: %w", err)
-	// }
-
-	// Create new table with proper vector support
-	if _, err := db.Exec(CREATE_TABLE_CODE_CHUNKS); err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+// EmbeddingCacheStats returns the embedding cache counters, or zeros when caching is disabled
+func (s *Store) EmbeddingCacheStats() embeddings.CacheStats {
+	if cached, ok := s.embedder.(*embeddings.CachedEmbedder); ok {
+		return cached.Stats()
 	}
-
-	return nil
+	return embeddings.CacheStats{}
 }
 
-func (s *Store) StoreChunks(ctx context.Context, chunks []parser.CodeChunk) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+// initSchema applies any pending schema migrations
+func initSchema(db *sql.DB) error {
+	migrator, err := NewMigrator(db)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
-	defer tx.Rollback() // will be ignored if tx.Commit() is called
 
-	stmt, err := tx.PrepareContext(ctx, INSERT_CODE_CHUNK)
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return err
 	}
-	defer stmt.Close()
-
-	for _, chunk := range chunks {
-		// Generate embeddings for the chunk
-		text := fmt.Sprintf("%s\n%s", chunk.Name, chunk.Description)
-		fmt.Printf("Generating embedding for chunk: %s\n", text) // Debug log
+	return nil
+}
 
-		embeddings, err := s.embedder.CreateEmbeddings([]string{text})
-		if err != nil {
-			return fmt.Errorf("failed to generate embeddings for %s: %w", chunk.FilePath, err)
-		}
+// StoreChunks embeds chunks and upserts them by identity in a single transaction
+func (s *Store) StoreChunks(ctx context.Context, chunks []parser.CodeChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
 
-		if len(embeddings) == 0 {
-			return fmt.Errorf("no embeddings generated for chunk in file %s", chunk.FilePath)
-		}
+	// An upsert statement cannot touch the same row twice
+	chunks = dedupeChunks(chunks)
 
-		if len(embeddings[0]) != 768 {
-			return fmt.Errorf("unexpected embedding dimension %d for file %s", len(embeddings[0]), chunk.FilePath)
-		}
+	// Generate embeddings for all chunks up front so the transaction stays short
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = embeddingText(chunk)
+	}
+	fmt.Printf("Generating embeddings for %d chunks\n", len(texts)) // Debug log
 
-		// Serialize chunk data as JSONB
-		chunkData, err := json.Marshal(chunk)
-		if err != nil {
-			return fmt.Errorf("failed to marshal chunk for file %s: %w", chunk.FilePath, err)
-		}
+	embeddings, err := s.embedder.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to generate embeddings for %s: %w", chunks[0].FilePath, err)
+	}
 
-		// Format embedding vector
-		embedding := Vector(embeddings[0])
-		encodedEmbedding := fmt.Sprintf("[%s]", joinFloat32s(embedding))
+	if len(embeddings) != len(chunks) {
+		return fmt.Errorf("expected %d embeddings, got %d", len(chunks), len(embeddings))
+	}
 
-		fmt.Printf("Inserting chunk for file: %s\n", chunk.FilePath) // Debug log
-		fmt.Printf("Chunk data length: %d bytes\n", len(chunkData))  // Debug log
-		fmt.Printf("Embedding length: %d values\n", len(embedding))  // Debug log
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // will be ignored if tx.Commit() is called
 
-		// Execute prepared statement
-		_, err = stmt.ExecContext(ctx,
-			chunk.FilePath,
-			chunkData, // Will be automatically cast to JSONB
-			encodedEmbedding,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert chunk for file %s: %w", chunk.FilePath, err)
-		}
+	if err := insertChunks(ctx, tx, chunks, embeddings, s.dimension); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -141,43 +279,149 @@ func (s *Store) StoreChunks(ctx context.Context, chunks []parser.CodeChunk) erro
 	return nil
 }
 
-func (s *Store) SearchChunks(ctx context.Context, query string) ([]SearchResult, error) {
-	// Generate embedding for the query
-	embeddings, err := s.embedder.CreateEmbeddings([]string{query})
+// DeleteByFile removes every chunk stored for a file of a repository and returns how many were deleted
+func (s *Store) DeleteByFile(ctx context.Context, repo, filePath string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, DELETE_CHUNKS_BY_FILE, repo, filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete chunks for file %s: %w", filePath, err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteByRepo removes every chunk stored for a repository and returns how many were deleted
+func (s *Store) DeleteByRepo(ctx context.Context, repo string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, DELETE_CHUNKS_BY_REPO, repo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete chunks for repository %s: %w", repo, err)
+	}
+	return res.RowsAffected()
+}
+
+// Query is one phrasing of a search; Weight scales its contribution to the fused ranking.
+type Query struct {
+	Text   string
+	Weight float64
+}
+
+// SearchChunks finds the chunks most relevant to query by fusing vector similarity
+// and full-text keyword matches, restricted by the metadata filters in opts. The fused
+// candidates are diversified with maximal marginal relevance and per-file caps.
+func (s *Store) SearchChunks(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	return s.SearchQueries(ctx, []Query{{Text: query, Weight: 1}}, opts)
+}
+
+// SearchQueries is SearchChunks over several phrasings of the same question, such as
+// LLM reformulations, fusing the results of every query. Similarity is reported against
+// the first query where possible.
+func (s *Store) SearchQueries(ctx context.Context, queries []Query, opts SearchOptions) ([]SearchResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no search query")
+	}
+
+	// Generate embeddings for all queries in one call
+	texts := make([]string, len(queries))
+	for i, query := range queries {
+		texts[i] = query.Text
+	}
+	embeddings, err := s.embedder.CreateEmbeddings(ctx, texts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	if len(embeddings) == 0 {
+	if len(embeddings) != len(queries) {
 		return nil, fmt.Errorf("no embedding generated for query")
 	}
 
-	// Search for similar chunks
-	embedding := Vector(embeddings[0])
-	encodedEmbedding := fmt.Sprintf("[%s]", joinFloat32s(embedding))
+	encodedEmbeddings := make([]string, len(embeddings))
+	for i, embedding := range embeddings {
+		encodedEmbeddings[i] = fmt.Sprintf("[%s]", joinFloat32s(embedding))
+	}
+	limit := opts.limit()
+	candidates := limit * candidateMultiplier
+	filters, filterArgs := opts.filterSQL(4)
+
+	var q preparer = s.db
+	if settings := s.searchSettings(opts, candidates); len(settings) > 0 {
+		// Settings are scoped to a read-only transaction so they do not leak to pooled connections
+		tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for _, setting := range settings {
+			if _, err := tx.ExecContext(ctx, SET_SEARCH_SETTING, setting[0], setting[1]); err != nil {
+				return nil, fmt.Errorf("failed to set %s: %w", setting[0], err)
+			}
+		}
+		q = tx
+	}
+
+	var (
+		lists   [][]SearchResult
+		weights []float64
+	)
+
+	for i, query := range queries {
+		if opts.VectorWeight > 0 {
+			args := append([]interface{}{encodedEmbeddings[i], opts.MinScore, candidates}, filterArgs...)
+			results, err := queryResults(ctx, q, fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, filters), args...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to search chunks: %w", err)
+			}
+			lists = append(lists, results)
+			weights = append(weights, opts.VectorWeight*query.Weight)
+		}
+
+		if tsquery := keywordQuery(query.Text); opts.KeywordWeight > 0 && tsquery != "" {
+			args := append([]interface{}{tsquery, encodedEmbeddings[0], candidates}, filterArgs...)
+			results, err := queryResults(ctx, q, fmt.Sprintf(SEARCH_KEYWORD_CHUNKS, filters), args...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to search chunks by keyword: %w", err)
+			}
+			lists = append(lists, results)
+			weights = append(weights, opts.KeywordWeight*query.Weight)
+		}
+	}
+
+	results := fuseResults(lists, weights)
+	return diversify(results, limit, opts.lambda(), opts.MaxPerFile), nil
+}
+
+// preparer is satisfied by both *sql.DB and *sql.Tx
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
 
+// queryResults runs a search query returning (id, file_path, chunk_text, similarity, embedding) rows
+func queryResults(ctx context.Context, q preparer, query string, args ...interface{}) ([]SearchResult, error) {
 	// Use prepared statement for better performance
-	stmt, err := s.db.PrepareContext(ctx, SEARCH_SIMILAR_CHUNKS)
+	stmt, err := q.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare search statement: %w", err)
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.QueryContext(ctx, encodedEmbedding, 5) // Top 5 most relevant chunks
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search chunks: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	var results []SearchResult
 	for rows.Next() {
 		var (
+			id         int64
 			filePath   string
 			chunkData  []byte
 			similarity float64
+			embedding  Vector
 		)
 
-		if err := rows.Scan(&filePath, &chunkData, &similarity); err != nil {
+		if err := rows.Scan(&id, &filePath, &chunkData, &similarity, &embedding); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -187,10 +431,12 @@ func (s *Store) SearchChunks(ctx context.Context, query string) ([]SearchResult,
 		}
 
 		results = append(results, SearchResult{
+			ID:         id,
 			Chunk:      chunk,
 			Similarity: similarity,
+			Embedding:  embedding,
 		})
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
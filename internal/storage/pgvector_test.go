@@ -3,10 +3,12 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 
 	"intelligent-doc-assistant/internal/parser"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -16,37 +18,43 @@ type MockEmbedder struct {
 	mock.Mock
 }
 
-func (m *MockEmbedder) CreateEmbeddings(texts []string) ([][]float32, error) {
+func (m *MockEmbedder) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
 	args := m.Called(texts)
 	return args.Get(0).([][]float32), args.Error(1)
 }
 
-// MockDB is a mock implementation of the database
-type MockDB struct {
-	mock.Mock
+func (m *MockEmbedder) Model() string {
+	return "test-model"
 }
 
-func (m *MockDB) ExecContext(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
-	mockArgs := m.Called(append([]interface{}{ctx, query}, args...)...)
-	return mockArgs.Get(0), mockArgs.Error(1)
-}
+// newMockStore returns a Store backed by sqlmock that matches queries verbatim
+func newMockStore(t *testing.T, embedder *MockEmbedder) (*Store, sqlmock.Sqlmock) {
+	db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
 
-func (m *MockDB) QueryContext(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
-	mockArgs := m.Called(append([]interface{}{ctx, query}, args...)...)
-	return mockArgs.Get(0), mockArgs.Error(1)
+	return &Store{
+		db:        db,
+		embedder:  embedder,
+		dimension: 3,
+		index:     DefaultIndexConfig(),
+	}, mockDB
 }
 
 func TestStoreChunks(t *testing.T) {
 	tests := []struct {
 		name    string
 		chunks  []parser.CodeChunk
-		setup   func(*MockEmbedder, *MockDB)
+		setup   func(*MockEmbedder, sqlmock.Sqlmock)
 		wantErr bool
 	}{
 		{
 			name: "successful storage",
 			chunks: []parser.CodeChunk{
 				{
+					Repo:        "github.com/org/repo",
+					Symbol:      "test.TestFunction",
+					Kind:        parser.KindFunction,
 					Name:        "TestFunction",
 					FilePath:    "/test/path.go",
 					StartLine:   1,
@@ -54,12 +62,15 @@ func TestStoreChunks(t *testing.T) {
 					Description: "Test function description",
 				},
 			},
-			setup: func(me *MockEmbedder, md *MockDB) {
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
 				embedding := []float32{0.1, 0.2, 0.3}
 				me.On("CreateEmbeddings", []string{"TestFunction\nTest function description"}).
 					Return([][]float32{embedding}, nil)
 
 				expectedData, _ := json.Marshal(parser.CodeChunk{
+					Repo:        "github.com/org/repo",
+					Symbol:      "test.TestFunction",
+					Kind:        parser.KindFunction,
 					Name:        "TestFunction",
 					FilePath:    "/test/path.go",
 					StartLine:   1,
@@ -67,20 +78,61 @@ func TestStoreChunks(t *testing.T) {
 					Description: "Test function description",
 				})
 
-				md.On("ExecContext",
-					mock.Anything,
-					INSERT_CODE_CHUNK,
-					"/test/path.go",
-					expectedData,
-					"[0.100000,0.200000,0.300000]",
-				).Return(nil, nil)
+				md.ExpectBegin()
+				md.ExpectExec(fmt.Sprintf(INSERT_CODE_CHUNKS, insertValues(1))).
+					WithArgs(
+						"github.com/org/repo",
+						"/test/path.go",
+						"test.TestFunction",
+						parser.KindFunction,
+						string(expectedData),
+						Vector{0.1, 0.2, 0.3},
+					).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				md.ExpectCommit()
+			},
+			wantErr: false,
+		},
+		{
+			name: "wrong embedding dimension",
+			chunks: []parser.CodeChunk{
+				{Name: "TestFunction", FilePath: "/test/path.go"},
+			},
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
+				me.On("CreateEmbeddings", []string{"TestFunction\n"}).
+					Return([][]float32{{0.1, 0.2}}, nil)
+
+				md.ExpectBegin()
+				md.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate identities keep the last chunk",
+			chunks: []parser.CodeChunk{
+				{Repo: "r", Symbol: "p.F", Name: "F", Description: "old", FilePath: "f.go"},
+				{Repo: "r", Symbol: "p.G", Name: "G", FilePath: "f.go"},
+				{Repo: "r", Symbol: "p.F", Name: "F", Description: "new", FilePath: "f.go"},
+			},
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
+				me.On("CreateEmbeddings", []string{"G\n", "F\nnew"}).
+					Return([][]float32{{1, 0, 0}, {0, 1, 0}}, nil)
+
+				md.ExpectBegin()
+				md.ExpectExec(fmt.Sprintf(INSERT_CODE_CHUNKS, insertValues(2))).
+					WithArgs(
+						"r", "f.go", "p.G", "", sqlmock.AnyArg(), Vector{1, 0, 0},
+						"r", "f.go", "p.F", "", sqlmock.AnyArg(), Vector{0, 1, 0},
+					).
+					WillReturnResult(sqlmock.NewResult(2, 2))
+				md.ExpectCommit()
 			},
 			wantErr: false,
 		},
 		{
 			name:    "empty chunks",
 			chunks:  []parser.CodeChunk{},
-			setup:   func(me *MockEmbedder, md *MockDB) {},
+			setup:   func(me *MockEmbedder, md sqlmock.Sqlmock) {},
 			wantErr: false,
 		},
 	}
@@ -88,14 +140,9 @@ func TestStoreChunks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockEmbedder := new(MockEmbedder)
-			mockDB := new(MockDB)
+			store, mockDB := newMockStore(t, mockEmbedder)
 			tt.setup(mockEmbedder, mockDB)
 
-			store := &Store{
-				db:       mockDB,
-				embedder: mockEmbedder,
-			}
-
 			ctx := context.Background()
 			err := store.StoreChunks(ctx, tt.chunks)
 
@@ -106,23 +153,28 @@ func TestStoreChunks(t *testing.T) {
 			}
 
 			mockEmbedder.AssertExpectations(t)
-			mockDB.AssertExpectations(t)
+			assert.NoError(t, mockDB.ExpectationsWereMet())
 		})
 	}
 }
 
 func TestSearchChunks(t *testing.T) {
+	// rrf is the fused score contributed by a 1-based rank with weight 1
+	rrf := func(rank int) float64 { return 1 / float64(rrfK+rank) }
+
 	tests := []struct {
 		name    string
 		query   string
-		setup   func(*MockEmbedder, *MockDB)
+		opts    SearchOptions
+		setup   func(*MockEmbedder, sqlmock.Sqlmock)
 		want    []SearchResult
 		wantErr bool
 	}{
 		{
 			name:  "successful search",
 			query: "test query",
-			setup: func(me *MockEmbedder, md *MockDB) {
+			opts:  SearchOptions{VectorWeight: 1},
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
 				embedding := []float32{0.1, 0.2, 0.3}
 				me.On("CreateEmbeddings", []string{"test query"}).
 					Return([][]float32{embedding}, nil)
@@ -136,25 +188,15 @@ func TestSearchChunks(t *testing.T) {
 				}
 				chunkData, _ := json.Marshal(chunk)
 
-				md.On("QueryContext",
-					mock.Anything,
-					SEARCH_SIMILAR_CHUNKS,
-					"[0.100000,0.200000,0.300000]",
-					5,
-				).Return([]struct {
-					FilePath   string
-					ChunkData  []byte
-					Similarity float64
-				}{
-					{
-						FilePath:   "/test/path.go",
-						ChunkData:  chunkData,
-						Similarity: 0.95,
-					},
-				}, nil)
+				md.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "")).
+					ExpectQuery().
+					WithArgs("[0.100000,0.200000,0.300000]", 0.0, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "file_path", "chunk_text", "similarity", "embedding"}).
+						AddRow(1, "/test/path.go", chunkData, 0.95, "[1,0,0]"))
 			},
 			want: []SearchResult{
 				{
+					ID: 1,
 					Chunk: parser.CodeChunk{
 						Name:        "TestFunction",
 						FilePath:    "/test/path.go",
@@ -163,25 +205,95 @@ func TestSearchChunks(t *testing.T) {
 						Description: "Test function description",
 					},
 					Similarity: 0.95,
+					Score:      rrf(1),
+					Embedding:  Vector{1, 0, 0},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name:  "hybrid search fuses keyword matches",
+			query: "where is joinFloat32s used?",
+			opts:  DefaultSearchOptions(),
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
+				me.On("CreateEmbeddings", []string{"where is joinFloat32s used?"}).
+					Return([][]float32{{0.1, 0.2, 0.3}}, nil)
+
+				semantic, _ := json.Marshal(parser.CodeChunk{Name: "StoreChunks"})
+				exact, _ := json.Marshal(parser.CodeChunk{Name: "joinFloat32s"})
+
+				md.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "")).
+					ExpectQuery().
+					WithArgs("[0.100000,0.200000,0.300000]", DefaultMinScore, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "file_path", "chunk_text", "similarity", "embedding"}).
+						AddRow(1, "pgvector.go", semantic, 0.80, "[1,0,0]").
+						AddRow(2, "pgvector.go", exact, 0.75, "[0,1,0]"))
+				md.ExpectPrepare(fmt.Sprintf(SEARCH_KEYWORD_CHUNKS, "")).
+					ExpectQuery().
+					WithArgs("joinfloat32s | join | float32s", "[0.100000,0.200000,0.300000]", 20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "file_path", "chunk_text", "similarity", "embedding"}).
+						AddRow(2, "pgvector.go", exact, 0.75, "[0,1,0]"))
+			},
+			want: []SearchResult{
+				{ID: 2, Chunk: parser.CodeChunk{Name: "joinFloat32s"}, Similarity: 0.75, Score: rrf(2) + rrf(1), Embedding: Vector{0, 1, 0}},
+				{ID: 1, Chunk: parser.CodeChunk{Name: "StoreChunks"}, Similarity: 0.80, Score: rrf(1), Embedding: Vector{1, 0, 0}},
+			},
+			wantErr: false,
+		},
+		{
+			name:  "filters and limit are pushed into the query",
+			query: "store",
+			opts:  SearchOptions{Limit: 2, MinScore: 0.5, VectorWeight: 1, Repo: "github.com/org/repo", Kind: parser.KindMethod},
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
+				me.On("CreateEmbeddings", []string{"store"}).
+					Return([][]float32{{0.1, 0.2, 0.3}}, nil)
+
+				md.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "AND kind = $4 AND repo = $5")).
+					ExpectQuery().
+					WithArgs("[0.100000,0.200000,0.300000]", 0.5, 8, parser.KindMethod, "github.com/org/repo").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "file_path", "chunk_text", "similarity", "embedding"}))
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:  "index scan settings run in a transaction",
+			query: "store",
+			opts:  SearchOptions{VectorWeight: 1, EFSearch: 100},
+			setup: func(me *MockEmbedder, md sqlmock.Sqlmock) {
+				me.On("CreateEmbeddings", []string{"store"}).
+					Return([][]float32{{0.1, 0.2, 0.3}}, nil)
+
+				md.ExpectBegin()
+				md.ExpectExec(SET_SEARCH_SETTING).
+					WithArgs("hnsw.ef_search", "100").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				md.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "")).
+					ExpectQuery().
+					WithArgs("[0.100000,0.200000,0.300000]", 0.0, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "file_path", "chunk_text", "similarity", "embedding"}))
+				md.ExpectRollback()
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "invalid options",
+			query:   "store",
+			opts:    SearchOptions{},
+			setup:   func(me *MockEmbedder, md sqlmock.Sqlmock) {},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockEmbedder := new(MockEmbedder)
-			mockDB := new(MockDB)
+			store, mockDB := newMockStore(t, mockEmbedder)
 			tt.setup(mockEmbedder, mockDB)
 
-			store := &Store{
-				db:       mockDB,
-				embedder: mockEmbedder,
-			}
-
 			ctx := context.Background()
-			got, err := store.SearchChunks(ctx, tt.query)
+			got, err := store.SearchChunks(ctx, tt.query, tt.opts)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -191,7 +303,56 @@ func TestSearchChunks(t *testing.T) {
 			}
 
 			mockEmbedder.AssertExpectations(t)
-			mockDB.AssertExpectations(t)
+			assert.NoError(t, mockDB.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestSearchQueries(t *testing.T) {
+	mockEmbedder := new(MockEmbedder)
+	store, mockDB := newMockStore(t, mockEmbedder)
+
+	mockEmbedder.On("CreateEmbeddings", []string{"how does auth work?", "func authenticate(token string) error"}).
+		Return([][]float32{{0.1, 0.2, 0.3}, {0.3, 0.2, 0.1}}, nil)
+
+	first, _ := json.Marshal(parser.CodeChunk{Name: "Login"})
+	second, _ := json.Marshal(parser.CodeChunk{Name: "authenticate"})
+	columns := []string{"id", "file_path", "chunk_text", "similarity", "embedding"}
+
+	mockDB.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "")).
+		ExpectQuery().
+		WithArgs("[0.100000,0.200000,0.300000]", 0.0, 20).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "auth.go", first, 0.8, "[1,0,0]"))
+	mockDB.ExpectPrepare(fmt.Sprintf(SEARCH_SIMILAR_CHUNKS, "")).
+		ExpectQuery().
+		WithArgs("[0.300000,0.200000,0.100000]", 0.0, 20).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(2, "token.go", second, 0.9, "[0,1,0]").
+			AddRow(1, "auth.go", first, 0.7, "[1,0,0]"))
+
+	got, err := store.SearchQueries(context.Background(), []Query{
+		{Text: "how does auth work?", Weight: 1},
+		{Text: "func authenticate(token string) error", Weight: 0.5},
+	}, SearchOptions{VectorWeight: 1})
+
+	assert.NoError(t, err)
+	rrf := func(rank int) float64 { return 1 / float64(rrfK+rank) }
+	assert.Equal(t, []SearchResult{
+		{ID: 1, Chunk: parser.CodeChunk{Name: "Login"}, Similarity: 0.8, Score: rrf(1) + 0.5*rrf(2), Embedding: Vector{1, 0, 0}},
+		{ID: 2, Chunk: parser.CodeChunk{Name: "authenticate"}, Similarity: 0.9, Score: 0.5 * rrf(1), Embedding: Vector{0, 1, 0}},
+	}, got)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestDeleteByRepo(t *testing.T) {
+	store, mockDB := newMockStore(t, new(MockEmbedder))
+	mockDB.ExpectExec(DELETE_CHUNKS_BY_REPO).
+		WithArgs("github.com/org/repo").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	deleted, err := store.DeleteByRepo(context.Background(), "github.com/org/repo")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
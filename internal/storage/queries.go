@@ -1,64 +1,156 @@
 package storage
 
 const (
-	// First, drop the existing table if it exists
-	DROP_TABLE_CODE_CHUNKS = `
-	DROP TABLE IF EXISTS code_chunks;`
-
-	// Create table with proper vector handling
-	CREATE_TABLE_CODE_CHUNKS = `
-	CREATE EXTENSION IF NOT EXISTS vector;
-	
-	CREATE TABLE IF NOT EXISTS code_chunks (
-		id SERIAL PRIMARY KEY,
-		file_path TEXT NOT NULL,
-		chunk_text JSONB NOT NULL,
-		embedding vector(768) NOT NULL,  -- Gemini embeddings size
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);
-	
-	-- Create an index for vector similarity search
-	CREATE INDEX IF NOT EXISTS code_chunks_embedding_idx ON code_chunks 
-	USING ivfflat (embedding vector_cosine_ops)
-	WITH (lists = 100);`
-
-	// Insert with explicit vector casting
-	INSERT_CODE_CHUNK = `
-	INSERT INTO code_chunks (file_path, chunk_text, embedding)
-	VALUES ($1, $2::jsonb, $3::vector);`
-
-	// Search using cosine similarity
+	// Key/value access to index_metadata
+	GET_INDEX_METADATA = `
+	SELECT value FROM index_metadata WHERE key = $1;`
+
+	SET_INDEX_METADATA = `
+	INSERT INTO index_metadata (key, value)
+	VALUES ($1, $2)
+	ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;`
+
+	DELETE_INDEX_METADATA = `
+	DELETE FROM index_metadata WHERE key = $1;`
+
+	// Insert or replace chunks with the same identity; %s receives one
+	// ($n, ..., $n+4::jsonb, $n+5::vector) tuple per row, see insertValues
+	INSERT_CODE_CHUNKS = `
+	INSERT INTO code_chunks (repo, file_path, symbol, kind, chunk_text, embedding)
+	VALUES %s
+	ON CONFLICT (repo, file_path, symbol, kind) DO UPDATE
+	SET chunk_text = EXCLUDED.chunk_text,
+		embedding = EXCLUDED.embedding,
+		updated_at = CURRENT_TIMESTAMP;`
+
+	SELECT_ALL_CHUNKS = `
+	SELECT chunk_text, embedding::text FROM code_chunks ORDER BY id;`
+
+	// Look up chunks by metadata in source order; %s receives the conditions of a ChunkFilter, starting at $2
+	FIND_CHUNKS = `
+	SELECT chunk_text FROM code_chunks
+	WHERE TRUE %s
+	ORDER BY repo, file_path, (chunk_text->>'StartLine')::int
+	LIMIT $1;`
+
+	DELETE_CHUNKS_BY_FILE = `
+	DELETE FROM code_chunks WHERE repo = $1 AND file_path = $2;`
+
+	DELETE_CHUNKS_BY_REPO = `
+	DELETE FROM code_chunks WHERE repo = $1;`
+
+	// Search using cosine similarity; %s receives additional filters from SearchOptions, starting at $4
 	SEARCH_SIMILAR_CHUNKS = `
-	SELECT file_path, chunk_text, 
-		   1 - (embedding <=> $1::vector) as similarity
+	SELECT id, file_path, chunk_text,
+		   1 - (embedding <=> $1::vector) as similarity, embedding::text
 	FROM code_chunks
-	WHERE 1 - (embedding <=> $1::vector) > 0.7  -- Similarity threshold
+	WHERE 1 - (embedding <=> $1::vector) > $2  -- Similarity threshold
+	%s
 	ORDER BY embedding <=> $1::vector
-	LIMIT $2;`
+	LIMIT $3;`
+
+	// Search the full-text index, reporting vector similarity too so results can be fused;
+	// %s receives additional filters from SearchOptions, starting at $4
+	SEARCH_KEYWORD_CHUNKS = `
+	SELECT id, file_path, chunk_text,
+		   1 - (embedding <=> $2::vector) as similarity, embedding::text
+	FROM code_chunks, to_tsquery('simple', $1) query
+	WHERE search_vector @@ query
+	%s
+	ORDER BY ts_rank_cd(search_vector, query) DESC
+	LIMIT $3;`
+)
+
+// Re-embedding writes new vectors into a shadow column and swaps it in once every row is filled
+const (
+	ADD_REEMBED_COLUMN = `
+	ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS embedding_next vector;`
+
+	DROP_REEMBED_COLUMN = `
+	ALTER TABLE code_chunks DROP COLUMN IF EXISTS embedding_next;`
+
+	SELECT_REEMBED_BATCH = `
+	SELECT id, chunk_text
+	FROM code_chunks
+	WHERE embedding_next IS NULL
+	ORDER BY id
+	LIMIT $1;`
+
+	UPDATE_REEMBED_VECTOR = `
+	UPDATE code_chunks SET embedding_next = $2::vector WHERE id = $1;`
+
+	COUNT_REEMBED_PENDING = `
+	SELECT COUNT(*) FROM code_chunks WHERE embedding_next IS NULL;`
+
+	GET_REEMBED_DIMENSION = `
+	SELECT vector_dims(embedding_next) FROM code_chunks LIMIT 1;`
+
+	LOCK_CODE_CHUNKS = `
+	LOCK TABLE code_chunks IN ACCESS EXCLUSIVE MODE;`
+
+	DROP_EMBEDDING_INDEX = `
+	DROP INDEX IF EXISTS code_chunks_embedding_idx;`
+
+	SWAP_EMBEDDING_COLUMN = `
+	ALTER TABLE code_chunks DROP COLUMN embedding;
+	ALTER TABLE code_chunks RENAME COLUMN embedding_next TO embedding;`
+
+	// The dimension is interpolated because type modifiers cannot be bound as parameters
+	RETYPE_EMBEDDING_COLUMN = `
+	ALTER TABLE code_chunks ALTER COLUMN embedding TYPE vector(%d);
+	ALTER TABLE code_chunks ALTER COLUMN embedding SET NOT NULL;`
+)
+
+// Embedding index maintenance
+const (
+	embeddingIndexName     = "code_chunks_embedding_idx"
+	nextEmbeddingIndexName = "code_chunks_embedding_idx_next"
+
+	// Interpolated with CONCURRENTLY or "", the index name, the index method and its parameters
+	CREATE_EMBEDDING_INDEX = `
+	CREATE INDEX %sIF NOT EXISTS %s ON code_chunks
+	USING %s (embedding vector_cosine_ops)
+	WITH (%s);`
+
+	DROP_NEXT_EMBEDDING_INDEX = `
+	DROP INDEX IF EXISTS code_chunks_embedding_idx_next;`
+
+	RENAME_NEXT_EMBEDDING_INDEX = `
+	ALTER INDEX code_chunks_embedding_idx_next RENAME TO code_chunks_embedding_idx;`
+
+	COUNT_CODE_CHUNKS = `
+	SELECT COUNT(*) FROM code_chunks;`
+
+	ANALYZE_CODE_CHUNKS = `
+	ANALYZE code_chunks;`
+
+	// Sets a search parameter such as hnsw.ef_search for the current transaction only
+	SET_SEARCH_SETTING = `
+	SELECT set_config($1, $2, true);`
 )
 
+// Migration bookkeeping
 const (
-	InsertFileMetadata = `
-        INSERT INTO file_metadata (path, type, size, last_modified)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id;
-    `
-
-	InsertFunctionDetails = `
-        INSERT INTO functions (file_id, name, params, returns, comment)
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id;
-    `
-
-	GetFunctionByName = `
-        SELECT id, file_id, name, params, returns, comment
-        FROM functions
-        WHERE name = $1;
-    `
-
-	SearchDocs = `
-        SELECT id, title, content
-        FROM documentation
-        WHERE to_tsvector('english', content) @@ plainto_tsquery($1);
-    `
+	CREATE_TABLE_SCHEMA_MIGRATIONS = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	SELECT_APPLIED_MIGRATIONS = `
+	SELECT version, applied_at FROM schema_migrations ORDER BY version;`
+
+	INSERT_SCHEMA_MIGRATION = `
+	INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+
+	DELETE_SCHEMA_MIGRATION = `
+	DELETE FROM schema_migrations WHERE version = $1;`
+
+	// Serialises migration runs across processes
+	LOCK_MIGRATIONS = `
+	SELECT pg_advisory_lock(7283940);`
+
+	UNLOCK_MIGRATIONS = `
+	SELECT pg_advisory_unlock(7283940);`
 )
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"intelligent-doc-assistant/internal/embeddings"
+	"intelligent-doc-assistant/internal/parser"
+)
+
+// DefaultReembedBatchSize is the number of chunks embedded per round trip when re-embedding
+const DefaultReembedBatchSize = 50
+
+// Reembed re-embeds every stored chunk with the given embedder. New vectors are written
+// into a shadow column one batch per transaction, so an interrupted run resumes where it
+// stopped. Once every row has a new vector the shadow column atomically replaces the live one.
+func (s *Store) Reembed(ctx context.Context, embedder embeddings.Embedder, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultReembedBatchSize
+	}
+
+	target, inProgress, err := getMetadata(ctx, s.db, metaReembedModel)
+	if err != nil {
+		return err
+	}
+	if inProgress && target != embedder.Model() {
+		return fmt.Errorf("re-embedding to %s is already in progress; abort it before switching to %s", target, embedder.Model())
+	}
+	if inProgress {
+		fmt.Printf("Resuming re-embedding to %s\n", target)
+	} else {
+		if _, err := s.db.ExecContext(ctx, ADD_REEMBED_COLUMN); err != nil {
+			return fmt.Errorf("failed to add shadow embedding column: %w", err)
+		}
+		if err := setMetadata(ctx, s.db, metaReembedModel, embedder.Model()); err != nil {
+			return err
+		}
+	}
+
+	dimension := 0
+	for {
+		done, err := s.reembedBatch(ctx, embedder, batchSize, &dimension)
+		if err != nil {
+			return err
+		}
+		if done == 0 {
+			break
+		}
+		fmt.Printf("Re-embedded %d chunks\n", done) // Progress log
+	}
+
+	return s.swapEmbeddings(ctx, embedder.Model(), dimension)
+}
+
+// reembedBatch fills the shadow column for the next batch of pending rows and returns how many were written
+func (s *Store) reembedBatch(ctx context.Context, embedder embeddings.Embedder, batchSize int, dimension *int) (int, error) {
+	rows, err := s.db.QueryContext(ctx, SELECT_REEMBED_BATCH, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select chunks to re-embed: %w", err)
+	}
+
+	var (
+		ids   []int64
+		texts []string
+	)
+	for rows.Next() {
+		var (
+			id        int64
+			chunkData []byte
+		)
+		if err := rows.Scan(&id, &chunkData); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		var chunk parser.CodeChunk
+		if err := json.Unmarshal(chunkData, &chunk); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to unmarshal chunk %d: %w", id, err)
+		}
+		ids = append(ids, id)
+		texts = append(texts, embeddingText(chunk))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read chunks to re-embed: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	vectors, err := embedder.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	if len(vectors) != len(ids) {
+		return 0, fmt.Errorf("expected %d embeddings, got %d", len(ids), len(vectors))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, UPDATE_REEMBED_VECTOR)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, id := range ids {
+		if *dimension == 0 {
+			*dimension = len(vectors[i])
+		}
+		if len(vectors[i]) != *dimension {
+			return 0, fmt.Errorf("inconsistent embedding dimension %d for chunk %d, expected %d", len(vectors[i]), id, *dimension)
+		}
+
+		encodedEmbedding := fmt.Sprintf("[%s]", joinFloat32s(vectors[i]))
+		if _, err := stmt.ExecContext(ctx, id, encodedEmbedding); err != nil {
+			return 0, fmt.Errorf("failed to update chunk %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(ids), nil
+}
+
+// swapEmbeddings replaces the live embedding column with the shadow column in a single transaction
+func (s *Store) swapEmbeddings(ctx context.Context, model string, dimension int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Block concurrent ingestion so no row can slip in without a new vector
+	if _, err := tx.ExecContext(ctx, LOCK_CODE_CHUNKS); err != nil {
+		return fmt.Errorf("failed to lock code_chunks: %w", err)
+	}
+
+	var pending int
+	if err := tx.QueryRowContext(ctx, COUNT_REEMBED_PENDING).Scan(&pending); err != nil {
+		return fmt.Errorf("failed to count pending chunks: %w", err)
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d chunks were added during re-embedding; run the command again to finish", pending)
+	}
+
+	if dimension == 0 {
+		// Nothing was left to embed in this run; take the dimension from an earlier run
+		err := tx.QueryRowContext(ctx, GET_REEMBED_DIMENSION).Scan(&dimension)
+		if errors.Is(err, sql.ErrNoRows) {
+			dimension = s.dimension
+		} else if err != nil {
+			return fmt.Errorf("failed to read re-embedded dimension: %w", err)
+		}
+	}
+
+	for _, query := range []string{
+		DROP_EMBEDDING_INDEX,
+		SWAP_EMBEDDING_COLUMN,
+		fmt.Sprintf(RETYPE_EMBEDDING_COLUMN, dimension),
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to swap embedding column: %w", err)
+		}
+	}
+	if err := s.createIndex(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := setMetadata(ctx, tx, metaEmbeddingModel, model); err != nil {
+		return err
+	}
+	if err := setMetadata(ctx, tx, metaEmbeddingDimension, strconv.Itoa(dimension)); err != nil {
+		return err
+	}
+	if err := deleteMetadata(ctx, tx, metaReembedModel); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.dimension = dimension
+	fmt.Printf("Switched index to embedding model %s (%d dimensions)\n", model, dimension)
+	return nil
+}
+
+// AbortReembed discards a partially completed re-embedding run
+func (s *Store) AbortReembed(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, DROP_REEMBED_COLUMN); err != nil {
+		return fmt.Errorf("failed to drop shadow embedding column: %w", err)
+	}
+	return deleteMetadata(ctx, s.db, metaReembedModel)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapEmbeddingsResumedDimension(t *testing.T) {
+	stop := errors.New("stop after retyping")
+
+	tests := []struct {
+		name          string
+		dimensionRows *sqlmock.Rows
+		want          int
+	}{
+		// A resumed run with nothing left to embed keeps the dimension of the earlier run's vectors
+		{"from earlier run", sqlmock.NewRows([]string{"vector_dims"}).AddRow(3072), 3072},
+		{"empty table", sqlmock.NewRows([]string{"vector_dims"}), 768},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			store := &Store{db: db, dimension: 768}
+
+			mockDB.ExpectBegin()
+			mockDB.ExpectExec(LOCK_CODE_CHUNKS).WillReturnResult(sqlmock.NewResult(0, 0))
+			mockDB.ExpectQuery(COUNT_REEMBED_PENDING).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mockDB.ExpectQuery(GET_REEMBED_DIMENSION).WillReturnRows(tt.dimensionRows)
+			mockDB.ExpectExec(DROP_EMBEDDING_INDEX).WillReturnResult(sqlmock.NewResult(0, 0))
+			mockDB.ExpectExec(SWAP_EMBEDDING_COLUMN).WillReturnResult(sqlmock.NewResult(0, 0))
+			mockDB.ExpectExec(fmt.Sprintf(RETYPE_EMBEDDING_COLUMN, tt.want)).WillReturnError(stop)
+			mockDB.ExpectRollback()
+
+			err = store.swapEmbeddings(context.Background(), "models/text-embedding-004", 0)
+
+			assert.ErrorIs(t, err, stop)
+			assert.NoError(t, mockDB.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"intelligent-doc-assistant/internal/parser"
+)
+
+// rrfK dampens the contribution of top ranks in reciprocal-rank fusion; 60 is the customary value
+const rrfK = 60
+
+// Result limits applied by SearchChunks
+const (
+	DefaultSearchLimit = 5
+	MaxSearchLimit     = 50
+)
+
+// DefaultMinScore is the minimum cosine similarity for semantic matches
+const DefaultMinScore = 0.7
+
+// candidateMultiplier controls how many candidates each retriever contributes to fusion
+const candidateMultiplier = 4
+
+// Diversification defaults: mostly relevance, and at most two chunks per file
+const (
+	DefaultMMRLambda  = 0.7
+	DefaultMaxPerFile = 2
+)
+
+// SearchOptions tunes a single search. Zero-valued filters match everything.
+type SearchOptions struct {
+	// Limit is the maximum number of results; 0 means DefaultSearchLimit
+	Limit int
+	// MinScore is the minimum cosine similarity for semantic matches. Keyword matches
+	// are exempt so exact identifiers are found even when their embedding is distant.
+	MinScore float64
+
+	// VectorWeight and KeywordWeight scale each retriever's contribution to the fused score.
+	// A zero weight disables that retriever.
+	VectorWeight  float64
+	KeywordWeight float64
+
+	// MMRLambda trades relevance (1) against diversity (towards 0) when picking results
+	// from the fused candidates with maximal marginal relevance. nil, like 1, keeps the
+	// fused order; 0 is set explicitly for diversity alone.
+	MMRLambda *float64
+	// MaxPerFile caps how many results may come from one file; 0 means no cap
+	MaxPerFile int
+
+	// EFSearch (HNSW) and Probes (IVFFlat) trade vector index speed for recall;
+	// 0 uses the store's configured defaults
+	EFSearch int
+	Probes   int
+
+	// Metadata filters
+	Language     string
+	Kind         string
+	PathPrefix   string
+	PathGlob     string // e.g. "internal/**/*.go"; * and ? do not cross "/", ** does
+	Package      string
+	Repo         string
+	ExportedOnly bool
+}
+
+// DefaultSearchOptions weighs semantic and keyword matches equally.
+func DefaultSearchOptions() SearchOptions {
+	lambda := DefaultMMRLambda
+	return SearchOptions{
+		Limit:         DefaultSearchLimit,
+		MinScore:      DefaultMinScore,
+		VectorWeight:  1,
+		KeywordWeight: 1,
+		MMRLambda:     &lambda,
+		MaxPerFile:    DefaultMaxPerFile,
+	}
+}
+
+// limit returns the effective result limit
+func (o SearchOptions) limit() int {
+	switch {
+	case o.Limit <= 0:
+		return DefaultSearchLimit
+	case o.Limit > MaxSearchLimit:
+		return MaxSearchLimit
+	default:
+		return o.Limit
+	}
+}
+
+// Validate reports options that cannot be honoured.
+func (o SearchOptions) Validate() error {
+	if o.MinScore < -1 || o.MinScore > 1 {
+		return fmt.Errorf("minScore must be between -1 and 1")
+	}
+	if o.VectorWeight < 0 || o.KeywordWeight < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	if o.VectorWeight == 0 && o.KeywordWeight == 0 {
+		return fmt.Errorf("at least one of vectorWeight and keywordWeight must be positive")
+	}
+	if o.MMRLambda != nil && (*o.MMRLambda < 0 || *o.MMRLambda > 1) {
+		return fmt.Errorf("mmrLambda must be between 0 and 1")
+	}
+	if o.MaxPerFile < 0 {
+		return fmt.Errorf("maxPerFile must not be negative")
+	}
+	if o.EFSearch < 0 || o.EFSearch > 1000 {
+		return fmt.Errorf("efSearch must be between 0 and 1000")
+	}
+	if o.Probes < 0 {
+		return fmt.Errorf("probes must not be negative")
+	}
+	return nil
+}
+
+// lambda returns the effective MMR lambda; 1 ranks by fused score alone
+func (o SearchOptions) lambda() float64 {
+	if o.MMRLambda == nil {
+		return 1
+	}
+	return *o.MMRLambda
+}
+
+// Matches reports whether chunk passes the metadata filters. Backends that cannot
+// push filters into their query language use it to filter in process.
+func (o SearchOptions) Matches(chunk parser.CodeChunk) bool {
+	switch {
+	case o.Language != "" && chunk.Language != o.Language:
+		return false
+	case o.Kind != "" && chunk.Kind != o.Kind:
+		return false
+	case o.PathPrefix != "" && !strings.HasPrefix(chunk.FilePath, o.PathPrefix):
+		return false
+	case o.PathGlob != "" && !globRegexp(o.PathGlob).MatchString(chunk.FilePath):
+		return false
+	case o.Package != "" && chunk.Package != o.Package:
+		return false
+	case o.Repo != "" && chunk.Repo != o.Repo:
+		return false
+	case o.ExportedOnly && !isExported(chunk.Name):
+		return false
+	}
+	return true
+}
+
+// filterSQL renders the metadata filters as SQL conditions with placeholders numbered from firstArg
+func (o SearchOptions) filterSQL(firstArg int) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, firstArg+len(args)-1))
+	}
+
+	if o.Language != "" {
+		add("chunk_text->>'Language' = $%d", o.Language)
+	}
+	if o.Kind != "" {
+		add("kind = $%d", o.Kind)
+	}
+	if o.PathPrefix != "" {
+		add("starts_with(file_path, $%d)", o.PathPrefix)
+	}
+	if o.PathGlob != "" {
+		add("file_path ~ $%d", globRegexp(o.PathGlob).String())
+	}
+	if o.Package != "" {
+		add("chunk_text->>'Package' = $%d", o.Package)
+	}
+	if o.Repo != "" {
+		add("repo = $%d", o.Repo)
+	}
+	if o.ExportedOnly {
+		// [[:upper:]] matches non-ASCII capitals too, as Go's unicode.IsUpper does
+		conditions = append(conditions, "chunk_text->>'Name' ~ '^[[:upper:]]'")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "AND " + strings.Join(conditions, " AND "), args
+}
+
+// globRegexp translates a path glob into an anchored regular expression understood by
+// both Go and PostgreSQL: "**" matches across directories, "*" and "?" do not
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// "**/" also matches zero directories
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func isExported(name string) bool {
+	for _, r := range name {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// keywordStopWords are dropped from keyword queries; the 'simple' text search configuration keeps them
+var keywordStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"called": true, "can": true, "code": true, "do": true, "does": true, "for": true, "from": true,
+	"function": true, "how": true, "i": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "the": true, "this": true, "to": true, "used": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "why": true, "with": true, "work": true,
+	"works": true,
+}
+
+// keywordQuery turns a natural-language question into an OR'ed to_tsquery expression.
+// It returns "" when the question has no usable terms.
+func keywordQuery(question string) string {
+	return strings.Join(QueryTerms(question), " | ")
+}
+
+// QueryTerms extracts lower-cased search terms from a question, dropping stop words.
+// Identifiers are kept whole and also split on camelCase and underscores so that
+// "joinFloat32s" matches both the exact symbol and prose mentioning "join" or "float32s".
+func QueryTerms(question string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(term string) {
+		term = strings.ToLower(term)
+		if len(term) < 2 || keywordStopWords[term] || seen[term] {
+			return
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+
+	for _, word := range identifierWords(question) {
+		add(word)
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			for _, part := range parts {
+				add(part)
+			}
+		}
+	}
+
+	return terms
+}
+
+// identifierWords splits text into runs of letters, digits and underscores
+func identifierWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// splitIdentifier splits camelCase, PascalCase and snake_case identifiers into words
+func splitIdentifier(ident string) []string {
+	var (
+		parts   []string
+		current []rune
+	)
+	runes := []rune(ident)
+	for i, r := range runes {
+		if r == '_' {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+				current = nil
+			}
+			continue
+		}
+		// Start a new word at a lower-to-upper transition, or before the last capital of an acronym ("HTTPServer")
+		boundary := unicode.IsUpper(r) && i > 0 &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])))
+		if boundary && len(current) > 0 {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// fuseResults combines ranked result lists with weighted reciprocal-rank fusion:
+// each result scores the sum of weight / (rrfK + rank) over the lists it appears in.
+// Results are identified by ID and returned best first with Score set.
+func fuseResults(lists [][]SearchResult, weights []float64) []SearchResult {
+	fused := make(map[int64]*SearchResult)
+	var order []int64
+
+	for i, list := range lists {
+		for rank, result := range list {
+			existing, ok := fused[result.ID]
+			if !ok {
+				r := result
+				r.Score = 0
+				existing = &r
+				fused[result.ID] = existing
+				order = append(order, result.ID)
+			}
+			existing.Score += weights[i] / float64(rrfK+rank+1)
+		}
+	}
+
+	results := make([]SearchResult, 0, len(order))
+	for _, id := range order {
+		results = append(results, *fused[id])
+	}
+	// Stable sort keeps earlier lists ahead on ties
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"testing"
+
+	"intelligent-doc-assistant/internal/parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordQuery(t *testing.T) {
+	tests := []struct {
+		question string
+		want     string
+	}{
+		{"where is joinFloat32s used?", "joinfloat32s | join | float32s"},
+		{"How does the HTTPServer start", "httpserver | http | server | start"},
+		{"what does parse_file return", "parse_file | parse | file | return"},
+		{"how is it done?", "done"},
+		{"is it?", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			assert.Equal(t, tt.want, keywordQuery(tt.question))
+		})
+	}
+}
+
+func TestFuseResults(t *testing.T) {
+	vector := []SearchResult{{ID: 1}, {ID: 2}, {ID: 3}}
+	keyword := []SearchResult{{ID: 3}, {ID: 4}}
+
+	got := fuseResults([][]SearchResult{vector, keyword}, []float64{1, 2})
+
+	ids := make([]int64, len(got))
+	for i, r := range got {
+		ids[i] = r.ID
+	}
+	// 3 appears in both lists and is boosted by the heavier keyword weight
+	assert.Equal(t, []int64{3, 4, 1, 2}, ids)
+	assert.InDelta(t, 1.0/63+2.0/61, got[0].Score, 1e-12)
+}
+
+func TestSearchOptionsMatches(t *testing.T) {
+	chunk := parser.CodeChunk{
+		Repo:     "github.com/org/repo",
+		Package:  "storage",
+		Kind:     parser.KindMethod,
+		Name:     "SearchChunks",
+		Language: "go",
+		FilePath: "internal/storage/pgvector.go",
+	}
+
+	tests := []struct {
+		name string
+		opts SearchOptions
+		want bool
+	}{
+		{"no filters", SearchOptions{}, true},
+		{"matching repo and kind", SearchOptions{Repo: "github.com/org/repo", Kind: parser.KindMethod}, true},
+		{"other language", SearchOptions{Language: "python"}, false},
+		{"path prefix", SearchOptions{PathPrefix: "internal/"}, true},
+		{"other path prefix", SearchOptions{PathPrefix: "api/"}, false},
+		{"recursive glob", SearchOptions{PathGlob: "internal/**/*.go"}, true},
+		{"single level glob", SearchOptions{PathGlob: "internal/*.go"}, false},
+		{"other package", SearchOptions{Package: "api"}, false},
+		{"exported only", SearchOptions{ExportedOnly: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.opts.Matches(chunk))
+		})
+	}
+
+	unexported := chunk
+	unexported.Name = "queryResults"
+	assert.False(t, SearchOptions{ExportedOnly: true}.Matches(unexported))
+}
+
+func TestFilterSQL(t *testing.T) {
+	opts := SearchOptions{Language: "go", PathGlob: "api/*.go", ExportedOnly: true}
+
+	sql, args := opts.filterSQL(4)
+
+	assert.Equal(t, "AND chunk_text->>'Language' = $4 AND file_path ~ $5 AND chunk_text->>'Name' ~ '^[[:upper:]]'", sql)
+	assert.Equal(t, []interface{}{"go", `^api/[^/]*\.go$`}, args)
+}
+
+func TestSearchOptionsLambda(t *testing.T) {
+	diversity := 0.0
+	assert.Equal(t, 1.0, SearchOptions{}.lambda())
+	assert.Equal(t, DefaultMMRLambda, DefaultSearchOptions().lambda())
+	// An explicit 0 picks for diversity alone rather than falling back to a default
+	assert.Equal(t, 0.0, SearchOptions{MMRLambda: &diversity}.lambda())
+	assert.NoError(t, SearchOptions{VectorWeight: 1, MMRLambda: &diversity}.Validate())
+}
@@ -5,27 +5,34 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // Vector represents a PostgreSQL vector type
 type Vector []float32
 
-// Value implements the driver.Valuer interface.
+// vectorHeaderSize covers the dimension and the reserved field of pgvector's binary format
+const vectorHeaderSize = 4
+
+// Value implements the driver.Valuer interface using pgvector's binary format, which the
+// server reads without parsing decimal text. The connection must send []byte parameters
+// in binary (lib/pq's binary_parameters=yes) and the placeholder must be cast to vector.
 func (v Vector) Value() (driver.Value, error) {
 	if len(v) == 0 {
 		return nil, nil
 	}
 
-	// Calculate the total size: 2 bytes for dimension, then 4 bytes per float32
-	size := 2 + len(v)*4
+	// Calculate the total size: 2 bytes for dimension, 2 reserved, then 4 bytes per float32
+	size := vectorHeaderSize + len(v)*4
 	buf := make([]byte, size)
 
-	// Write dimension (uint16, big endian)
+	// Write dimension (uint16, big endian); the reserved field stays zero
 	binary.BigEndian.PutUint16(buf[0:2], uint16(len(v)))
 
 	// Write float32 values
 	for i, f := range v {
-		binary.BigEndian.PutUint32(buf[2+i*4:], math.Float32bits(f))
+		binary.BigEndian.PutUint32(buf[vectorHeaderSize+i*4:], math.Float32bits(f))
 	}
 
 	return buf, nil
@@ -38,27 +45,61 @@ func (v *Vector) Scan(src interface{}) error {
 		return nil
 	}
 
-	b, ok := src.([]byte)
-	if !ok {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	default:
 		return fmt.Errorf("pgvector: expected []byte, got %T", src)
 	}
 
-	if len(b) < 2 {
+	// Text format as returned by the vector output function, e.g. "[0.1,0.2]"
+	if len(b) > 0 && b[0] == '[' {
+		return v.parseText(string(b))
+	}
+
+	if len(b) < vectorHeaderSize {
 		return fmt.Errorf("pgvector: invalid vector format")
 	}
 
 	// Read dimension
-	dim := binary.BigEndian.Uint16(b[0:2])
-	if len(b) != 2+int(dim)*4 {
-		return fmt.Errorf("pgvector: expected %d bytes, got %d", 2+dim*4, len(b))
+	dim := int(binary.BigEndian.Uint16(b[0:2]))
+	if len(b) != vectorHeaderSize+dim*4 {
+		return fmt.Errorf("pgvector: expected %d bytes, got %d", vectorHeaderSize+dim*4, len(b))
 	}
 
 	// Read float32 values
 	*v = make(Vector, dim)
-	for i := uint16(0); i < dim; i++ {
-		bits := binary.BigEndian.Uint32(b[2+i*4:])
+	for i := 0; i < dim; i++ {
+		bits := binary.BigEndian.Uint32(b[vectorHeaderSize+i*4:])
 		(*v)[i] = math.Float32frombits(bits)
 	}
 
 	return nil
 }
+
+// parseText decodes the pgvector text representation "[x,y,...]"
+func (v *Vector) parseText(s string) error {
+	if !strings.HasSuffix(s, "]") {
+		return fmt.Errorf("pgvector: invalid vector text %q", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		*v = Vector{}
+		return nil
+	}
+
+	fields := strings.Split(s, ",")
+	vec := make(Vector, len(fields))
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return fmt.Errorf("pgvector: invalid vector element %q: %w", field, err)
+		}
+		vec[i] = float32(f)
+	}
+	*v = vec
+	return nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVectorBinaryRoundTrip(t *testing.T) {
+	value, err := Vector{0.5, -1, 3}.Value()
+	assert.NoError(t, err)
+
+	// dimension 3, reserved 0, then big-endian float32s
+	b := value.([]byte)
+	assert.Equal(t, []byte{0, 3, 0, 0}, b[:4])
+	assert.Len(t, b, 4+3*4)
+
+	var v Vector
+	assert.NoError(t, v.Scan(b))
+	assert.Equal(t, Vector{0.5, -1, 3}, v)
+
+	assert.Error(t, v.Scan([]byte{0, 3, 0, 0, 1}))
+}
+
+func TestVectorScanText(t *testing.T) {
+	var v Vector
+	assert.NoError(t, v.Scan([]byte("[0.5,-1,2e-3]")))
+	assert.Equal(t, Vector{0.5, -1, 0.002}, v)
+
+	assert.Error(t, v.Scan("[0.5,abc]"))
+}
+
+func TestInsertValues(t *testing.T) {
+	assert.Equal(t,
+		"($1, $2, $3, $4, $5::jsonb, $6::vector),\n\t($7, $8, $9, $10, $11::jsonb, $12::vector)",
+		insertValues(2))
+}
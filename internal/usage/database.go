@@ -0,0 +1,108 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const (
+	INSERT_USAGE_RECORD = `
+	INSERT INTO usage_records (
+		request_id, user_id, repo, endpoint, chat_calls, prompt_tokens, completion_tokens, total_tokens,
+		embedding_calls, embedding_chars, embedding_tokens, cost_usd, created_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE($13::timestamptz, CURRENT_TIMESTAMP));`
+
+	// Sums the records between $2 and $3 (either may be NULL) per $1 period and the %[1]s key,
+	// grouped and ordered by the %[2]s columns
+	AGGREGATE_USAGE_RECORDS = `
+	SELECT
+		date_trunc($1, created_at AT TIME ZONE 'UTC') AS period,
+		%[1]s AS key,
+		COUNT(*),
+		SUM(chat_calls), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens),
+		SUM(embedding_calls), SUM(embedding_chars), SUM(embedding_tokens), SUM(cost_usd)
+	FROM usage_records
+	WHERE ($2::timestamptz IS NULL OR created_at >= $2)
+	AND ($3::timestamptz IS NULL OR created_at < $3)
+	GROUP BY %[2]s
+	ORDER BY %[2]s;`
+)
+
+// DBStore keeps usage records in the usage_records table, so they survive restarts and
+// cover all server instances.
+type DBStore struct {
+	db *sql.DB
+}
+
+// NewDBStore creates a store on db, which must have the usage_records migration applied.
+func NewDBStore(db *sql.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Record(ctx context.Context, record Record) error {
+	var createdAt interface{}
+	if !record.Time.IsZero() {
+		createdAt = record.Time
+	}
+	_, err := s.db.ExecContext(ctx, INSERT_USAGE_RECORD,
+		record.RequestID, record.User, record.Repo, record.Endpoint,
+		record.ChatCalls, record.PromptTokens, record.CompletionTokens, record.TotalTokens,
+		record.EmbeddingCalls, record.EmbeddingChars, record.EmbeddingTokens, record.CostUSD, createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to store usage record: %w", err)
+	}
+	return nil
+}
+
+func (s *DBStore) Aggregate(ctx context.Context, query Query) ([]Aggregate, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The key column comes from the validated grouping, never from user input. Without a
+	// grouping the key is an empty literal, which PostgreSQL does not allow in GROUP BY.
+	key, columns := "''", "period"
+	switch query.GroupBy {
+	case GroupByUser:
+		key = "user_id"
+	case GroupByRepo:
+		key = "repo"
+	case GroupByEndpoint:
+		key = "endpoint"
+	}
+	if query.GroupBy != "" {
+		columns += ", " + key
+	}
+
+	var from, to interface{}
+	if !query.From.IsZero() {
+		from = query.From
+	}
+	if !query.To.IsZero() {
+		to = query.To
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(AGGREGATE_USAGE_RECORDS, key, columns), query.Period, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	defer rows.Close()
+
+	var aggregates []Aggregate
+	for rows.Next() {
+		var a Aggregate
+		err := rows.Scan(&a.Start, &a.Key, &a.Requests,
+			&a.ChatCalls, &a.PromptTokens, &a.CompletionTokens, &a.TotalTokens,
+			&a.EmbeddingCalls, &a.EmbeddingChars, &a.EmbeddingTokens, &a.CostUSD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage aggregate: %w", err)
+		}
+		a.Start = a.Start.UTC()
+		aggregates = append(aggregates, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	return aggregates, nil
+}
@@ -0,0 +1,103 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps usage records in process memory for the retention period, so they are
+// lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	retention time.Duration
+	records   []Record
+	now       func() time.Time
+}
+
+// NewMemoryStore creates an in-memory store; a retention of 0 keeps records until restart.
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{retention: retention, now: time.Now}
+}
+
+func (s *MemoryStore) Record(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = s.now()
+	}
+	s.expire()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemoryStore) Aggregate(ctx context.Context, query Query) ([]Aggregate, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	type bucket struct {
+		start time.Time
+		key   string
+	}
+	sums := make(map[bucket]*Aggregate)
+	for _, record := range s.records {
+		if (!query.From.IsZero() && record.Time.Before(query.From)) || (!query.To.IsZero() && !record.Time.Before(query.To)) {
+			continue
+		}
+		b := bucket{start: periodStart(query.Period, record.Time), key: groupKey(query.GroupBy, record)}
+		sum, ok := sums[b]
+		if !ok {
+			sum = &Aggregate{Start: b.start, Key: b.key}
+			sums[b] = sum
+		}
+		sum.Requests++
+		sum.Totals = sum.Totals.Add(record.Totals)
+	}
+
+	aggregates := make([]Aggregate, 0, len(sums))
+	for _, sum := range sums {
+		aggregates = append(aggregates, *sum)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		if !aggregates[i].Start.Equal(aggregates[j].Start) {
+			return aggregates[i].Start.Before(aggregates[j].Start)
+		}
+		return aggregates[i].Key < aggregates[j].Key
+	})
+	return aggregates, nil
+}
+
+// expire drops records older than the retention period; the caller must hold s.mu
+func (s *MemoryStore) expire() {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := s.now().Add(-s.retention)
+	kept := s.records[:0]
+	for _, record := range s.records {
+		if !record.Time.Before(cutoff) {
+			kept = append(kept, record)
+		}
+	}
+	s.records = kept
+}
+
+func groupKey(groupBy string, record Record) string {
+	switch groupBy {
+	case GroupByUser:
+		return record.User
+	case GroupByRepo:
+		return record.Repo
+	case GroupByEndpoint:
+		return record.Endpoint
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,266 @@
+// Package usage accounts for the tokens, and their cost, that each API request spends on
+// chat models and embeddings, and aggregates them by user, repository and period.
+package usage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"intelligent-doc-assistant/config"
+)
+
+// charsPerToken estimates embedding tokens from characters, since embedding APIs do not
+// report the tokens they count
+const charsPerToken = 4
+
+// Totals are the model calls and tokens of one or more requests.
+type Totals struct {
+	ChatCalls        int `json:"chatCalls"`
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+	EmbeddingCalls   int `json:"embeddingCalls"`
+	EmbeddingChars   int `json:"embeddingChars"`
+	// EmbeddingTokens are estimated from the characters embedded
+	EmbeddingTokens int     `json:"embeddingTokens"`
+	CostUSD         float64 `json:"costUsd"`
+}
+
+// Add returns the sum of t and other.
+func (t Totals) Add(other Totals) Totals {
+	return Totals{
+		ChatCalls:        t.ChatCalls + other.ChatCalls,
+		PromptTokens:     t.PromptTokens + other.PromptTokens,
+		CompletionTokens: t.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      t.TotalTokens + other.TotalTokens,
+		EmbeddingCalls:   t.EmbeddingCalls + other.EmbeddingCalls,
+		EmbeddingChars:   t.EmbeddingChars + other.EmbeddingChars,
+		EmbeddingTokens:  t.EmbeddingTokens + other.EmbeddingTokens,
+		CostUSD:          t.CostUSD + other.CostUSD,
+	}
+}
+
+// Prices are the USD prices per million tokens used to estimate the cost of requests.
+type Prices struct {
+	Prompt     float64
+	Completion float64
+	Embedding  float64
+}
+
+// PricesFromConfig returns the prices configured by the *_PRICE_PER_MTOK variables.
+func PricesFromConfig(cfg *config.Config) Prices {
+	return Prices{Prompt: cfg.PromptPricePerMTok, Completion: cfg.CompletionPricePerMTok, Embedding: cfg.EmbeddingPricePerMTok}
+}
+
+// Cost returns the cost of the tokens in t.
+func (p Prices) Cost(t Totals) float64 {
+	return (float64(t.PromptTokens)*p.Prompt +
+		float64(t.CompletionTokens)*p.Completion +
+		float64(t.EmbeddingTokens)*p.Embedding) / 1e6
+}
+
+// Meter adds up the usage of one request. It is safe for concurrent use.
+type Meter struct {
+	mu     sync.Mutex
+	prices Prices
+	totals Totals
+	repo   string
+}
+
+// NewMeter creates a meter that prices usage with prices.
+func NewMeter(prices Prices) *Meter {
+	return &Meter{prices: prices}
+}
+
+// AddChat records a chat model call and the tokens the model reported for it.
+func (m *Meter) AddChat(promptTokens, completionTokens, totalTokens int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totals.ChatCalls++
+	m.totals.PromptTokens += promptTokens
+	m.totals.CompletionTokens += completionTokens
+	m.totals.TotalTokens += totalTokens
+}
+
+// AddEmbedding records an embedding call for input.
+func (m *Meter) AddEmbedding(input []string) {
+	if m == nil {
+		return
+	}
+	chars := 0
+	for _, text := range input {
+		chars += len(text)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totals.EmbeddingCalls++
+	m.totals.EmbeddingChars += chars
+	m.totals.EmbeddingTokens += (chars + charsPerToken - 1) / charsPerToken
+}
+
+// SetRepo attributes the request to the repository repo.
+func (m *Meter) SetRepo(repo string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.repo = repo
+}
+
+// Totals returns the usage recorded so far and its cost.
+func (m *Meter) Totals() Totals {
+	if m == nil {
+		return Totals{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totals := m.totals
+	totals.CostUSD = m.prices.Cost(totals)
+	return totals
+}
+
+// Repo returns the repository the request is attributed to.
+func (m *Meter) Repo() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.repo
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context whose model calls are recorded in m.
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// FromContext returns the meter of ctx, or nil when its usage is not metered. The methods
+// of a nil Meter do nothing.
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
+
+// Record is the usage of one API request.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	User      string    `json:"user,omitempty"`
+	Repo      string    `json:"repo,omitempty"`
+	Endpoint  string    `json:"endpoint"`
+	Totals
+}
+
+// Periods usage can be aggregated by
+const (
+	PeriodHour  = "hour"
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// Dimensions usage can be grouped by besides the period
+const (
+	GroupByUser     = "user"
+	GroupByRepo     = "repo"
+	GroupByEndpoint = "endpoint"
+)
+
+// Query selects the records from From (inclusive) to To (exclusive) and how they are aggregated.
+// A zero From or To leaves that end open, and an empty GroupBy aggregates by period only.
+type Query struct {
+	Period  string
+	GroupBy string
+	From    time.Time
+	To      time.Time
+}
+
+// Validate checks the period and grouping.
+func (q Query) Validate() error {
+	switch q.Period {
+	case PeriodHour, PeriodDay, PeriodWeek, PeriodMonth:
+	default:
+		return fmt.Errorf("period must be one of %s, %s, %s or %s", PeriodHour, PeriodDay, PeriodWeek, PeriodMonth)
+	}
+	switch q.GroupBy {
+	case "", GroupByUser, GroupByRepo, GroupByEndpoint:
+	default:
+		return fmt.Errorf("groupBy must be one of %s, %s or %s", GroupByUser, GroupByRepo, GroupByEndpoint)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	return nil
+}
+
+// Aggregate is the usage of the requests in one period, and group if grouped.
+type Aggregate struct {
+	// Start is the beginning of the period in UTC; weeks start on Monday
+	Start    time.Time `json:"start"`
+	Key      string    `json:"key,omitempty"`
+	Requests int       `json:"requests"`
+	Totals
+}
+
+// Store keeps usage records.
+type Store interface {
+	// Record stores the usage of a request.
+	Record(ctx context.Context, record Record) error
+	// Aggregate sums the records selected by query, ordered by period and then key.
+	Aggregate(ctx context.Context, query Query) ([]Aggregate, error)
+}
+
+// NewStoreFromConfig builds the usage store selected by USAGE_STORE, using db for the
+// database backend. It returns a nil Store when usage is not recorded.
+func NewStoreFromConfig(cfg *config.Config, db *sql.DB) (Store, error) {
+	switch cfg.UsageStore {
+	case "none":
+		return nil, nil
+	case "", "memory":
+		return NewMemoryStore(time.Duration(cfg.UsageRetentionDays) * 24 * time.Hour), nil
+	case "database":
+		if db == nil {
+			return nil, fmt.Errorf("database usage store requires a database connection")
+		}
+		return NewDBStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown usage store %q", cfg.UsageStore)
+	}
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// periodStart returns the start of the period containing t, in UTC, matching Postgres'
+// date_trunc
+func periodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	switch period {
+	case PeriodHour:
+		return t.Truncate(time.Hour)
+	case PeriodWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
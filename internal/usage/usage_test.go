@@ -0,0 +1,189 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	meter := NewMeter(Prices{Prompt: 1, Completion: 2, Embedding: 0.5})
+	meter.AddChat(1000, 200, 1200)
+	meter.AddChat(500, 100, 600)
+	meter.AddEmbedding([]string{"abcdefgh", "abc"})
+	meter.SetRepo("github.com/acme/shop")
+
+	totals := meter.Totals()
+	assert.Equal(t, 2, totals.ChatCalls)
+	assert.Equal(t, 1500, totals.PromptTokens)
+	assert.Equal(t, 300, totals.CompletionTokens)
+	assert.Equal(t, 1800, totals.TotalTokens)
+	assert.Equal(t, 1, totals.EmbeddingCalls)
+	assert.Equal(t, 11, totals.EmbeddingChars)
+	assert.Equal(t, 3, totals.EmbeddingTokens)
+	assert.InDelta(t, (1500*1+300*2+3*0.5)/1e6, totals.CostUSD, 1e-12)
+	assert.Equal(t, "github.com/acme/shop", meter.Repo())
+}
+
+func TestMeterFromContext(t *testing.T) {
+	// Unmetered contexts have a nil meter, which ignores usage
+	unmetered := FromContext(context.Background())
+	assert.Nil(t, unmetered)
+	unmetered.AddChat(1, 1, 2)
+	unmetered.AddEmbedding([]string{"text"})
+	assert.Equal(t, Totals{}, unmetered.Totals())
+
+	meter := NewMeter(Prices{})
+	FromContext(WithMeter(context.Background(), meter)).AddChat(1, 2, 3)
+	assert.Equal(t, 3, meter.Totals().TotalTokens)
+}
+
+func TestPeriodStart(t *testing.T) {
+	// A Thursday afternoon, given in a zone east of UTC
+	tm := time.Date(2024, 3, 7, 14, 35, 0, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		period string
+		want   time.Time
+	}{
+		{PeriodHour, time.Date(2024, 3, 7, 13, 0, 0, 0, time.UTC)},
+		{PeriodDay, time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)},
+		{PeriodWeek, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			assert.Equal(t, tt.want, periodStart(tt.period, tm))
+		})
+	}
+
+	// Sundays belong to the week starting the Monday before
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), periodStart(PeriodWeek, time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestQueryValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		query   Query
+		wantErr bool
+	}{
+		{"period only", Query{Period: PeriodDay}, false},
+		{"grouped", Query{Period: PeriodMonth, GroupBy: GroupByRepo}, false},
+		{"range", Query{Period: PeriodHour, From: now.Add(-time.Hour), To: now}, false},
+		{"missing period", Query{}, true},
+		{"unknown period", Query{Period: "year"}, true},
+		{"unknown grouping", Query{Period: PeriodDay, GroupBy: "model"}, true},
+		{"empty range", Query{Period: PeriodDay, From: now, To: now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreAggregate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(30 * 24 * time.Hour)
+	store.now = func() time.Time { return now }
+
+	day1, day2 := now.AddDate(0, 0, -1), now
+	for _, record := range []Record{
+		{Time: day1, User: "alice", Repo: "shop", Endpoint: "ask", Totals: Totals{PromptTokens: 100, CostUSD: 0.1}},
+		{Time: day1, User: "bob", Repo: "shop", Endpoint: "ask", Totals: Totals{PromptTokens: 50, CostUSD: 0.05}},
+		{Time: day2, User: "alice", Repo: "blog", Endpoint: "ingest", Totals: Totals{EmbeddingTokens: 1000, CostUSD: 0.2}},
+		// Past the retention period
+		{Time: now.AddDate(0, 0, -60), User: "alice", Totals: Totals{PromptTokens: 1}},
+	} {
+		require.NoError(t, store.Record(ctx, record))
+	}
+
+	aggregates, err := store.Aggregate(ctx, Query{Period: PeriodDay, GroupBy: GroupByUser})
+	require.NoError(t, err)
+	require.Len(t, aggregates, 3)
+	assert.Equal(t, Aggregate{Start: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), Key: "alice", Requests: 1, Totals: Totals{PromptTokens: 100, CostUSD: 0.1}}, aggregates[0])
+	assert.Equal(t, "bob", aggregates[1].Key)
+	assert.Equal(t, Aggregate{Start: time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC), Key: "alice", Requests: 1, Totals: Totals{EmbeddingTokens: 1000, CostUSD: 0.2}}, aggregates[2])
+
+	aggregates, err = store.Aggregate(ctx, Query{Period: PeriodMonth, GroupBy: GroupByRepo})
+	require.NoError(t, err)
+	require.Len(t, aggregates, 2)
+	assert.Equal(t, "blog", aggregates[0].Key)
+	assert.Equal(t, "shop", aggregates[1].Key)
+	assert.Equal(t, 2, aggregates[1].Requests)
+	assert.Equal(t, 150, aggregates[1].PromptTokens)
+
+	// From is inclusive and To exclusive
+	aggregates, err = store.Aggregate(ctx, Query{Period: PeriodDay, From: day1, To: day2})
+	require.NoError(t, err)
+	require.Len(t, aggregates, 1)
+	assert.Equal(t, 2, aggregates[0].Requests)
+}
+
+func TestDBStore(t *testing.T) {
+	db, mockDB, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewDBStore(db)
+	ctx := context.Background()
+	day := time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	mockDB.ExpectExec(INSERT_USAGE_RECORD).
+		WithArgs("req1", "alice", "shop", "ask", 1, 100, 20, 120, 1, 40, 10, 0.5, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	err = store.Record(ctx, Record{RequestID: "req1", User: "alice", Repo: "shop", Endpoint: "ask", Totals: Totals{
+		ChatCalls: 1, PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120,
+		EmbeddingCalls: 1, EmbeddingChars: 40, EmbeddingTokens: 10, CostUSD: 0.5,
+	}})
+	assert.NoError(t, err)
+
+	mockDB.ExpectQuery(fmt.Sprintf(AGGREGATE_USAGE_RECORDS, "user_id", "period, user_id")).WithArgs(PeriodDay, day, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "key", "count", "chat_calls", "prompt_tokens", "completion_tokens",
+			"total_tokens", "embedding_calls", "embedding_chars", "embedding_tokens", "cost_usd"}).
+			AddRow(day, "alice", 2, 2, 200, 40, 240, 1, 40, 10, 0.75))
+	aggregates, err := store.Aggregate(ctx, Query{Period: PeriodDay, GroupBy: GroupByUser, From: day})
+	assert.NoError(t, err)
+	assert.Equal(t, []Aggregate{{Start: day, Key: "alice", Requests: 2, Totals: Totals{
+		ChatCalls: 2, PromptTokens: 200, CompletionTokens: 40, TotalTokens: 240,
+		EmbeddingCalls: 1, EmbeddingChars: 40, EmbeddingTokens: 10, CostUSD: 0.75,
+	}}}, aggregates)
+
+	// Without a grouping the empty key is only selected, not grouped or ordered by
+	noGroup := `
+	SELECT
+		date_trunc($1, created_at AT TIME ZONE 'UTC') AS period,
+		'' AS key,
+		COUNT(*),
+		SUM(chat_calls), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens),
+		SUM(embedding_calls), SUM(embedding_chars), SUM(embedding_tokens), SUM(cost_usd)
+	FROM usage_records
+	WHERE ($2::timestamptz IS NULL OR created_at >= $2)
+	AND ($3::timestamptz IS NULL OR created_at < $3)
+	GROUP BY period
+	ORDER BY period;`
+	mockDB.ExpectQuery(noGroup).WithArgs(PeriodMonth, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "key", "count", "chat_calls", "prompt_tokens", "completion_tokens",
+			"total_tokens", "embedding_calls", "embedding_chars", "embedding_tokens", "cost_usd"}).
+			AddRow(day, "", 2, 2, 200, 40, 240, 1, 40, 10, 0.75))
+	aggregates, err = store.Aggregate(ctx, Query{Period: PeriodMonth})
+	assert.NoError(t, err)
+	assert.Len(t, aggregates, 1)
+	assert.Empty(t, aggregates[0].Key)
+
+	// Invalid queries never reach the database
+	_, err = store.Aggregate(ctx, Query{Period: "day; DROP TABLE usage_records"})
+	assert.Error(t, err)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}